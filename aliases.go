@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"os"
+	"strings"
+)
+
+type aliasesConfig struct {
+	Git bool   `yaml:"git"`
+	Log string `yaml:"log"`
+}
+
+// contentRenames returns the paths, relative to the content directory, that
+// each content file had before it was renamed, following chains of renames
+// so that every earlier name leads to the current one. Renames are read
+// from the git history of the content directory and from the rename log,
+// whose lines each hold an old and a new path, oldest first.
+func (b *builder) contentRenames() map[string][]string {
+	var renames [][2]string
+	config := b.settings.Aliases
+
+	if config.Git {
+		history, err := git(contentDirectory, "log", "--relative", "--reverse", "-M", "--diff-filter=R", "--name-status", "--format=", "--", ".")
+		if err != nil {
+			warnf("not generating aliases from git history: %v", err)
+		}
+		for _, line := range strings.Split(history, "\n") {
+			fields := strings.Split(line, "\t")
+			if len(fields) == 3 && strings.HasPrefix(fields[0], "R") {
+				renames = append(renames, [2]string{fields[1], fields[2]})
+			}
+		}
+	}
+
+	if config.Log != "" {
+		file, err := os.Open(config.Log)
+		check(err)
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for number := 1; scanner.Scan(); number++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			fields := strings.Fields(line)
+			if len(fields) != 2 {
+				warnAt(config.Log, number, "expected an old and a new path")
+				continue
+			}
+			renames = append(renames, [2]string{fields[0], fields[1]})
+		}
+		check(scanner.Err())
+	}
+
+	previous := make(map[string][]string)
+	for _, rename := range renames {
+		from, to := rename[0], rename[1]
+		if from == to {
+			continue
+		}
+		previous[to] = append(previous[to], append(previous[from], from)...)
+		delete(previous, from)
+	}
+	return previous
+}
+
+// writeAliases writes a redirect page at the old URL of every renamed page
+// to its current URL, unless another page is now written there.
+func (b *builder) writeAliases(pages []*Page) {
+	if !b.settings.Aliases.Git && b.settings.Aliases.Log == "" {
+		return
+	}
+
+	outputs := make(map[string]bool, len(pages))
+	for _, page := range pages {
+		outputs[page.OutputPath] = true
+	}
+
+	renames := b.contentRenames()
+	for _, page := range pages {
+		contentPath := strings.TrimPrefix(page.SourcePath, contentDirectory+"/")
+		for _, oldPath := range renames[contentPath] {
+			if !b.isContentFile(oldPath) {
+				continue
+			}
+			outputPath := b.settings.parseContentPath(oldPath).outputPath
+			if outputs[outputPath] {
+				continue
+			}
+			outputs[outputPath] = true
+			b.writeOutput(outputPath, []byte(aliasPage(page.Permalink)))
+		}
+	}
+}
+
+func aliasPage(url string) string {
+	url = html.EscapeString(url)
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+<title>%s</title>
+<link rel="canonical" href="%s">
+<meta name="robots" content="noindex">
+<meta http-equiv="refresh" content="0; url=%s">
+</head>
+</html>
+`, url, url, url)
+}
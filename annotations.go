@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// buildWarning is a warning logged during the build, with the file and
+// line it is about when it has them.
+type buildWarning struct {
+	file    string
+	line    int
+	message string
+	failed  bool
+}
+
+// sourceLine returns the line of the file at sourcePath on which needle
+// first appears, regardless of case, or 0 if it does not.
+func sourceLine(sourcePath string, needle string) int {
+	data, err := os.ReadFile(sourcePath)
+	if err != nil {
+		return 0
+	}
+	index := strings.Index(strings.ToLower(string(data)), strings.ToLower(needle))
+	if index < 0 {
+		return 0
+	}
+	return strings.Count(string(data[:index]), "\n") + 1
+}
+
+var annotationEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+
+var annotationPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+
+// writeAnnotations prints the build's warnings as GitHub Actions workflow
+// commands, which show them on the lines of the pull request diff they are
+// about. Strict builds report them as errors, as they do the files the
+// build failed on.
+func writeAnnotations(strict bool) {
+	for _, warning := range loggedWarnings() {
+		level := "warning"
+		if strict || warning.failed {
+			level = "error"
+		}
+		var properties []string
+		if warning.file != "" {
+			properties = append(properties, "file="+annotationPropertyEscaper.Replace(warning.file))
+		}
+		if warning.line > 0 {
+			properties = append(properties, fmt.Sprintf("line=%d", warning.line))
+		}
+		command := "::" + level
+		if len(properties) > 0 {
+			command += " " + strings.Join(properties, ",")
+		}
+		fmt.Printf("%s::%s\n", command, annotationEscaper.Replace(warning.message))
+	}
+}
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver struct {
+		Name           string `json:"name"`
+		InformationURI string `json:"informationUri"`
+	} `json:"driver"`
+}
+
+type sarifResult struct {
+	Level   string `json:"level"`
+	Message struct {
+		Text string `json:"text"`
+	} `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region *sarifRegion `json:"region,omitempty"`
+	} `json:"physicalLocation"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// writeSARIF writes the build's warnings to file as a SARIF log, which code
+// scanning tools show on the lines they are about.
+func writeSARIF(file string, strict bool) {
+	run := sarifRun{Results: []sarifResult{}}
+	run.Tool.Driver.Name = "grafe"
+	run.Tool.Driver.InformationURI = "https://github.com/ellifteria/grafe"
+	for _, warning := range loggedWarnings() {
+		result := sarifResult{Level: "warning"}
+		if strict || warning.failed {
+			result.Level = "error"
+		}
+		result.Message.Text = warning.message
+		if warning.file != "" {
+			var location sarifLocation
+			location.PhysicalLocation.ArtifactLocation.URI = warning.file
+			if warning.line > 0 {
+				location.PhysicalLocation.Region = &sarifRegion{StartLine: warning.line}
+			}
+			result.Locations = []sarifLocation{location}
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	data, err := json.MarshalIndent(sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs:    []sarifRun{run},
+	}, "", "  ")
+	check(err)
+	check(os.WriteFile(file, append(data, '\n'), 0666))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+type apiConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path"`
+}
+
+type apiPageSummary struct {
+	Title      string    `json:"title"`
+	URL        string    `json:"url"`
+	API        string    `json:"api"`
+	Date       time.Time `json:"date"`
+	Section    string    `json:"section"`
+	Summary    string    `json:"summary"`
+	Tags       []string  `json:"tags"`
+	Categories []string  `json:"categories"`
+	IsList     bool      `json:"isList"`
+}
+
+type apiPage struct {
+	apiPageSummary
+	FrontMatter map[string]interface{} `json:"frontMatter"`
+	HTML        string                 `json:"html"`
+}
+
+// apiPath returns the site path of the JSON endpoint of the page written to
+// outputPath: `public/blog/post.html` is served at `<api>/blog/post.json`.
+func apiPath(directory string, outputPath string) string {
+	return directory + "/" + changeExtension(strings.TrimPrefix(outputPath, outputDirectory+"/"), ".json")
+}
+
+// writeContentAPI writes a static JSON API of the site: `pages.json`
+// listing every page and its metadata, and an endpoint per page with its
+// front matter and rendered HTML as well.
+func (b *builder) writeContentAPI(site *Site) {
+	config := b.settings.API
+	if !config.Enabled {
+		return
+	}
+	directory := strings.Trim(config.Path, "/")
+	if directory == "" {
+		directory = "api"
+	}
+
+	summaries := []apiPageSummary{}
+	for _, page := range append(append([]*Page{}, site.Pages...), site.ListPages...) {
+		endpoint := apiPath(directory, page.OutputPath)
+		summary := apiPageSummary{
+			Title:      page.Title,
+			URL:        page.RelPermalink,
+			API:        b.settings.sitePath(endpoint),
+			Date:       page.Date,
+			Section:    page.Section,
+			Summary:    page.Summary,
+			Tags:       append([]string{}, page.Tags...),
+			Categories: append([]string{}, page.Categories...),
+			IsList:     page.IsList,
+		}
+		summaries = append(summaries, summary)
+
+		frontMatter := page.metaData
+		if frontMatter == nil {
+			frontMatter = map[string]interface{}{}
+		}
+		data, err := json.Marshal(apiPage{
+			apiPageSummary: summary,
+			FrontMatter:    frontMatter,
+			HTML:           string(page.Body),
+		})
+		check(err)
+		b.writeOutput(outputDirectory+"/"+endpoint, data)
+	}
+
+	data, err := json.Marshal(summaries)
+	check(err)
+	b.writeOutput(outputDirectory+"/"+directory+"/pages.json", data)
+}
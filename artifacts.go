@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const artifactKeyVariable = "GRAFE_CACHE_KEY"
+
+// artifactStore holds the intermediate files and cache entries grafe keeps
+// between and during builds. When GRAFE_CACHE_KEY is set, every file is
+// sealed with AES-256-GCM so that shared CI cache storage never holds draft
+// content in plain text. The key is used as it is, so it must be 32 random
+// bytes rather than a passphrase.
+type artifactStore struct {
+	directory string
+	aead      cipher.AEAD
+}
+
+func newArtifactStore(directory string) *artifactStore {
+	store := &artifactStore{directory: directory}
+
+	text := os.Getenv(artifactKeyVariable)
+	if text == "" {
+		return store
+	}
+
+	key, err := parseArtifactKey(text)
+	if err != nil {
+		log.Fatalf("%s %v\n", artifactKeyVariable, err)
+	}
+	block, err := aes.NewCipher(key)
+	check(err)
+	store.aead, err = cipher.NewGCM(block)
+	check(err)
+
+	return store
+}
+
+// parseArtifactKey decodes the base64 of an AES-256 key.
+func parseArtifactKey(text string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+	if err != nil {
+		return nil, errors.New("is not base64; make a key with `openssl rand -base64 32`")
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("holds %d bytes, not 32; make a key with `openssl rand -base64 32`", len(key))
+	}
+	return key, nil
+}
+
+func (store *artifactStore) path(name string) string {
+	return filepath.Join(store.directory, filepath.FromSlash(name))
+}
+
+func (store *artifactStore) WriteFile(name string, data []byte) error {
+	if store.aead != nil {
+		nonce := make([]byte, store.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		data = store.aead.Seal(nonce, nonce, data, []byte(name))
+	}
+
+	path := store.path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0770); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0660)
+}
+
+func (store *artifactStore) ReadFile(name string) ([]byte, error) {
+	data, err := os.ReadFile(store.path(name))
+	if err != nil || store.aead == nil {
+		return data, err
+	}
+
+	nonceSize := store.aead.NonceSize()
+	if len(data) < nonceSize {
+		return nil, errors.New("artifact " + name + " is truncated")
+	}
+	data, err = store.aead.Open(nil, data[:nonceSize], data[nonceSize:], []byte(name))
+	if err != nil {
+		return nil, errors.New("artifact " + name + " cannot be decrypted; was it written with a different " + artifactKeyVariable + "?")
+	}
+	return data, nil
+}
+
+// Glob returns the names of the stored artifacts matching pattern, relative
+// to the store directory.
+func (store *artifactStore) Glob(pattern string) ([]string, error) {
+	matches, err := filepath.Glob(store.path(pattern))
+	if err != nil {
+		return nil, err
+	}
+	for i, match := range matches {
+		matches[i] = filepath.ToSlash(strings.TrimPrefix(match, store.directory+string(filepath.Separator)))
+	}
+	return matches, nil
+}
+
+func (store *artifactStore) CopyDirectory(directoryToCopy string, prefix string) {
+	walk(directoryToCopy, func(fileName string) {
+		data, err := os.ReadFile(fileName)
+		check(err)
+		err = store.WriteFile(prefix+strings.TrimPrefix(fileName, directoryToCopy), data)
+		check(err)
+	})
+}
+
+func (store *artifactStore) Prune() {
+	pruneDirectory(store.directory)
+}
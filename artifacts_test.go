@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testArtifactKey = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+
+func TestParseArtifactKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string
+	}{
+		{"key", testArtifactKey, ""},
+		{"trailing newline", testArtifactKey + "\n", ""},
+		{"passphrase", "correct horse battery staple", "is not base64"},
+		{"short", base64.StdEncoding.EncodeToString([]byte("sixteen byte key")), "holds 16 bytes, not 32"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := parseArtifactKey(test.text)
+			if test.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), test.wantErr) {
+					t.Errorf("parseArtifactKey gave %x, %v, want an error starting %q", key, err, test.wantErr)
+				}
+				return
+			}
+			if err != nil || !bytes.Equal(key, bytes.Repeat([]byte{1}, 32)) {
+				t.Errorf("parseArtifactKey gave %x, %v", key, err)
+			}
+		})
+	}
+}
+
+func TestArtifactStoreRoundTrip(t *testing.T) {
+	secret := []byte("---\ntitle: Draft\ndraft: true\n---\nNot yet.\n")
+	tests := []struct {
+		name   string
+		key    string
+		sealed bool
+	}{
+		{"plain", "", false},
+		{"sealed", testArtifactKey, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(artifactKeyVariable, test.key)
+			directory := t.TempDir()
+			store := newArtifactStore(directory)
+
+			if err := store.WriteFile("pages/draft.md", secret); err != nil {
+				t.Fatal(err)
+			}
+			got, err := store.ReadFile("pages/draft.md")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, secret) {
+				t.Errorf("read back %q, want %q", got, secret)
+			}
+
+			stored, err := os.ReadFile(filepath.Join(directory, "pages", "draft.md"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sealed := !bytes.Contains(stored, []byte("Not yet.")); sealed != test.sealed {
+				t.Errorf("stored file is %q, want sealed %v", stored, test.sealed)
+			}
+
+			names, err := store.Glob("pages/*.md")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(names, " ") != "pages/draft.md" {
+				t.Errorf("Glob found %v, want [pages/draft.md]", names)
+			}
+		})
+	}
+}
+
+func TestArtifactStoreRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(t *testing.T, directory string)
+		want  string
+	}{
+		{
+			name: "different key",
+			write: func(t *testing.T, directory string) {
+				t.Setenv(artifactKeyVariable, base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32)))
+				if err := newArtifactStore(directory).WriteFile("cache", []byte("data")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "artifact cache cannot be decrypted",
+		},
+		{
+			name: "written in plain text",
+			write: func(t *testing.T, directory string) {
+				t.Setenv(artifactKeyVariable, "")
+				if err := newArtifactStore(directory).WriteFile("cache", []byte("a long enough plain text cache")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "artifact cache cannot be decrypted",
+		},
+		{
+			name: "renamed",
+			write: func(t *testing.T, directory string) {
+				if err := newArtifactStore(directory).WriteFile("other", []byte("data")); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Rename(filepath.Join(directory, "other"), filepath.Join(directory, "cache")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "artifact cache cannot be decrypted",
+		},
+		{
+			name: "truncated",
+			write: func(t *testing.T, directory string) {
+				if err := os.WriteFile(filepath.Join(directory, "cache"), []byte("short"), 0660); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "artifact cache is truncated",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			directory := t.TempDir()
+			t.Setenv(artifactKeyVariable, testArtifactKey)
+			test.write(t, directory)
+
+			t.Setenv(artifactKeyVariable, testArtifactKey)
+			data, err := newArtifactStore(directory).ReadFile("cache")
+			if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+				t.Errorf("ReadFile gave %q, %v, want an error starting %q", data, err, test.want)
+			}
+		})
+	}
+}
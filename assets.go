@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// assetRequirement is a script or stylesheet a page needs, declared by a
+// shortcode or in front matter.
+type assetRequirement struct {
+	Kind     string `yaml:"-"`
+	Src      string `yaml:"src"`
+	Position string `yaml:"position"`
+	Order    int    `yaml:"order"`
+	Module   bool   `yaml:"module"`
+	Defer    bool   `yaml:"defer"`
+	Async    bool   `yaml:"async"`
+	Consent  string `yaml:"consent"`
+}
+
+// pageAssets collects the scripts and stylesheets of a page, each once, so
+// that a page embedding ten diagrams loads the diagram library once.
+type pageAssets struct {
+	requirements []assetRequirement
+	seen         map[string]bool
+}
+
+func newPageAssets() *pageAssets {
+	return &pageAssets{seen: make(map[string]bool)}
+}
+
+func (assets *pageAssets) add(requirement assetRequirement) {
+	if assets == nil || requirement.Src == "" || assets.seen[requirement.Kind+" "+requirement.Src] {
+		return
+	}
+	if requirement.Position == "" {
+		requirement.Position = "footer"
+		if requirement.Kind == "style" {
+			requirement.Position = "head"
+		}
+	}
+	assets.seen[requirement.Kind+" "+requirement.Src] = true
+	assets.requirements = append(assets.requirements, requirement)
+}
+
+// parseAssetOptions reads the options shortcodes give after an asset's URL:
+// `head` or `footer`, `module`, `defer`, `async`, `order=N`, and, for
+// scripts, `consent=category`.
+func parseAssetOptions(kind string, src string, options []string) (assetRequirement, error) {
+	requirement := assetRequirement{Kind: kind, Src: src}
+	for _, option := range options {
+		switch {
+		case option == "head" || option == "footer":
+			requirement.Position = option
+		case option == "module":
+			requirement.Module = true
+		case option == "defer":
+			requirement.Defer = true
+		case option == "async":
+			requirement.Async = true
+		case strings.HasPrefix(option, "order="):
+			order, err := strconv.Atoi(strings.TrimPrefix(option, "order="))
+			if err != nil {
+				return requirement, fmt.Errorf("order must be a number, not %q", option)
+			}
+			requirement.Order = order
+		case strings.HasPrefix(option, "consent=") && kind == "script":
+			requirement.Consent = strings.TrimPrefix(option, "consent=")
+		default:
+			return requirement, fmt.Errorf("unknown %s option %q", kind, option)
+		}
+	}
+	return requirement, nil
+}
+
+// addFrontMatterAssets adds the `scripts` and `styles` listed in front
+// matter, given as URLs or as maps with a `src` and the options.
+func (assets *pageAssets) addFrontMatterAssets(metaData map[string]interface{}, sourcePath string) {
+	for _, kind := range []string{"script", "style"} {
+		value := frontMatterValue(metaData, kind+"s")
+		if value == nil {
+			continue
+		}
+		entries, ok := value.([]interface{})
+		if !ok {
+			warnAt(sourcePath, sourceLine(sourcePath, kind+"s:"), "%ss should be a list, not %T; ignoring it", kind, value)
+			continue
+		}
+		for _, entry := range entries {
+			requirement := assetRequirement{Kind: kind}
+			if src, ok := entry.(string); ok {
+				requirement.Src = src
+			} else {
+				data, err := yaml.Marshal(entry)
+				check(err)
+				if err := yaml.UnmarshalStrict(data, &requirement); err != nil {
+					warnAt(sourcePath, sourceLine(sourcePath, kind+"s:"), "%ss: %v; ignoring it", kind, err)
+					continue
+				}
+			}
+			assets.add(requirement)
+		}
+	}
+}
+
+func (requirement assetRequirement) tag() string {
+	src := html.EscapeString(requirement.Src)
+	if requirement.Kind == "style" {
+		return fmt.Sprintf(`<link rel="stylesheet" href="%s">`, src)
+	}
+	if requirement.Consent != "" {
+		return consentPlaceholder(requirement)
+	}
+	attributes := ""
+	if requirement.Module {
+		attributes += ` type="module"`
+	}
+	if requirement.Defer {
+		attributes += " defer"
+	}
+	if requirement.Async {
+		attributes += " async"
+	}
+	return fmt.Sprintf(`<script src="%s"%s></script>`, src, attributes)
+}
+
+// tags renders the assets at position by ascending order, then in the
+// order they were first required, stylesheets ahead of scripts.
+func (assets *pageAssets) tags(position string) template.HTML {
+	if assets == nil {
+		return ""
+	}
+	var requirements []assetRequirement
+	for _, requirement := range assets.requirements {
+		if requirement.Position == position {
+			requirements = append(requirements, requirement)
+		}
+	}
+	sort.SliceStable(requirements, func(i, j int) bool {
+		if requirements[i].Order != requirements[j].Order {
+			return requirements[i].Order < requirements[j].Order
+		}
+		return requirements[i].Kind == "style" && requirements[j].Kind != "style"
+	})
+
+	tags := make([]string, len(requirements))
+	for i, requirement := range requirements {
+		tags[i] = requirement.tag()
+	}
+	return template.HTML(strings.Join(tags, "\n"))
+}
+
+// Script declares, from a shortcode template, that the page needs a
+// script: `{{ .Script "/js/mermaid.js" "defer" }}`.
+func (call shortcodeCall) Script(src string, options ...string) (string, error) {
+	requirement, err := parseAssetOptions("script", src, options)
+	call.assets.add(requirement)
+	return "", err
+}
+
+// Style declares that the page needs a stylesheet.
+func (call shortcodeCall) Style(src string, options ...string) (string, error) {
+	requirement, err := parseAssetOptions("style", src, options)
+	call.assets.add(requirement)
+	return "", err
+}
+
+// HeadAssets renders the stylesheets and scripts the page needs in <head>.
+func (page *Page) HeadAssets() template.HTML {
+	return page.assets.tags("head")
+}
+
+// FooterAssets renders the scripts the page needs before </body>.
+func (page *Page) FooterAssets() template.HTML {
+	return page.assets.tags("footer")
+}
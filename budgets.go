@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// budgetsConfig limits the weight of every page: its HTML and the
+// stylesheets, scripts, images, and fonts it loads, as sent compressed. The
+// budget of a page in one of Sections is that section's, and Default
+// otherwise. Pages over budget are warned about, or fail the build with
+// Fail.
+type budgetsConfig struct {
+	Default  string            `yaml:"default"`
+	Sections map[string]string `yaml:"sections"`
+	Fail     bool              `yaml:"fail"`
+}
+
+// parseByteSize reads a size such as `500KB`, `1.5MB`, or a number of bytes.
+func parseByteSize(size string) (int64, error) {
+	size = strings.ToUpper(strings.TrimSpace(size))
+	multiplier := 1.0
+	for _, unit := range []struct {
+		suffix     string
+		multiplier float64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(size, unit.suffix) {
+			size, multiplier = strings.TrimSpace(strings.TrimSuffix(size, unit.suffix)), unit.multiplier
+			break
+		}
+	}
+	number, err := strconv.ParseFloat(size, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("%q is not a size such as 500KB", size)
+	}
+	return int64(number * multiplier), nil
+}
+
+func formatByteSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", size)
+}
+
+// budget returns the budget of pages in section, or 0 for none.
+func (config budgetsConfig) budget(section string) int64 {
+	name, size := "budgets.default", config.Default
+	if sectionSize, ok := config.Sections[section]; ok {
+		name, size = "budgets.sections."+section, sectionSize
+	}
+	if size == "" {
+		return 0
+	}
+	budget, err := parseByteSize(size)
+	if err != nil {
+		log.Fatalf("%s: %v\n", name, err)
+	}
+	return budget
+}
+
+// pageWeight is what a page weighs by kind of file.
+type pageWeight struct {
+	file    string
+	section string
+	budget  int64
+	html    int64
+	css     int64
+	js      int64
+	images  int64
+	other   int64
+}
+
+func (weight pageWeight) total() int64 {
+	return weight.html + weight.css + weight.js + weight.images + weight.other
+}
+
+// transferSizes measures files as they are sent: text gzip-compressed as
+// the production server does, and other files, which are compressed
+// already, as they are.
+type transferSizes map[string]int64
+
+func (sizes transferSizes) size(file string) int64 {
+	if size, ok := sizes[file]; ok {
+		return size
+	}
+	data, err := os.ReadFile(file)
+	check(err)
+	size := int64(len(data))
+	switch strings.ToLower(path.Ext(file)) {
+	case ".html", ".css", ".js", ".mjs", ".svg", ".json", ".xml", ".txt":
+		var buf bytes.Buffer
+		writer, err := gzip.NewWriterLevel(&buf, gzip.DefaultCompression)
+		check(err)
+		_, err = writer.Write(data)
+		check(err)
+		check(writer.Close())
+		size = int64(buf.Len())
+	}
+	sizes[file] = size
+	return size
+}
+
+// pageResources lists the files the page at file loads: its stylesheets,
+// with the files they refer to, scripts, and images. Each is listed once.
+func pageResources(document *html.Node, file string, resolver exportResolver) []string {
+	var resources []string
+	seen := make(map[string]bool)
+	var add func(resource string)
+	add = func(resource string) {
+		if resource == "" || seen[resource] {
+			return
+		}
+		seen[resource] = true
+		resources = append(resources, resource)
+		if strings.ToLower(path.Ext(resource)) == ".css" {
+			css, err := os.ReadFile(resource)
+			check(err)
+			for _, match := range cssAnyURLPattern.FindAllStringSubmatch(string(css), -1) {
+				add(resolver.file(match[2], resource))
+			}
+		}
+	}
+	addCSS := func(css string) {
+		for _, match := range cssAnyURLPattern.FindAllStringSubmatch(css, -1) {
+			add(resolver.file(match[2], file))
+		}
+	}
+
+	var visit func(node *html.Node)
+	visit = func(node *html.Node) {
+		if node.Type == html.ElementNode {
+			switch node.DataAtom {
+			case atom.Link:
+				rel := nodeAttribute(node, "rel")
+				if strings.Contains(rel, "stylesheet") || strings.Contains(rel, "preload") {
+					add(resolver.file(nodeAttribute(node, "href"), file))
+				}
+			case atom.Script:
+				add(resolver.file(nodeAttribute(node, "src"), file))
+			case atom.Img, atom.Video, atom.Audio:
+				// Of an image's sources, only the one a browser picks is
+				// loaded; src stands for it.
+				add(resolver.file(nodeAttribute(node, "src"), file))
+				add(resolver.file(nodeAttribute(node, "poster"), file))
+			case atom.Style:
+				if node.FirstChild != nil {
+					addCSS(node.FirstChild.Data)
+				}
+			}
+			addCSS(nodeAttribute(node, "style"))
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			visit(child)
+		}
+	}
+	visit(document)
+	return resources
+}
+
+// measurePages weighs every HTML page of the output and warns about those
+// over their section's budget, or with budgets.fail fails them, returning
+// the weights.
+func measurePages(settings siteConfig) []pageWeight {
+	resolver := exportResolver{directory: outputDirectory, basePath: settings.BasePath}
+	sizes := make(transferSizes)
+	var weights []pageWeight
+	walk(outputDirectory, func(file string) {
+		if getExtension(file) != ".html" {
+			return
+		}
+		data, err := os.ReadFile(file)
+		check(err)
+		document, err := html.Parse(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+
+		name := strings.TrimPrefix(file, outputDirectory+"/")
+		section, _, ok := strings.Cut(name, "/")
+		if !ok {
+			section = ""
+		}
+		weight := pageWeight{file: name, section: section, budget: settings.Budgets.budget(section), html: sizes.size(file)}
+		for _, resource := range pageResources(document, file, resolver) {
+			size := sizes.size(resource)
+			switch strings.ToLower(path.Ext(resource)) {
+			case ".css":
+				weight.css += size
+			case ".js", ".mjs":
+				weight.js += size
+			case ".png", ".jpg", ".jpeg", ".gif", ".webp", ".avif", ".svg", ".ico":
+				weight.images += size
+			default:
+				weight.other += size
+			}
+		}
+		if weight.budget > 0 && weight.total() > weight.budget {
+			message := fmt.Sprintf("weighs %s, over the %s budget by %s (HTML %s, CSS %s, JavaScript %s, images %s, other %s)",
+				formatByteSize(weight.total()), formatByteSize(weight.budget), formatByteSize(weight.total()-weight.budget),
+				formatByteSize(weight.html), formatByteSize(weight.css), formatByteSize(weight.js), formatByteSize(weight.images), formatByteSize(weight.other))
+			if settings.Budgets.Fail {
+				guardFile(func() { failAt(file, 0, "%s", message) })
+			} else {
+				warnAt(file, 0, "%s", message)
+			}
+		}
+		weights = append(weights, weight)
+	})
+	return weights
+}
+
+// writeSizeReport lists the weight of every page, heaviest first, for
+// `-size-report`.
+func writeSizeReport(w io.Writer, weights []pageWeight) {
+	sort.SliceStable(weights, func(i, j int) bool {
+		return weights[i].total() > weights[j].total()
+	})
+
+	fmt.Fprintf(w, "%-48s %9s %9s %9s %9s %9s %9s %9s\n", "page", "html", "css", "js", "images", "other", "total", "budget")
+	for _, weight := range weights {
+		budget := "-"
+		if weight.budget > 0 {
+			budget = formatByteSize(weight.budget)
+		}
+		fmt.Fprintf(w, "%-48s %9s %9s %9s %9s %9s %9s %9s\n", weight.file,
+			formatByteSize(weight.html), formatByteSize(weight.css), formatByteSize(weight.js), formatByteSize(weight.images), formatByteSize(weight.other),
+			formatByteSize(weight.total()), budget)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// calendarEntry is a dated page in the content calendar.
+type calendarEntry struct {
+	Title     string    `json:"title"`
+	Date      time.Time `json:"date"`
+	URL       string    `json:"url"`
+	Source    string    `json:"source"`
+	Status    string    `json:"status"`
+	Owner     string    `json:"owner,omitempty"`
+	Scheduled bool      `json:"scheduled"`
+}
+
+// contentCalendar returns the pages dated between months before and months
+// after now, oldest first. Pages dated after now are scheduled.
+func (b *builder) contentCalendar(now time.Time, months int) []calendarEntry {
+	from, to := now.AddDate(0, -months, 0), now.AddDate(0, months, 0)
+
+	var entries []calendarEntry
+	b.eachFrontMatter(func(sourcePath string, metaData map[string]interface{}) {
+		contentPath := strings.TrimPrefix(sourcePath, contentDirectory+"/")
+		pathInfo := b.settings.parseContentPath(contentPath)
+		if pathInfo.isList {
+			return
+		}
+		date, err := parseFrontMatterDate(frontMatterValue(metaData, "date"), b.settings.location)
+		if err != nil {
+			failAt(sourcePath, sourceLine(sourcePath, "date:"), "date: %v", err)
+		}
+		if date.IsZero() && !pathInfo.date.IsZero() {
+			date = time.Date(pathInfo.date.Year(), pathInfo.date.Month(), pathInfo.date.Day(), 0, 0, 0, 0, b.settings.location)
+		}
+		if date.IsZero() || date.Before(from) || date.After(to) {
+			return
+		}
+
+		title := frontMatterString(metaData, "title")
+		if title == "" {
+			title = path.Base(removeExtension(contentPath))
+		}
+		entries = append(entries, calendarEntry{
+			Title:     title,
+			Date:      date,
+			URL:       b.settings.siteURL(b.settings.pageURL(pathInfo.outputPath)),
+			Source:    sourcePath,
+			Status:    pageStatus(metaData, sourcePath),
+			Owner:     frontMatterString(metaData, "owner"),
+			Scheduled: date.After(now),
+		})
+	})
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Date.Before(entries[j].Date)
+	})
+	return entries
+}
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+// writeICS writes entries as an iCalendar file with one all-day event per
+// page, so that editorial calendars can subscribe to it.
+func writeICS(w io.Writer, entries []calendarEntry, now time.Time) error {
+	lines := []string{"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//grafe//content calendar//EN", "CALSCALE:GREGORIAN"}
+	for _, entry := range entries {
+		description := entry.Status
+		if entry.Owner != "" {
+			description += ", owned by " + entry.Owner
+		}
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+icsEscaper.Replace(entry.Source)+"@grafe",
+			"DTSTAMP:"+now.UTC().Format("20060102T150405Z"),
+			"DTSTART;VALUE=DATE:"+entry.Date.Format("20060102"),
+			"SUMMARY:"+icsEscaper.Replace(entry.Title),
+			"DESCRIPTION:"+icsEscaper.Replace(description),
+			"URL:"+entry.URL,
+			"END:VEVENT",
+		)
+	}
+	lines = append(lines, "END:VCALENDAR")
+	for i, line := range lines {
+		lines[i] = foldICSLine(line)
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\r\n")+"\r\n")
+	return err
+}
+
+// foldICSLine splits line into lines of at most 75 bytes, as iCalendar
+// requires, without splitting a UTF-8 character.
+func foldICSLine(line string) string {
+	var folded strings.Builder
+	length := 0
+	for _, r := range line {
+		size := utf8.RuneLen(r)
+		if length+size > 75 {
+			folded.WriteString("\r\n ")
+			length = 1
+		}
+		folded.WriteRune(r)
+		length += size
+	}
+	return folded.String()
+}
+
+// calendarCommand writes the scheduled and recently published pages as JSON
+// or iCalendar for editorial planning tools.
+func calendarCommand(project projectConfig, args []string) {
+	flags := flag.NewFlagSet("grafe calendar", flag.ExitOnError)
+	monthsPtr := flags.Int("months", 3, "Include pages dated up to this many months before and after today.")
+	formatPtr := flags.String("format", "", "Write `json` or `ics`; defaults to the extension of `-o`, or json.")
+	outputPtr := flags.String("o", "", "File to write the calendar to; defaults to standard output.")
+	parseCommandFlagsOnly(flags, args)
+
+	format := *formatPtr
+	if format == "" {
+		format = "json"
+		if path.Ext(*outputPtr) == ".ics" {
+			format = "ics"
+		}
+	}
+	if format != "json" && format != "ics" {
+		log.Fatalf("-format must be json or ics, not %q.\n", format)
+	}
+
+	_, settings := readSiteConfig(project)
+	b := &builder{settings: settings}
+	now := settings.now()
+	entries := b.contentCalendar(now, *monthsPtr)
+	checkErrors(false)
+
+	var w io.Writer = os.Stdout
+	if *outputPtr != "" {
+		file, err := os.Create(*outputPtr)
+		check(err)
+		defer file.Close()
+		w = file
+	}
+
+	if format == "ics" {
+		check(writeICS(w, entries, now))
+		return
+	}
+	if entries == nil {
+		entries = []calendarEntry{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	check(encoder.Encode(entries))
+	if *outputPtr != "" {
+		fmt.Printf("Wrote %d pages to %s\n", len(entries), *outputPtr)
+	}
+}
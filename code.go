@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var codeLanguages = map[string]string{
+	".c":    "c",
+	".h":    "c",
+	".js":   "javascript",
+	".md":   "markdown",
+	".py":   "python",
+	".rb":   "ruby",
+	".rs":   "rust",
+	".sh":   "bash",
+	".ts":   "typescript",
+	".yml":  "yaml",
+	".yaml": "yaml",
+}
+
+// codeFilePath resolves the file a code shortcode in the content file at
+// sourcePath includes: relative paths from the content file's directory,
+// root-relative ones from the site's directory.
+func codeFilePath(file string, sourcePath string) string {
+	if strings.HasPrefix(file, "/") {
+		return filepath.FromSlash(strings.TrimPrefix(file, "/"))
+	}
+	return filepath.Join(filepath.Dir(sourcePath), filepath.FromSlash(file))
+}
+
+// lineRange parses a `lines` argument, `10-42`, `10-`, or `10`, into the
+// first and last line it covers, counting from 1, within a file of count
+// lines.
+func lineRange(lines string, count int) (int, int, error) {
+	if lines == "" {
+		return 1, count, nil
+	}
+	startText, endText, isRange := strings.Cut(lines, "-")
+	start, err := strconv.Atoi(strings.TrimSpace(startText))
+	if err != nil {
+		return 0, 0, fmt.Errorf("lines must be a line number or a range such as 10-42, not %q", lines)
+	}
+	end := start
+	if isRange {
+		end = count
+		if endText = strings.TrimSpace(endText); endText != "" {
+			end, err = strconv.Atoi(endText)
+			if err != nil {
+				return 0, 0, fmt.Errorf("lines must be a line number or a range such as 10-42, not %q", lines)
+			}
+		}
+	}
+	if start < 1 || end < start || end > count {
+		return 0, 0, fmt.Errorf("lines %s are outside the file's %d lines", lines, count)
+	}
+	return start, end, nil
+}
+
+var snippetMarkerPattern = regexp.MustCompile(`^\s*(?://|#|--|;|/\*|<!--)\s*(BEGIN|END)\s+([\w.-]+)`)
+
+// snippetRange finds the lines between the `BEGIN name` and `END name`
+// comments in a file, returning the first and last of them, counting from
+// 1, and their text without any snippet markers.
+func snippetRange(lines []string, name string) (int, int, []string, error) {
+	start := 0
+	var snippet []string
+	for i, line := range lines {
+		match := snippetMarkerPattern.FindStringSubmatch(line)
+		switch {
+		case match != nil && match[2] == name && match[1] == "BEGIN":
+			start = i + 2
+		case match != nil && match[2] == name && match[1] == "END":
+			if start == 0 {
+				return 0, 0, nil, fmt.Errorf("snippet %q ends before it begins", name)
+			}
+			return start, i, snippet, nil
+		case start > 0 && match == nil:
+			snippet = append(snippet, line)
+		}
+	}
+	if start > 0 {
+		return 0, 0, nil, fmt.Errorf("snippet %q has no END marker", name)
+	}
+	return 0, 0, nil, fmt.Errorf("no snippet %q exists", name)
+}
+
+// dedent removes the indentation shared by every non-blank line.
+func dedent(lines []string) []string {
+	prefix := ""
+	first := true
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indentation := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			prefix, first = indentation, false
+			continue
+		}
+		for !strings.HasPrefix(indentation, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	dedented := make([]string, len(lines))
+	for i, line := range lines {
+		dedented[i] = strings.TrimPrefix(line, prefix)
+	}
+	return dedented
+}
+
+// codeBlock renders code the way fenced code blocks are rendered, so that
+// the site's highlighting applies to it, linking to link when given.
+func codeBlock(code string, language string, file string, start int, link string, highlight *highlightConfig) string {
+	var out strings.Builder
+	if link != "" {
+		out.WriteString(`<figure class="code">`)
+	}
+	highlighted, ok := "", false
+	if highlight != nil {
+		highlighted, ok = highlight.highlight(code, language, start)
+	}
+	if ok {
+		out.WriteString(highlighted)
+	} else {
+		out.WriteString("<pre><code")
+		if language != "" {
+			fmt.Fprintf(&out, ` class="language-%s"`, html.EscapeString(language))
+		}
+		fmt.Fprintf(&out, ` data-file="%s" data-line-start="%d">%s</code></pre>`, html.EscapeString(file), start, html.EscapeString(code))
+	}
+	if link != "" {
+		fmt.Fprintf(&out, `<figcaption><a href="%s">View source</a></figcaption></figure>`, html.EscapeString(link))
+	}
+	return out.String()
+}
+
+// codeShortcode renders
+//
+//	{{< code file="../../src/main.go" lang="go" lines="10-42" link="https://..." >}}
+//
+// as a code block holding the given lines of a file outside the content
+// directory, so that documentation shows the code as it is. Instead of
+// lines, `snippet` names a region marked with `BEGIN name` and `END name`
+// comments, and the build fails once the region is gone. The language
+// defaults to the file's extension; GitHub-style `#L10-L42` anchors are
+// added to links without a fragment.
+func codeShortcode(call shortcodeCall) (string, error) {
+	file := call.ArgOr("file", strings.Join(call.Positional, ""))
+	if file == "" {
+		return "", fmt.Errorf("missing file")
+	}
+
+	data, err := os.ReadFile(codeFilePath(file, call.SourcePath))
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(strings.TrimSuffix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n"), "\n")
+	var start, end int
+	if name := call.Arg("snippet"); name != "" {
+		start, end, lines, err = snippetRange(lines, name)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", file, err)
+		}
+	} else {
+		start, end, err = lineRange(call.Arg("lines"), len(lines))
+		if err != nil {
+			return "", err
+		}
+		lines = lines[start-1 : end]
+	}
+
+	extension := strings.ToLower(filepath.Ext(file))
+	language := call.ArgOr("lang", codeLanguages[extension])
+	if language == "" {
+		language = strings.TrimPrefix(extension, ".")
+	}
+
+	link := call.Arg("link")
+	if link != "" && (call.Arg("lines") != "" || call.Arg("snippet") != "") && !strings.Contains(link, "#") {
+		link += fmt.Sprintf("#L%d-L%d", start, end)
+	}
+
+	code := strings.Join(dedent(lines), "\n") + "\n"
+	var highlight *highlightConfig
+	if call.settings != nil {
+		highlight = call.settings.Markdown.Highlight
+	}
+	return codeBlock(code, language, file, start, link, highlight), nil
+}
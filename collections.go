@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+type collectionGroup struct {
+	Key   interface{}
+	Pages interface{}
+}
+
+func (page *Page) Year() int {
+	return page.Date.Year()
+}
+
+func (page *Page) Month() time.Month {
+	return page.Date.Month()
+}
+
+func indirect(value reflect.Value) reflect.Value {
+	for value.IsValid() && (value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface) {
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+		value = value.Elem()
+	}
+	return value
+}
+
+// fieldValue resolves a dotted key such as "Date.Year" or "Params.series"
+// against item, trying methods, struct fields, and map keys (ignoring
+// case) at each step.
+func fieldValue(item interface{}, key string) (interface{}, bool) {
+	value := reflect.ValueOf(item)
+	for _, part := range strings.Split(key, ".") {
+		if !value.IsValid() {
+			return nil, false
+		}
+		if method := value.MethodByName(part); method.IsValid() && method.Type().NumIn() == 0 && method.Type().NumOut() >= 1 {
+			value = method.Call(nil)[0]
+			continue
+		}
+
+		current := indirect(value)
+		switch current.Kind() {
+		case reflect.Struct:
+			if method := current.MethodByName(part); method.IsValid() && method.Type().NumIn() == 0 && method.Type().NumOut() >= 1 {
+				value = method.Call(nil)[0]
+				continue
+			}
+			field := current.FieldByName(part)
+			if !field.IsValid() || !field.CanInterface() {
+				return nil, false
+			}
+			value = field
+		case reflect.Map:
+			found, ok := lookupParam(current.Interface(), part)
+			if !ok {
+				return nil, false
+			}
+			value = reflect.ValueOf(found)
+		default:
+			return nil, false
+		}
+	}
+	if !value.IsValid() {
+		return nil, true
+	}
+	return value.Interface(), true
+}
+
+func collectionValue(collection interface{}) (reflect.Value, error) {
+	value := indirect(reflect.ValueOf(collection))
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return reflect.Value{}, fmt.Errorf("expected a list of items, got %T", collection)
+	}
+	return value, nil
+}
+
+// compareValues orders a and b as times, numbers, or strings, whichever
+// both can be read as.
+func compareValues(a interface{}, b interface{}) int {
+	if aTime, ok := a.(time.Time); ok {
+		bTime, err := cast.ToTimeE(b)
+		if err == nil {
+			return aTime.Compare(bTime)
+		}
+	}
+	aNumber, aErr := cast.ToFloat64E(a)
+	bNumber, bErr := cast.ToFloat64E(b)
+	if aErr == nil && bErr == nil {
+		switch {
+		case aNumber < bNumber:
+			return -1
+		case aNumber > bNumber:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func containsValue(list interface{}, item interface{}) bool {
+	values, err := collectionValue(list)
+	if err != nil {
+		return compareValues(list, item) == 0
+	}
+	for i := 0; i < values.Len(); i++ {
+		if compareValues(values.Index(i).Interface(), item) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesCondition(value interface{}, operator string, expected interface{}) (bool, error) {
+	switch operator {
+	case "=", "==", "eq":
+		return compareValues(value, expected) == 0, nil
+	case "!=", "<>", "ne":
+		return compareValues(value, expected) != 0, nil
+	case ">", "gt":
+		return compareValues(value, expected) > 0, nil
+	case ">=", "ge":
+		return compareValues(value, expected) >= 0, nil
+	case "<", "lt":
+		return compareValues(value, expected) < 0, nil
+	case "<=", "le":
+		return compareValues(value, expected) <= 0, nil
+	case "contains":
+		return strings.Contains(strings.ToLower(fmt.Sprint(value)), strings.ToLower(fmt.Sprint(expected))), nil
+	case "in":
+		return containsValue(expected, value), nil
+	case "not in":
+		return !containsValue(expected, value), nil
+	case "intersect":
+		values, err := collectionValue(value)
+		if err != nil {
+			return false, nil
+		}
+		for i := 0; i < values.Len(); i++ {
+			if containsValue(expected, values.Index(i).Interface()) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("unknown where operator %q", operator)
+}
+
+// where returns the items of collection whose key matches:
+//
+//	where .Site.Pages "Section" "posts"
+//	where .Site.Pages "Date.Year" ">=" 2020
+//	where .Site.Pages "Tags" "intersect" (list "go" "rust")
+func where(collection interface{}, key string, args ...interface{}) (interface{}, error) {
+	values, err := collectionValue(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	operator, expected := "=", interface{}(nil)
+	switch len(args) {
+	case 1:
+		expected = args[0]
+	case 2:
+		operator, expected = fmt.Sprint(args[0]), args[1]
+	default:
+		return nil, fmt.Errorf("where takes a key and a value, optionally with an operator between them")
+	}
+
+	result := reflect.MakeSlice(reflect.SliceOf(values.Type().Elem()), 0, values.Len())
+	for i := 0; i < values.Len(); i++ {
+		value, ok := fieldValue(values.Index(i).Interface(), key)
+		if !ok {
+			continue
+		}
+		matched, err := matchesCondition(value, operator, expected)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			result = reflect.Append(result, values.Index(i))
+		}
+	}
+	return result.Interface(), nil
+}
+
+// sortCollection returns a sorted copy of collection, ordered by key
+// ("asc" or "desc"); without a key the items themselves are compared.
+func sortCollection(collection interface{}, args ...string) (interface{}, error) {
+	values, err := collectionValue(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	key, order := "", "asc"
+	if len(args) > 0 {
+		key = args[0]
+	}
+	if len(args) > 1 {
+		order = strings.ToLower(args[1])
+	}
+	if order != "asc" && order != "desc" {
+		return nil, fmt.Errorf("sort order must be asc or desc, not %q", order)
+	}
+
+	keys := make([]interface{}, values.Len())
+	for i := range keys {
+		keys[i] = values.Index(i).Interface()
+		if key != "" {
+			keys[i], _ = fieldValue(keys[i], key)
+		}
+	}
+
+	indices := make([]int, values.Len())
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.SliceStable(indices, func(i, j int) bool {
+		comparison := compareValues(keys[indices[i]], keys[indices[j]])
+		if order == "desc" {
+			return comparison > 0
+		}
+		return comparison < 0
+	})
+
+	sorted := reflect.MakeSlice(reflect.SliceOf(values.Type().Elem()), values.Len(), values.Len())
+	for position, index := range indices {
+		sorted.Index(position).Set(values.Index(index))
+	}
+	return sorted.Interface(), nil
+}
+
+// groupBy splits collection into groups of items sharing the same key, in
+// the order each key first appears.
+func groupBy(collection interface{}, key string) ([]collectionGroup, error) {
+	values, err := collectionValue(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []collectionGroup
+	var members []reflect.Value
+	positions := make(map[string]int)
+	for i := 0; i < values.Len(); i++ {
+		value, _ := fieldValue(values.Index(i).Interface(), key)
+		id := fmt.Sprint(value)
+		position, ok := positions[id]
+		if !ok {
+			position = len(groups)
+			positions[id] = position
+			groups = append(groups, collectionGroup{Key: value})
+			members = append(members, reflect.MakeSlice(reflect.SliceOf(values.Type().Elem()), 0, 1))
+		}
+		members[position] = reflect.Append(members[position], values.Index(i))
+	}
+
+	for i := range groups {
+		groups[i].Pages = members[i].Interface()
+	}
+	return groups, nil
+}
+
+// first returns the first item of a list, like sprig's `first`, or, when
+// given a count, the first count items: `first 5 .Site.Pages`.
+func first(args ...interface{}) (interface{}, error) {
+	switch len(args) {
+	case 1:
+		values, err := collectionValue(args[0])
+		if err != nil || values.Len() == 0 {
+			return nil, err
+		}
+		return values.Index(0).Interface(), nil
+	case 2:
+		count, err := cast.ToIntE(args[0])
+		if err != nil {
+			return nil, err
+		}
+		values, err := collectionValue(args[1])
+		if err != nil {
+			return nil, err
+		}
+		if count > values.Len() {
+			count = values.Len()
+		}
+		if count < 0 {
+			count = 0
+		}
+		return values.Slice(0, count).Interface(), nil
+	}
+	return nil, fmt.Errorf("first takes a list, optionally preceded by a count")
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const commentsDirectory = dataDirectory + "/comments"
+
+// commentsConfig says where readers send new comments: by email, or as an
+// issue opened at Issues, the URL of a new issue in the site's repository.
+type commentsConfig struct {
+	Email  string `yaml:"email"`
+	Issues string `yaml:"issues"`
+}
+
+// Comment is a reader's comment on a page, kept as a YAML file with an
+// `author`, a Markdown `body`, and optionally a `date` and the author's
+// `url` in `data/comments/<page>/`. Comments are moderated by deciding
+// which files to add.
+type Comment struct {
+	ID     string
+	Author string
+	URL    string
+	Date   time.Time
+	Body   template.HTML
+}
+
+// commentsKey returns the directory within data/comments of the comments
+// on the page written to outputPath: its URL without the extension, such as
+// `blog/first-post`, or `index` for the home page.
+func commentsKey(outputPath string) string {
+	key := strings.TrimPrefix(filepath.ToSlash(outputPath), outputDirectory+"/")
+	key = strings.Trim(strings.TrimSuffix(strings.TrimSuffix(key, "index.html"), ".html"), "/")
+	if key == "" {
+		return "index"
+	}
+	return key
+}
+
+// pageComments reads the comments on the page whose comments are in the
+// directory key, oldest first. Their bodies are rendered with any
+// HTML escaped.
+func (b *builder) pageComments(key string) []*Comment {
+	directory := commentsDirectory + "/" + key
+	entries, err := os.ReadDir(directory)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	check(err)
+
+	if b.commentWriter == nil {
+		noMath := false
+		b.commentWriter = newMarkdownWriter(markdownOptions{Sanitize: sanitizeEscape, Math: &noMath}, nil)
+	}
+
+	var comments []*Comment
+	for _, entry := range entries {
+		extension := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (extension != ".yaml" && extension != ".yml") {
+			continue
+		}
+		commentPath := directory + "/" + entry.Name()
+		data, err := os.ReadFile(commentPath)
+		check(err)
+
+		var value interface{}
+		if err := yaml.Unmarshal(data, &value); err != nil {
+			warnAt(commentPath, 0, "%v; leaving the comment out", err)
+			continue
+		}
+		fields, ok := normalizeFrontMatter(value).(map[string]interface{})
+		if !ok {
+			warnAt(commentPath, 0, "a comment must be a map, not %T; leaving it out", value)
+			continue
+		}
+		comment := &Comment{
+			ID:     "comment-" + slugify(removeExtension(entry.Name())),
+			Author: frontMatterString(fields, "author"),
+			URL:    frontMatterString(fields, "url"),
+		}
+		body := frontMatterString(fields, "body")
+		if comment.Author == "" || body == "" {
+			warnAt(commentPath, 0, "a comment needs an author and a body; leaving it out")
+			continue
+		}
+		comment.Date, err = parseFrontMatterDate(frontMatterValue(fields, "date"), b.settings.location)
+		if err != nil {
+			warnAt(commentPath, sourceLine(commentPath, "date:"), "date: %v; leaving the comment out", err)
+			continue
+		}
+
+		var buf bytes.Buffer
+		check(b.commentWriter.Convert([]byte(body), &buf))
+		comment.Body = template.HTML(buf.String())
+		comments = append(comments, comment)
+	}
+
+	sort.SliceStable(comments, func(i, j int) bool {
+		return comments[i].Date.Before(comments[j].Date)
+	})
+	return comments
+}
+
+// CommentLink returns a link for submitting a new comment on the page: a
+// new issue, or else an email, saying where the comment's file goes. It is
+// empty if the site sets neither.
+func (page *Page) CommentLink() string {
+	config := page.Site.settings.Comments
+	if page.commentsKey == "" {
+		return ""
+	}
+	title := "Comment on " + page.Title
+	body := fmt.Sprintf("Page: %s\nFile: %s/%s/\n\nauthor: \nurl: \nbody: |\n  \n", page.Permalink, commentsDirectory, page.commentsKey)
+
+	query := url.Values{"title": {title}, "body": {body}}
+	switch {
+	case config.Issues != "":
+		separator := "?"
+		if strings.Contains(config.Issues, "?") {
+			separator = "&"
+		}
+		return config.Issues + separator + query.Encode()
+	case config.Email != "":
+		return "mailto:" + config.Email + "?subject=" + mailtoEscape(title) + "&body=" + mailtoEscape(body)
+	}
+	return ""
+}
+
+// mailtoEscape escapes s for a mailto: URL, whose spaces, unlike a query's,
+// cannot be written as plus signs.
+func mailtoEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+const commentsTemplate = "comments.html"
+
+// commentsInclude is the built-in include listing a page's comments and
+// linking to CommentLink.
+const commentsInclude = `{{ if or .Comments .CommentLink }}<section class="comments" id="comments">
+<h2>Comments</h2>
+{{ range .Comments }}<article class="comment" id="{{ .ID }}">
+<p class="comment-meta">{{ if .URL }}<a href="{{ .URL }}" rel="nofollow ugc">{{ .Author }}</a>{{ else }}{{ .Author }}{{ end }}{{ if not .Date.IsZero }} <time datetime="{{ .Date.Format "2006-01-02T15:04:05Z07:00" }}">{{ .Date.Format "2 January 2006" }}</time>{{ end }}</p>
+{{ .Body }}
+</article>
+{{ end }}{{ with .CommentLink }}<p><a href="{{ . }}">Leave a comment</a></p>
+{{ end }}</section>{{ end }}`
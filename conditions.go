@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var onlyOpenPattern = regexp.MustCompile(`^\s*:::+\s*only\b(.*)$`)
+
+var divOpenPattern = regexp.MustCompile(`^\s*:::+\s*\S`)
+
+var divClosePattern = regexp.MustCompile(`^\s*:::+\s*$`)
+
+var codeFencePattern = regexp.MustCompile("^\\s*(```|~~~)")
+
+// conditionFlag collects repeated `-condition key=value` flags.
+type conditionFlag map[string]string
+
+func (conditions conditionFlag) String() string {
+	pairs := make([]string, 0, len(conditions))
+	for key, value := range conditions {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (conditions conditionFlag) Set(pair string) error {
+	key, value, ok := strings.Cut(pair, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("conditions are given as key=value, not %q", pair)
+	}
+	conditions[key] = value
+	return nil
+}
+
+// matchesConditions reports whether every `key=value` or `key!=value`
+// condition of an `only` block holds, where a value may list alternatives
+// separated by commas.
+func matchesConditions(conditions string, values map[string]string) (bool, error) {
+	for _, condition := range strings.Fields(conditions) {
+		negated := false
+		key, expected, ok := strings.Cut(condition, "!=")
+		if ok {
+			negated = true
+		} else if key, expected, ok = strings.Cut(condition, "="); !ok {
+			return false, fmt.Errorf("conditions are given as key=value or key!=value, not %q", condition)
+		}
+
+		matched := false
+		for _, alternative := range strings.Split(strings.Trim(expected, `"'`), ",") {
+			if values[key] == alternative {
+				matched = true
+			}
+		}
+		if matched == negated {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// stripConditionalBlocks keeps the `:::only` blocks of source whose
+// conditions hold and removes the others, along with the `:::only` and
+// closing `:::` lines themselves. Other `:::` divs and code blocks are left
+// alone.
+func stripConditionalBlocks(source []byte, values map[string]string) ([]byte, error) {
+	if !strings.Contains(string(source), ":::") {
+		return source, nil
+	}
+
+	type block struct {
+		only bool
+		keep bool
+	}
+	var blocks []block
+	keeping := func() bool {
+		for _, block := range blocks {
+			if !block.keep {
+				return false
+			}
+		}
+		return true
+	}
+
+	var out []string
+	codeFence := ""
+	for number, line := range strings.SplitAfter(string(source), "\n") {
+		if codeFence != "" || codeFencePattern.MatchString(line) {
+			if match := codeFencePattern.FindStringSubmatch(line); match != nil {
+				if codeFence == "" {
+					codeFence = match[1]
+				} else if match[1] == codeFence {
+					codeFence = ""
+				}
+			}
+		} else if match := onlyOpenPattern.FindStringSubmatch(strings.TrimRight(line, "\r\n")); match != nil {
+			keep, err := matchesConditions(match[1], values)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", number+1, err)
+			}
+			blocks = append(blocks, block{only: true, keep: keep})
+			continue
+		} else if divClosePattern.MatchString(line) && len(blocks) > 0 {
+			closed := blocks[len(blocks)-1]
+			blocks = blocks[:len(blocks)-1]
+			if closed.only {
+				continue
+			}
+		} else if divOpenPattern.MatchString(line) {
+			blocks = append(blocks, block{keep: true})
+		}
+
+		if keeping() {
+			out = append(out, line)
+		}
+	}
+	return []byte(strings.Join(out, "")), nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+type markdownOptions struct {
+	Sanitize          string           `yaml:"sanitize"`
+	AllowedTags       []string         `yaml:"allowedTags"`
+	AllowedAttributes []string         `yaml:"allowedAttributes"`
+	Math              *bool            `yaml:"math"`
+	Highlight         *highlightConfig `yaml:"highlight"`
+}
+
+type markdownProfile struct {
+	Path            string `yaml:"path"`
+	markdownOptions `yaml:",inline"`
+}
+
+type markdownConfig struct {
+	markdownOptions `yaml:",inline"`
+	Profiles        []markdownProfile `yaml:"profiles"`
+}
+
+type imagesConfig struct {
+	CoverWidths []int             `yaml:"coverWidths"`
+	Widths      []int             `yaml:"widths"`
+	Formats     []string          `yaml:"formats"`
+	Quality     int               `yaml:"quality"`
+	Sizes       string            `yaml:"sizes"`
+	Directories []string          `yaml:"directories"`
+	Encoders    map[string]string `yaml:"encoders"`
+}
+
+type urlRewriteConfig struct {
+	AssetHost       string   `yaml:"assetHost"`
+	AssetExtensions []string `yaml:"assetExtensions"`
+	PathPrefix      string   `yaml:"pathPrefix"`
+}
+
+type urlsConfig struct {
+	TrailingSlash *bool `yaml:"trailingSlash"`
+	ShowIndex     bool  `yaml:"showIndex"`
+}
+
+type dataPagesConfig struct {
+	Data         string `yaml:"data"`
+	Path         string `yaml:"path"`
+	Title        string `yaml:"title"`
+	Template     string `yaml:"template"`
+	ListTemplate string `yaml:"listTemplate"`
+	TitleKey     string `yaml:"titleKey"`
+	BodyKey      string `yaml:"bodyKey"`
+}
+
+type siteConfig struct {
+	BaseURL       string                     `yaml:"baseURL"`
+	Domain        string                     `yaml:"domain"`
+	DomainAliases []string                   `yaml:"domainAliases"`
+	BasePath      string                     `yaml:"basePath"`
+	Markdown      markdownConfig             `yaml:"markdown"`
+	Images        imagesConfig               `yaml:"images"`
+	URLRewrite    urlRewriteConfig           `yaml:"urlRewrite"`
+	URLs          urlsConfig                 `yaml:"urls"`
+	UglyURLs      *bool                      `yaml:"uglyURLs"`
+	Share         shareConfig                `yaml:"share"`
+	DataPages     []dataPagesConfig          `yaml:"dataPages"`
+	Events        eventsConfig               `yaml:"events"`
+	TimeZone      string                     `yaml:"timezone"`
+	Outputs       map[string]string          `yaml:"outputs"`
+	Feeds         feedsConfig                `yaml:"feeds"`
+	Crawlers      crawlersConfig             `yaml:"crawlers"`
+	Robots        *robotsConfig              `yaml:"robots"`
+	License       licenseConfig              `yaml:"license"`
+	Consent       consentConfig              `yaml:"consent"`
+	Forms         map[string]formConfig      `yaml:"forms"`
+	Comments      commentsConfig             `yaml:"comments"`
+	Reactions     reactionsConfig            `yaml:"reactions"`
+	Paginate      int                        `yaml:"paginate"`
+	Template      string                     `yaml:"template"`
+	ListTemplate  string                     `yaml:"listTemplate"`
+	Integrity     integrityConfig            `yaml:"integrity"`
+	Budgets       budgetsConfig              `yaml:"budgets"`
+	Releases      releasesConfig             `yaml:"releases"`
+	ServiceWorker *serviceWorkerConfig       `yaml:"serviceWorker"`
+	Deploy        deployConfig               `yaml:"deploy"`
+	Search        searchConfig               `yaml:"search"`
+	API           apiConfig                  `yaml:"api"`
+	TOC           tocConfig                  `yaml:"toc"`
+	Execute       executeConfig              `yaml:"execute"`
+	Transforms    map[string]transformConfig `yaml:"transforms"`
+	Sass          sassConfig                 `yaml:"sass"`
+	Tokens        map[string]string          `yaml:"tokens"`
+	Conditions    map[string]string          `yaml:"conditions"`
+	Strict        bool                       `yaml:"strict"`
+	Minify        bool                       `yaml:"minify"`
+	Wikilinks     wikilinksConfig            `yaml:"wikilinks"`
+	Queries       []queryOutputConfig        `yaml:"queries"`
+	Aliases       aliasesConfig              `yaml:"aliases"`
+	Statuses      map[string][]string        `yaml:"statuses"`
+	Taxonomies    map[string]taxonomyConfig  `yaml:"taxonomies"`
+	ParamSchemas  map[string]string          `yaml:"paramSchemas"`
+
+	location *time.Location
+}
+
+func (options markdownOptions) merge(override markdownOptions) markdownOptions {
+	if override.Sanitize != "" {
+		options.Sanitize = override.Sanitize
+	}
+	if override.AllowedTags != nil {
+		options.AllowedTags = override.AllowedTags
+	}
+	if override.AllowedAttributes != nil {
+		options.AllowedAttributes = override.AllowedAttributes
+	}
+	if override.Math != nil {
+		options.Math = override.Math
+	}
+	if override.Highlight != nil {
+		options.Highlight = override.Highlight
+	}
+	return options
+}
+
+func decodeSiteConfig(config map[string]interface{}) siteConfig {
+	settings := siteConfig{TOC: defaultTOC}
+
+	data, err := yaml.Marshal(config)
+	check(err)
+
+	err = yaml.Unmarshal(data, &settings)
+	check(err)
+
+	if settings.BaseURL == "" && settings.Domain != "" {
+		settings.BaseURL = "https://" + settings.Domain + "/"
+	}
+	if settings.BasePath == "" && settings.BaseURL != "" {
+		baseURL, err := url.Parse(settings.BaseURL)
+		check(err)
+		settings.BasePath = baseURL.Path
+	}
+	settings.BasePath = strings.TrimSuffix("/"+strings.Trim(settings.BasePath, "/"), "/")
+
+	if settings.Conditions == nil {
+		settings.Conditions = make(map[string]string)
+	}
+	if _, ok := settings.Conditions["format"]; !ok {
+		settings.Conditions["format"] = "html"
+	}
+
+	settings.location, err = time.LoadLocation(settings.TimeZone)
+	check(err)
+
+	return settings
+}
+
+// pageURL returns the canonical root-relative URL of the page written to
+// outputPath: `/post/`, `/post`, or `/post/index.html` for a directory index
+// depending on the urls settings, and `/about.html` for any other page.
+func (settings siteConfig) pageURL(outputPath string) string {
+	url := "/" + strings.TrimPrefix(filepath.ToSlash(outputPath), outputDirectory+"/")
+	if settings.URLs.ShowIndex || path.Base(url) != "index.html" {
+		return url
+	}
+
+	url = strings.TrimSuffix(url, "index.html")
+	if url != "/" && settings.URLs.TrailingSlash != nil && !*settings.URLs.TrailingSlash {
+		url = strings.TrimSuffix(url, "/")
+	}
+	return url
+}
+
+// now returns the current time in the site's timezone.
+func (settings siteConfig) now() time.Time {
+	return time.Now().In(settings.location)
+}
+
+// sitePath prefixes the root-relative path p with the base path the site is
+// hosted under.
+func (settings siteConfig) sitePath(p string) string {
+	return settings.BasePath + "/" + strings.TrimPrefix(p, "/")
+}
+
+// siteURL returns the absolute URL of the root-relative path p.
+func (settings siteConfig) siteURL(p string) string {
+	origin := strings.TrimSuffix(settings.BaseURL, "/")
+	if baseURL, err := url.Parse(settings.BaseURL); err == nil && baseURL.Host != "" {
+		origin = baseURL.Scheme + "://" + baseURL.Host
+	}
+	return origin + settings.sitePath(p)
+}
+
+// frontMatterValue looks key up in front matter regardless of its case, so
+// that `Cover:` and `cover:` are equivalent.
+func frontMatterValue(metaData map[string]interface{}, key string) interface{} {
+	if value, ok := metaData[key]; ok {
+		return value
+	}
+	for name, value := range metaData {
+		if strings.EqualFold(name, key) {
+			return value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+)
+
+// consentConfig lists the categories of scripts that may only run once the
+// visitor agrees to them, and in which regions they must ask. A region is
+// recognised by the visitor's time zone; visitors in no listed region are
+// asked about the categories in Require, or about all of them if it is not
+// given.
+type consentConfig struct {
+	Categories []string        `yaml:"categories" json:"categories"`
+	Message    string          `yaml:"message" json:"-"`
+	Policy     string          `yaml:"policy" json:"-"`
+	Accept     string          `yaml:"accept" json:"-"`
+	Reject     string          `yaml:"reject" json:"-"`
+	Require    []string        `yaml:"require" json:"require"`
+	Regions    []consentRegion `yaml:"regions" json:"regions"`
+}
+
+type consentRegion struct {
+	Name      string   `yaml:"name" json:"-"`
+	TimeZones []string `yaml:"timeZones" json:"timeZones"`
+	Require   []string `yaml:"require" json:"require"`
+}
+
+func (config consentConfig) isCategory(category string) bool {
+	for _, known := range config.Categories {
+		if known == category {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRequirements warns about scripts that wait for consent to a category
+// the site does not ask for, which would never run.
+func (config consentConfig) checkRequirements(assets *pageAssets, sourcePath string) {
+	for _, requirement := range assets.requirements {
+		if requirement.Consent != "" && !config.isCategory(requirement.Consent) {
+			warnAt(sourcePath, sourceLine(sourcePath, requirement.Src), "%s waits for consent to %q, which is not one of the consent categories", requirement.Src, requirement.Consent)
+		}
+	}
+}
+
+// consentPlaceholder renders a script that needs consent inertly, for the
+// consent script to replace with the real one once it is given.
+func consentPlaceholder(requirement assetRequirement) string {
+	attributes := ""
+	if requirement.Module {
+		attributes += " data-module"
+	}
+	if requirement.Async {
+		attributes += " data-async"
+	}
+	return fmt.Sprintf(`<script type="text/plain" data-consent="%s" data-src="%s"%s></script>`,
+		html.EscapeString(requirement.Consent), html.EscapeString(requirement.Src), attributes)
+}
+
+// Consent returns the site's consent settings, or nil if it has no consent
+// categories.
+func (site *Site) Consent() *consentConfig {
+	if len(site.settings.Consent.Categories) == 0 {
+		return nil
+	}
+	config := site.settings.Consent
+	if config.Require == nil {
+		config.Require = config.Categories
+	}
+	config.Regions = append([]consentRegion(nil), config.Regions...)
+	for i, region := range config.Regions {
+		if region.Require == nil {
+			config.Regions[i].Require = config.Categories
+		}
+	}
+	return &config
+}
+
+// Script returns the script the consent banner runs: it works out which
+// categories the visitor's region needs consent for, shows the banner until
+// they have answered, remembers the answer, and then starts the scripts
+// that have consent.
+func (config *consentConfig) Script() (template.HTML, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(`<script>
+(function () {
+	var config = ` + string(data) + `;
+	var key = "grafe-consent";
+	var zone = "";
+	try { zone = Intl.DateTimeFormat().resolvedOptions().timeZone || ""; } catch (e) {}
+	var required = config.require;
+	config.regions.some(function (region) {
+		return region.timeZones.some(function (prefix) {
+			if (zone.indexOf(prefix) === 0) {
+				required = region.require;
+				return true;
+			}
+		});
+	});
+	var choices = {};
+	try { choices = JSON.parse(localStorage.getItem(key)) || {}; } catch (e) {}
+
+	function start() {
+		document.querySelectorAll("script[data-consent]").forEach(function (placeholder) {
+			var category = placeholder.getAttribute("data-consent");
+			if (config.categories.indexOf(category) < 0 || (required.indexOf(category) >= 0 && choices[category] !== true)) {
+				return;
+			}
+			var script = document.createElement("script");
+			script.src = placeholder.getAttribute("data-src");
+			if (placeholder.hasAttribute("data-module")) {
+				script.type = "module";
+			}
+			script.async = placeholder.hasAttribute("data-async");
+			placeholder.parentNode.replaceChild(script, placeholder);
+		});
+	}
+
+	function ready() {
+		var banner = document.getElementById("grafe-consent");
+		function choose(accepted) {
+			required.forEach(function (category) { choices[category] = accepted; });
+			try { localStorage.setItem(key, JSON.stringify(choices)); } catch (e) {}
+			if (banner) {
+				banner.hidden = true;
+			}
+			start();
+		}
+		if (banner) {
+			banner.querySelector("[data-consent-accept]").onclick = function () { choose(true); };
+			banner.querySelector("[data-consent-reject]").onclick = function () { choose(false); };
+			banner.hidden = !required.some(function (category) { return !(category in choices); });
+		}
+		window.grafeConsent = { open: function () { if (banner) { banner.hidden = false; } } };
+		start();
+	}
+
+	if (document.readyState === "loading") {
+		document.addEventListener("DOMContentLoaded", ready);
+	} else {
+		ready();
+	}
+})();
+</script>`), nil
+}
+
+const consentBannerTemplate = "consent-banner.html"
+
+// consentBanner is the built-in include for the consent banner.
+const consentBanner = `{{ with .Site.Consent }}<div id="grafe-consent" class="grafe-consent" role="dialog" aria-label="Cookie consent" hidden>
+<p>{{ or .Message "This site would like to use cookies." }}{{ with .Policy }} <a href="{{ . }}">Privacy policy</a>{{ end }}</p>
+<button type="button" data-consent-accept>{{ or .Accept "Accept" }}</button>
+<button type="button" data-consent-reject>{{ or .Reject "Reject" }}</button>
+</div>
+{{ .Script }}{{ end }}`
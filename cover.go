@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+var defaultCoverWidths = []int{480, 960, 1440}
+
+type imageVariant struct {
+	URL    string
+	Width  int
+	Height int
+}
+
+type coverImage struct {
+	imageVariant
+	Sizes       []imageVariant
+	Srcset      string
+	OGImage     string
+	Placeholder imagePlaceholder
+}
+
+// resizeImage writes sourcePath scaled to width and height pixels to
+// destinationPath, unless destinationPath is already newer than the source.
+func resizeImage(sourcePath string, destinationPath string, width int, height int) error {
+	if destinationInfo, err := os.Stat(destinationPath); err == nil {
+		if sourceInfo, err := os.Stat(sourcePath); err == nil && destinationInfo.ModTime().After(sourceInfo.ModTime()) {
+			return nil
+		}
+	}
+
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	img, _, err := image.Decode(source)
+	if err != nil {
+		return err
+	}
+
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(resized, resized.Bounds(), img, img.Bounds(), draw.Over, nil)
+
+	// The image is written beside its destination and moved there once
+	// complete, so that pages rendering at once never see half of it.
+	createDirectoryPath(destinationPath)
+	destination, err := os.CreateTemp(filepath.Dir(destinationPath), "."+filepath.Base(destinationPath)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(destination.Name())
+
+	if strings.ToLower(filepath.Ext(destinationPath)) == ".png" {
+		err = png.Encode(destination, resized)
+	} else {
+		err = jpeg.Encode(destination, resized, &jpeg.Options{Quality: 85})
+	}
+	if closeErr := destination.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(destination.Name(), destinationPath)
+}
+
+// scaledWidths clips widths to the original width and sorts them, dropping
+// duplicates, without changing widths, which is the site's configuration.
+func scaledWidths(widths []int, originalWidth int) []int {
+	clipped := make([]int, len(widths))
+	for i, width := range widths {
+		if width <= 0 || width > originalWidth {
+			width = originalWidth
+		}
+		clipped[i] = width
+	}
+	sort.Ints(clipped)
+
+	var scaled []int
+	for _, width := range clipped {
+		if len(scaled) > 0 && scaled[len(scaled)-1] == width {
+			continue
+		}
+		scaled = append(scaled, width)
+	}
+	return scaled
+}
+
+// findCoverImage returns the cover image of the page at sourcePath: the
+// `Cover` front matter value if set, otherwise a `cover.*` image in the
+// page bundle directory.
+func findCoverImage(sourcePath string, metaData map[string]interface{}) (string, bool) {
+	if cover, ok := frontMatterValue(metaData, "cover").(string); ok && cover != "" {
+		return resolveAssetPath(cover, sourcePath)
+	}
+	if removeExtension(filepath.Base(sourcePath)) != "index" {
+		return "", false
+	}
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(sourcePath), "cover.*"))
+	for _, match := range matches {
+		if _, ok := imageMimeTypes[strings.ToLower(filepath.Ext(match))]; ok {
+			return match, true
+		}
+	}
+	return "", false
+}
+
+// deriveCoverImage writes the standard sizes of the page's cover image next
+// to the page's output file and describes them for templates.
+func deriveCoverImage(sourcePath string, outputFile string, metaData map[string]interface{}, settings siteConfig) *coverImage {
+	coverPath, ok := findCoverImage(sourcePath, metaData)
+	if !ok {
+		return nil
+	}
+
+	widths := settings.Images.CoverWidths
+	if len(widths) == 0 {
+		widths = defaultCoverWidths
+	}
+
+	extension := strings.ToLower(filepath.Ext(coverPath))
+	if extension != ".png" {
+		extension = ".jpg"
+	}
+	name := removeExtension(filepath.Base(coverPath))
+	pageDirectory := filepath.Dir(outputFile)
+	urlDirectory := settings.sitePath(strings.TrimPrefix(filepath.ToSlash(pageDirectory), outputDirectory))
+
+	originalWidth, originalHeight, err := imageDimensions(coverPath)
+	checkFile(coverPath, err)
+	if originalWidth <= 0 || originalHeight <= 0 {
+		failAt(coverPath, 0, "the cover image is %dx%d pixels and cannot be scaled", originalWidth, originalHeight)
+	}
+
+	cover := &coverImage{}
+	var srcset []string
+	for _, width := range scaledWidths(widths, originalWidth) {
+		height := originalHeight * width / originalWidth
+		if height == 0 {
+			height = 1
+		}
+		fileName := fmt.Sprintf("%s-%dw%s", name, width, extension)
+		err := resizeImage(coverPath, filepath.Join(pageDirectory, fileName), width, height)
+		checkFile(coverPath, err)
+		recordOutput(filepath.Join(pageDirectory, fileName))
+
+		variant := imageVariant{
+			URL:    path.Join(urlDirectory, fileName),
+			Width:  width,
+			Height: height,
+		}
+		cover.Sizes = append(cover.Sizes, variant)
+		srcset = append(srcset, fmt.Sprintf("%s %dw", variant.URL, variant.Width))
+	}
+
+	cover.imageVariant = cover.Sizes[len(cover.Sizes)-1]
+	cover.Srcset = strings.Join(srcset, ", ")
+	cover.OGImage = settings.siteURL(strings.TrimPrefix(cover.URL, settings.BasePath))
+	cover.Placeholder, err = generatePlaceholder(coverPath)
+	checkFile(coverPath, err)
+
+	return cover
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDeriveCoverImageReportsBrokenCover(t *testing.T) {
+	tests := []struct {
+		name  string
+		cover string
+		file  string
+	}{
+		{"not an image", "not an image", "cover.jpg"},
+		// A GIF whose screen is 0 by 0 pixels.
+		{"no pixels", "GIF89a\x00\x00\x00\x00\x00\x00\x00;", "cover.gif"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chdir(t, t.TempDir())
+			writeFiles(t, map[string]string{
+				"content/posts/trip/index.md":     "---\ntitle: Trip\n---\n",
+				"content/posts/trip/" + test.file: test.cover,
+			})
+			resetWarnings()
+			defer resetWarnings()
+
+			var cover *coverImage
+			err := guardFileError(func() {
+				cover = deriveCoverImage("content/posts/trip/index.md", outputDirectory+"/posts/trip/index.html", nil, siteConfig{})
+			})
+			if err == nil {
+				t.Fatalf("a broken cover gave %+v, want an error", cover)
+			}
+			if !strings.HasPrefix(err.Error(), "content/posts/trip/"+test.file+": ") {
+				t.Errorf("error %q does not name the cover image", err)
+			}
+		})
+	}
+}
+
+func TestScaledWidths(t *testing.T) {
+	tests := []struct {
+		name          string
+		widths        []int
+		originalWidth int
+		want          []int
+	}{
+		{"ascending", []int{480, 960, 1440}, 2000, []int{480, 960, 1440}},
+		{"unsorted", []int{1440, 480, 960}, 2000, []int{480, 960, 1440}},
+		{"clipped to the original", []int{1440, 480, 960}, 800, []int{480, 800}},
+		{"duplicates", []int{960, 480, 960}, 2000, []int{480, 960}},
+		{"zero is the original width", []int{0, 480}, 1200, []int{480, 1200}},
+		{"none", nil, 1200, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			widths := append([]int(nil), test.widths...)
+			got := scaledWidths(widths, test.originalWidth)
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("scaledWidths(%v, %d) = %v, want %v", test.widths, test.originalWidth, got, test.want)
+			}
+			if fmt.Sprint(widths) != fmt.Sprint(test.widths) {
+				t.Errorf("scaledWidths changed the configured widths to %v", widths)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+// defaultAIAgents are the user agents of the crawlers that gather training
+// data for AI models, which `noai` turns away in robots.txt.
+var defaultAIAgents = []string{
+	"GPTBot", "ChatGPT-User", "OAI-SearchBot", "CCBot", "ClaudeBot", "anthropic-ai",
+	"Google-Extended", "Applebot-Extended", "PerplexityBot", "Bytespider",
+	"Meta-ExternalAgent", "Amazonbot", "cohere-ai",
+}
+
+type crawlersConfig struct {
+	NoAI     bool     `yaml:"noai"`
+	AIAgents []string `yaml:"aiAgents"`
+}
+
+func (config crawlersConfig) aiAgents() []string {
+	if config.AIAgents != nil {
+		return config.AIAgents
+	}
+	return defaultAIAgents
+}
+
+type licenseConfig struct {
+	Name string `yaml:"name" json:"name,omitempty"`
+	URL  string `yaml:"url" json:"url"`
+}
+
+// pageLicense reads the `license` front matter, a URL or a map with a name
+// and a URL, falling back to the site's license.
+func pageLicense(metaData map[string]interface{}, sourcePath string, fallback licenseConfig) *licenseConfig {
+	license := fallback
+	switch value := frontMatterValue(metaData, "license").(type) {
+	case nil:
+	case string:
+		license = licenseConfig{URL: value}
+	case map[string]interface{}:
+		license = licenseConfig{Name: frontMatterString(value, "name"), URL: frontMatterString(value, "url")}
+	default:
+		warnAt(sourcePath, sourceLine(sourcePath, "license:"), "license should be a URL or a map with a name and a url, not %T; ignoring it", value)
+	}
+	if license.URL == "" {
+		return nil
+	}
+	return &license
+}
+
+// MetaTags returns the tags for the head of the page that tell crawlers how
+// they may use it: its robots meta tag, and its license as a
+// `rel="license"` link and JSON-LD.
+func (page *Page) MetaTags() (template.HTML, error) {
+	var tags strings.Builder
+	if page.Robots != "" {
+		fmt.Fprintf(&tags, "<meta name=\"robots\" content=\"%s\">\n", template.HTMLEscapeString(page.Robots))
+	}
+	if page.License != nil {
+		fmt.Fprintf(&tags, "<link rel=\"license\" href=\"%s\">\n", template.HTMLEscapeString(page.License.URL))
+
+		work := map[string]interface{}{
+			"@context": "https://schema.org",
+			"@type":    "CreativeWork",
+			"name":     page.Title,
+			"url":      page.Permalink,
+			"license":  page.License.URL,
+		}
+		if !page.Date.IsZero() {
+			work["datePublished"] = page.Date.Format("2006-01-02")
+		}
+		data, err := json.Marshal(work)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&tags, "<script type=\"application/ld+json\">%s</script>\n", data)
+	}
+	return template.HTML(tags.String()), nil
+}
+
+// writeRobotsFile writes robots.txt: the rules of the configuration or of
+// the site's own robots.txt, then rules turning AI crawlers away from the
+// site or from the pages marked `noai`, and, for configured rules, the
+// sitemap.
+func (b *builder) writeRobotsFile(site *Site) {
+	var disallowed []string
+	if b.settings.Crawlers.NoAI {
+		disallowed = []string{b.settings.sitePath("/")}
+	} else {
+		for _, page := range append(append([]*Page(nil), site.ListPages...), site.Pages...) {
+			if page.NoAI {
+				disallowed = append(disallowed, page.RelPermalink)
+			}
+		}
+	}
+	if len(disallowed) == 0 && b.settings.Robots == nil {
+		return
+	}
+
+	existing := b.robotsRules()
+	var robots strings.Builder
+	robots.WriteString(existing)
+	if len(disallowed) > 0 {
+		if len(existing) > 0 && !strings.HasSuffix(existing, "\n\n") {
+			robots.WriteString("\n")
+		}
+		for _, agent := range b.settings.Crawlers.aiAgents() {
+			fmt.Fprintf(&robots, "User-agent: %s\n", agent)
+		}
+		for _, path := range disallowed {
+			fmt.Fprintf(&robots, "Disallow: %s\n", path)
+		}
+	}
+	if sitemap := b.settings.sitemapURL(); sitemap != "" && b.settings.Robots != nil {
+		fmt.Fprintf(&robots, "\nSitemap: %s\n", sitemap)
+	}
+	b.writeOutput(outputDirectory+"/robots.txt", []byte(robots.String()))
+}
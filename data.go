@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"gopkg.in/yaml.v2"
+)
+
+var slugSeparatorPattern = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+func slugify(name string) string {
+	return strings.Trim(slugSeparatorPattern.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// readDataFile reads a list of entries from a YAML file holding a list of
+// maps or from a CSV file whose first row names the columns.
+func readDataFile(dataPath string) ([]map[string]interface{}, error) {
+	file, err := os.ReadFile(dataPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []map[string]interface{}
+	switch strings.ToLower(filepath.Ext(dataPath)) {
+	case ".csv":
+		records, err := csv.NewReader(strings.NewReader(string(file))).ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		for i, record := range records {
+			if i == 0 {
+				continue
+			}
+			entry := make(map[string]interface{}, len(record))
+			for column, value := range record {
+				entry[records[0][column]] = value
+			}
+			entries = append(entries, entry)
+		}
+	case ".yaml", ".yml":
+		var values []interface{}
+		if err := yaml.Unmarshal(file, &values); err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			entry, ok := normalizeFrontMatter(value).(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("every entry must be a map, not %T", value)
+			}
+			entries = append(entries, entry)
+		}
+	default:
+		return nil, errors.New("data files must be YAML or CSV")
+	}
+	return entries, nil
+}
+
+const dataDirectory = "data"
+
+// readSiteData reads every YAML, JSON, TOML, and CSV file below directory
+// into a map by file name without its extension, nested by subdirectory, so
+// that `data/talks/2024.yaml` is `.Site.Data.talks`, then `2024`. Files that
+// cannot be read are left out with a warning.
+func readSiteData(directory string) map[string]interface{} {
+	data := make(map[string]interface{})
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return data
+	}
+	for _, entry := range entries {
+		dataPath := directory + "/" + entry.Name()
+		if entry.IsDir() {
+			data[entry.Name()] = readSiteData(dataPath)
+			continue
+		}
+
+		file, err := os.ReadFile(dataPath)
+		check(err)
+		var value interface{}
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".yaml", ".yml":
+			err = yaml.Unmarshal(file, &value)
+		case ".json":
+			err = json.Unmarshal(file, &value)
+		case ".toml":
+			var table map[string]interface{}
+			err = toml.Unmarshal(file, &table)
+			value = table
+		case ".csv":
+			var rows []map[string]interface{}
+			rows, err = readDataFile(dataPath)
+			value = rows
+		default:
+			continue
+		}
+		if err != nil {
+			warnAt(dataPath, 0, "%v; leaving it out of .Site.Data", err)
+			continue
+		}
+
+		name := removeExtension(entry.Name())
+		if _, ok := data[name]; ok {
+			warnAt(dataPath, 0, "data/%s is already read from another file; leaving this one out", strings.TrimPrefix(directory+"/"+name, dataDirectory+"/"))
+			continue
+		}
+		data[name] = normalizeFrontMatter(value)
+	}
+	return data
+}
+
+func indexLetter(title string) string {
+	runes := []rune(title)
+	if len(runes) == 0 || !unicode.IsLetter(runes[0]) {
+		return "#"
+	}
+	return string(unicode.ToUpper(runes[0]))
+}
+
+// newGeneratedPage builds a page for generated content, converting body with
+// the default markdown writer.
+func (b *builder) newGeneratedPage(sourcePath string, outputPath string, templateName string, title string, params map[string]interface{}, body string) *Page {
+	markdownWriter := b.markdownWriters.defaultWriter
+	source := []byte(body)
+	document := markdownWriter.Parser().Parse(text.NewReader(source), parser.WithContext(parser.NewContext()))
+
+	page := &Page{
+		Title:        title,
+		Section:      strings.SplitN(strings.TrimPrefix(outputPath, outputDirectory+"/"), "/", 2)[0],
+		Slug:         removeExtension(filepath.Base(outputPath)),
+		Template:     templateName,
+		Params:       params,
+		RelPermalink: b.settings.sitePath(b.settings.pageURL(outputPath)),
+		Permalink:    b.settings.siteURL(b.settings.pageURL(outputPath)),
+		Scratch:      newScratch(),
+		PageParams:   map[string]interface{}{},
+		SiteParams:   b.config,
+
+		SourcePath: sourcePath,
+		OutputPath: outputPath,
+
+		source:         source,
+		document:       document,
+		markdownWriter: markdownWriter,
+	}
+	page.setIndexing(nil, b.settings)
+	page.License = pageLicense(nil, sourcePath, b.settings.License)
+	return page
+}
+
+// generateDataPages builds the pages described by a dataPages entry: one
+// page per entry of the data file, titled by its title key, plus a list
+// page at the section's index grouping the entries by initial letter. A
+// data file that cannot be read fails, and so does an entry without a
+// title, which is left out.
+func (b *builder) generateDataPages(config dataPagesConfig) []*Page {
+	entries, err := readDataFile(config.Data)
+	if err != nil {
+		guardFile(func() { checkFile(config.Data, err) })
+		return nil
+	}
+
+	titleKey, bodyKey := config.TitleKey, config.BodyKey
+	if titleKey == "" {
+		titleKey = "term"
+	}
+	if bodyKey == "" {
+		bodyKey = "definition"
+	}
+	directory := outputDirectory + "/" + strings.Trim(config.Path, "/")
+
+	var terms []*Page
+	for i, entry := range entries {
+		title := frontMatterString(entry, titleKey)
+		if title == "" {
+			guardFile(func() { failAt(config.Data, 0, "entry %d has no %q to title its page by", i+1, titleKey) })
+			continue
+		}
+		params := lowercaseKeys(entry)
+		params["letter"] = indexLetter(title)
+		terms = append(terms, b.newGeneratedPage(config.Data, b.settings.pageFile(strings.Trim(config.Path, "/")+"/", slugify(title)), config.Template, title, params, frontMatterString(entry, bodyKey)))
+	}
+	sort.SliceStable(terms, func(i, j int) bool {
+		return strings.ToLower(terms[i].Title) < strings.ToLower(terms[j].Title)
+	})
+
+	var letters []collectionGroup
+	for _, term := range terms {
+		letter := term.Params["letter"]
+		if len(letters) == 0 || letters[len(letters)-1].Key != letter {
+			letters = append(letters, collectionGroup{Key: letter, Pages: []*Page{}})
+		}
+		group := &letters[len(letters)-1]
+		group.Pages = append(group.Pages.([]*Page), term)
+	}
+
+	pages := terms
+	if config.ListTemplate != "" {
+		params := map[string]interface{}{"terms": terms, "letters": letters}
+		list := b.newGeneratedPage(config.Data, directory+"/index.html", config.ListTemplate, config.Title, params, "")
+		list.IsList = true
+		pages = append(pages, list)
+	}
+	return pages
+}
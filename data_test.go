@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateDataPagesFailsEntriesWithoutTitles(t *testing.T) {
+	chdir(t, t.TempDir())
+	writeFiles(t, map[string]string{
+		"data/glossary.yaml": "- term: Slug\n  definition: A page's name in its URL.\n- definition: Nothing to call it.\n",
+		"data/broken.yaml":   "- term: [\n",
+	})
+	resetWarnings()
+	defer resetWarnings()
+
+	b := &builder{markdownWriters: newMarkdownWriters(markdownConfig{}, nil)}
+	pages := b.generateDataPages(dataPagesConfig{Data: "data/glossary.yaml", Path: "glossary", Template: "term"})
+	if len(pages) != 1 || pages[0].Title != "Slug" {
+		t.Errorf("generated %d pages, want the one titled Slug", len(pages))
+	}
+	if pages := b.generateDataPages(dataPagesConfig{Data: "data/broken.yaml", Path: "broken", Template: "term"}); pages != nil {
+		t.Errorf("an unreadable data file generated %d pages", len(pages))
+	}
+
+	var failed []string
+	for _, warning := range loggedWarnings() {
+		if warning.failed {
+			failed = append(failed, warning.file+": "+warning.message)
+		}
+	}
+	if len(failed) != 2 || failed[0] != `data/glossary.yaml: entry 2 has no "term" to title its page by` || !strings.HasPrefix(failed[1], "data/broken.yaml: yaml: ") {
+		t.Errorf("failed files are %q", failed)
+	}
+}
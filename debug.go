@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"log"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+const debugDepth = 3
+
+type templateMetric struct {
+	name  string
+	calls int
+	total time.Duration
+	max   time.Duration
+}
+
+// templateMetrics records how long each layout and partial takes to
+// execute and how often it runs, for `-template-metrics`.
+type templateMetrics struct {
+	mu      sync.Mutex
+	metrics map[string]*templateMetric
+}
+
+func newTemplateMetrics() *templateMetrics {
+	return &templateMetrics{metrics: make(map[string]*templateMetric)}
+}
+
+func (m *templateMetrics) record(name string, start time.Time) {
+	if m == nil {
+		return
+	}
+	elapsed := time.Since(start)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	metric, ok := m.metrics[name]
+	if !ok {
+		metric = &templateMetric{name: name}
+		m.metrics[name] = metric
+	}
+	metric.calls++
+	metric.total += elapsed
+	if elapsed > metric.max {
+		metric.max = elapsed
+	}
+}
+
+func (m *templateMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	metrics := make([]*templateMetric, 0, len(m.metrics))
+	for _, metric := range m.metrics {
+		metrics = append(metrics, metric)
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].total > metrics[j].total
+	})
+
+	fmt.Fprintf(w, "%-40s %8s %12s %12s %12s\n", "template", "calls", "total", "average", "max")
+	for _, metric := range metrics {
+		average := metric.total / time.Duration(metric.calls)
+		fmt.Fprintf(w, "%-40s %8d %12s %12s %12s\n", metric.name, metric.calls, metric.total.Round(time.Microsecond), average.Round(time.Microsecond), metric.max.Round(time.Microsecond))
+	}
+}
+
+// debugValue turns value into something JSON can encode, following
+// pointers and nested values only to a limited depth so that the cycles
+// between pages and the site don't recurse forever.
+func debugValue(value reflect.Value, depth int) interface{} {
+	value = indirect(value)
+	if !value.IsValid() {
+		return nil
+	}
+	if value.Type() == reflect.TypeOf(time.Time{}) {
+		return value.Interface()
+	}
+	if depth == 0 {
+		switch value.Kind() {
+		case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+			return fmt.Sprintf("<%s>", value.Type())
+		}
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		fields := make(map[string]interface{})
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).IsExported() {
+				fields[value.Type().Field(i).Name] = debugValue(value.Field(i), depth-1)
+			}
+		}
+		return fields
+	case reflect.Map:
+		entries := make(map[string]interface{})
+		for _, key := range value.MapKeys() {
+			entries[fmt.Sprint(key.Interface())] = debugValue(value.MapIndex(key), depth-1)
+		}
+		return entries
+	case reflect.Slice, reflect.Array:
+		items := make([]interface{}, value.Len())
+		for i := range items {
+			items[i] = debugValue(value.Index(i), depth-1)
+		}
+		return items
+	case reflect.Func, reflect.Chan:
+		return fmt.Sprintf("<%s>", value.Type())
+	}
+	return value.Interface()
+}
+
+func debugString(value interface{}) string {
+	data, err := json.MarshalIndent(debugValue(reflect.ValueOf(value), debugDepth), "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%#v", value)
+	}
+	return fmt.Sprintf("%T %s", value, data)
+}
+
+// debug logs value and renders it in a <pre> block.
+func debug(value interface{}) template.HTML {
+	dump := debugString(value)
+	log.Printf("debug: %s\n", dump)
+	return template.HTML(`<pre class="grafe-debug">` + html.EscapeString(dump) + `</pre>`)
+}
+
+// jsonify encodes value as JSON, indented when given an indent:
+// `jsonify .Params` or `jsonify "  " .Params`.
+func jsonify(args ...interface{}) (string, error) {
+	var data []byte
+	var err error
+	switch len(args) {
+	case 1:
+		data, err = json.Marshal(args[0])
+	case 2:
+		data, err = json.MarshalIndent(args[1], "", fmt.Sprint(args[0]))
+	default:
+		return "", fmt.Errorf("jsonify takes a value, optionally preceded by an indent")
+	}
+	return string(data), err
+}
+
+// logf writes a printf-style message to the build log and renders nothing.
+func logf(format string, args ...interface{}) string {
+	log.Printf(format+"\n", args...)
+	return ""
+}
+
+// executePartial runs the named template from the current template set,
+// timing it when metrics are being recorded.
+func executePartial(pageTemplate *template.Template, metrics *templateMetrics, name string, data interface{}) (template.HTML, error) {
+	if pageTemplate == nil {
+		return "", fmt.Errorf("partial %q called outside a page", name)
+	}
+	defer metrics.record("partial "+name, time.Now())
+
+	var buf bytes.Buffer
+	err := pageTemplate.ExecuteTemplate(&buf, name, data)
+	return template.HTML(buf.String()), err
+}
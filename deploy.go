@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+)
+
+const deployManifestFile = ".grafe-manifest.json"
+
+type deployConfig struct {
+	Target            string            `yaml:"target"`
+	CacheControl      map[string]string `yaml:"cacheControl"`
+	InvalidateCommand []string          `yaml:"invalidateCommand"`
+}
+
+// deployTarget is somewhere a built site can be synchronised to. Files are
+// compared by the hash the target itself keeps for them.
+type deployTarget interface {
+	List() (map[string]string, error)
+	Hash(data []byte) string
+	Put(name string, data []byte, header http.Header) error
+	Delete(name string) error
+	Finish(hashes map[string]string) error
+}
+
+// s3DeployTarget compares files with their MD5 ETags.
+type s3DeployTarget struct {
+	s3 *s3Client
+}
+
+func (target *s3DeployTarget) List() (map[string]string, error) {
+	return target.s3.ListObjects()
+}
+
+func (target *s3DeployTarget) Hash(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (target *s3DeployTarget) Put(name string, data []byte, header http.Header) error {
+	return target.s3.PutObject(name, data, header)
+}
+
+func (target *s3DeployTarget) Delete(name string) error {
+	return target.s3.DeleteObject(name)
+}
+
+func (target *s3DeployTarget) Finish(hashes map[string]string) error {
+	return nil
+}
+
+// httpDeployTarget uploads with PUT and removes with DELETE, as WebDAV
+// servers accept, and keeps the hashes of what it uploaded in a manifest
+// next to the site. Credentials can be given in the URL.
+type httpDeployTarget struct {
+	base   string
+	client *http.Client
+}
+
+func (target *httpDeployTarget) send(method string, name string, body []byte, header http.Header) (*http.Response, error) {
+	request, err := http.NewRequest(method, target.base+s3Escape(name), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	return target.client.Do(request)
+}
+
+func (target *httpDeployTarget) List() (map[string]string, error) {
+	hashes := make(map[string]string)
+	response, err := target.send(http.MethodGet, deployManifestFile, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return hashes, nil
+	}
+	if response.StatusCode >= 300 {
+		return nil, fmt.Errorf("GET %s: %s", deployManifestFile, response.Status)
+	}
+	err = json.NewDecoder(response.Body).Decode(&hashes)
+	return hashes, err
+}
+
+func (target *httpDeployTarget) Hash(data []byte) string {
+	return sha256Hex(data)
+}
+
+func (target *httpDeployTarget) check(method string, name string, body []byte, header http.Header) error {
+	response, err := target.send(method, name, body, header)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+	if response.StatusCode >= 300 && !(method == http.MethodDelete && response.StatusCode == http.StatusNotFound) {
+		return fmt.Errorf("%s %s: %s", method, name, response.Status)
+	}
+	return nil
+}
+
+func (target *httpDeployTarget) Put(name string, data []byte, header http.Header) error {
+	return target.check(http.MethodPut, name, data, header)
+}
+
+func (target *httpDeployTarget) Delete(name string) error {
+	return target.check(http.MethodDelete, name, nil, nil)
+}
+
+func (target *httpDeployTarget) Finish(hashes map[string]string) error {
+	manifest, err := json.MarshalIndent(hashes, "", "  ")
+	if err != nil {
+		return err
+	}
+	return target.check(http.MethodPut, deployManifestFile, manifest, http.Header{"Content-Type": {"application/json"}})
+}
+
+func newDeployTarget(location string) (deployTarget, error) {
+	switch {
+	case strings.HasPrefix(location, "s3://"):
+		s3, err := newS3Client(location)
+		if err != nil {
+			return nil, err
+		}
+		return &s3DeployTarget{s3: s3}, nil
+	case strings.HasPrefix(location, "http://"), strings.HasPrefix(location, "https://"):
+		return &httpDeployTarget{base: strings.TrimSuffix(location, "/") + "/", client: http.DefaultClient}, nil
+	}
+	return nil, fmt.Errorf("cannot deploy to %q; use an s3:// or http(s):// URL", location)
+}
+
+// invalidationPaths returns the URL paths a CDN may have cached the files
+// names under, including the directory URLs of index pages.
+func invalidationPaths(names []string) []string {
+	var paths []string
+	for _, name := range names {
+		paths = append(paths, "/"+name)
+		if path.Base(name) == "index.html" {
+			paths = append(paths, "/"+strings.TrimSuffix(name, "index.html"))
+		}
+	}
+	return paths
+}
+
+// deploySite synchronises directory with target: new and changed files are
+// uploaded with their cache headers, files that are gone are deleted unless
+// keepRemoved is set, and the CDN is told which paths changed.
+func deploySite(directory string, target deployTarget, config deployConfig, keepRemoved bool, dryRun bool) error {
+	remote, err := target.List()
+	if err != nil {
+		return err
+	}
+
+	hashes := make(map[string]string)
+	var changed, names []string
+	unchanged := 0
+	walk(directory, func(fileName string) {
+		if err != nil {
+			return
+		}
+		name := strings.TrimPrefix(fileName, directory+"/")
+		if name == deployManifestFile {
+			return
+		}
+		names = append(names, name)
+
+		var data []byte
+		data, err = os.ReadFile(fileName)
+		if err != nil {
+			return
+		}
+		hashes[name] = target.Hash(data)
+		if remote[name] == hashes[name] {
+			unchanged++
+			return
+		}
+
+		changed = append(changed, name)
+		fmt.Printf("upload %s\n", name)
+		if dryRun {
+			return
+		}
+		header := make(http.Header)
+		if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+			header.Set("Content-Type", contentType)
+		}
+		cache, ok := config.CacheControl[path.Ext(name)]
+		if !ok {
+			cache = cacheControl("/" + name)
+		}
+		header.Set("Cache-Control", cache)
+		err = target.Put(name, data, header)
+	})
+	if err != nil {
+		return err
+	}
+
+	var removed []string
+	for name := range remote {
+		if _, ok := hashes[name]; !ok && name != deployManifestFile {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+	if keepRemoved {
+		for _, name := range removed {
+			hashes[name] = remote[name]
+		}
+		removed = nil
+	}
+	for _, name := range removed {
+		fmt.Printf("delete %s\n", name)
+		if !dryRun {
+			if err := target.Delete(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	fmt.Printf("%d uploaded, %d deleted, %d unchanged\n", len(changed), len(removed), unchanged)
+	if dryRun {
+		return nil
+	}
+	if err := target.Finish(hashes); err != nil {
+		return err
+	}
+
+	paths := invalidationPaths(append(changed, removed...))
+	if len(config.InvalidateCommand) > 0 && len(paths) > 0 {
+		invalidate := exec.Command(config.InvalidateCommand[0], append(config.InvalidateCommand[1:], paths...)...)
+		invalidate.Stdout = os.Stdout
+		invalidate.Stderr = os.Stderr
+		if err := invalidate.Run(); err != nil {
+			return fmt.Errorf("invalidating changed paths: %w", err)
+		}
+	}
+	return nil
+}
+
+// deployCommand runs `grafe deploy [target]`, which synchronises the
+// already built `public` directory with target or `deploy.target`.
+func deployCommand(project projectConfig, args []string) {
+	if len(args) > 0 && args[0] == "gh-pages" {
+		ghPagesCommand(args[1:])
+		return
+	}
+
+	flags := flag.NewFlagSet("grafe deploy", flag.ExitOnError)
+	noDeletePtr := flags.Bool("no-delete", false, "Keep files in the target that are no longer in the site.")
+	dryRunPtr := flags.Bool("dry-run", false, "Only list the files that would be uploaded and deleted.")
+	positional := parseCommandFlags(flags, args)
+
+	_, settings := readSiteConfig(project)
+	location := settings.Deploy.Target
+	if len(positional) > 0 {
+		location = positional[0]
+	}
+	if location == "" {
+		log.Fatal("usage: grafe deploy [-no-delete] [-dry-run] <s3://bucket/prefix | https://host/path>")
+	}
+	if _, err := os.Stat(outputDirectory); errors.Is(err, os.ErrNotExist) {
+		log.Fatal("There is no public directory to deploy; build the site first.")
+	}
+
+	target, err := newDeployTarget(location)
+	check(err)
+	check(deploySite(outputDirectory, target, settings.Deploy, *noDeletePtr, *dryRunPtr))
+}
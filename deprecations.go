@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template/parse"
+)
+
+// deprecatedFields are the fields of the page data that were replaced, with
+// what replaced them. They still work, so themes keep building, but every
+// use is warned about until the theme moves on.
+var deprecatedFields = map[string]string{
+	"PageParams": ".Params and the page's other fields, such as .Title and .Date",
+	"SiteParams": ".Site.Params",
+	"PagePath":   ".Section and .Slug, or .RelPermalink",
+}
+
+// warnDeprecatedFields warns about the deprecated fields each of files, the
+// layouts and includes, uses, on the line of the template it is read from.
+func warnDeprecatedFields(parsed map[string]parsedTemplateFile, files []string) {
+	for _, file := range files {
+		text := parsed[file].text
+		source := templateSource(filepath.Base(file))
+		warned := make(map[string]bool)
+		for _, tree := range parsed[file].trees {
+			walkTemplate(tree.Root, func(node parse.Node, field string) {
+				replacement, ok := deprecatedFields[field]
+				if !ok {
+					return
+				}
+				line := 1 + strings.Count(text[:node.Position()], "\n")
+				if key := fmt.Sprintf("%d %s", line, field); !warned[key] {
+					warned[key] = true
+					warnAt(source, line, ".%s is deprecated; use %s instead", field, replacement)
+				}
+			})
+		}
+	}
+}
+
+// walkTemplate calls fn with every field a template reads from its data:
+// the first of `.A.B`, the first after the variable of `$.A.B` and
+// `$page.A.B`, and the first of a field chained onto an expression.
+func walkTemplate(node parse.Node, fn func(node parse.Node, field string)) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, child := range node.Nodes {
+			walkTemplate(child, fn)
+		}
+	case *parse.ActionNode:
+		walkTemplate(node.Pipe, fn)
+	case *parse.PipeNode:
+		if node == nil {
+			return
+		}
+		for _, command := range node.Cmds {
+			walkTemplate(command, fn)
+		}
+	case *parse.CommandNode:
+		for _, arg := range node.Args {
+			walkTemplate(arg, fn)
+		}
+	case *parse.IfNode:
+		walkBranch(&node.BranchNode, fn)
+	case *parse.RangeNode:
+		walkBranch(&node.BranchNode, fn)
+	case *parse.WithNode:
+		walkBranch(&node.BranchNode, fn)
+	case *parse.TemplateNode:
+		walkTemplate(node.Pipe, fn)
+	case *parse.FieldNode:
+		fn(node, node.Ident[0])
+	case *parse.VariableNode:
+		if len(node.Ident) > 1 {
+			fn(node, node.Ident[1])
+		}
+	case *parse.ChainNode:
+		walkTemplate(node.Node, fn)
+		if len(node.Field) > 0 {
+			fn(node, node.Field[0])
+		}
+	}
+}
+
+func walkBranch(node *parse.BranchNode, fn func(node parse.Node, field string)) {
+	walkTemplate(node.Pipe, fn)
+	walkTemplate(node.List, fn)
+	walkTemplate(node.ElseList, fn)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// writeDomainFiles writes the files hosts read a site's custom domain from:
+// `CNAME` for GitHub Pages and Surge, and for Netlify, redirects from every
+// alias of the domain to the domain itself, ahead of any rules the site's
+// own `_redirects` file has.
+func (b *builder) writeDomainFiles() {
+	domain := b.settings.Domain
+	if domain == "" {
+		return
+	}
+	b.writeOutput(outputDirectory+"/CNAME", []byte(domain+"\n"))
+
+	if len(b.settings.DomainAliases) == 0 {
+		return
+	}
+	var redirects strings.Builder
+	for _, alias := range b.settings.DomainAliases {
+		for _, scheme := range []string{"http", "https"} {
+			fmt.Fprintf(&redirects, "%s://%s/* https://%s/:splat 301!\n", scheme, alias, domain)
+		}
+	}
+	// The site's rules are read from its static files rather than the
+	// output, which still holds the previous build's aliases.
+	outputPath := outputDirectory + "/_redirects"
+	existing, err := os.ReadFile(staticSource(outputPath))
+	if err != nil && !os.IsNotExist(err) {
+		check(err)
+	}
+	if b.settings.expandsTokens(outputPath) {
+		existing = b.settings.expandTokens(existing)
+	}
+	b.writeOutput(outputPath, append([]byte(redirects.String()), existing...))
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Event is the `event:` front matter of a page. Naive start and end times
+// are read in the event's timezone, or the site's when it has none.
+type Event struct {
+	Start    time.Time
+	End      time.Time
+	TimeZone string
+	Location string
+}
+
+// EventCalendar lists the pages with events in order of their start: all of
+// them, those that have not yet ended, those that have, and all of them
+// grouped by the month they start in ("2006-01").
+type EventCalendar struct {
+	All      []*Page
+	Upcoming []*Page
+	Past     []*Page
+	Months   []collectionGroup
+}
+
+type eventsConfig struct {
+	Path          string `yaml:"path"`
+	MonthTemplate string `yaml:"monthTemplate"`
+}
+
+// Ended reports whether the event is over at now. Events without an end
+// are over once they have started.
+func (event *Event) Ended(now time.Time) bool {
+	if event.End.IsZero() {
+		return !event.Start.After(now)
+	}
+	return !event.End.After(now)
+}
+
+func parseEvent(metaData map[string]interface{}, sourcePath string, location *time.Location) *Event {
+	value := frontMatterValue(metaData, "event")
+	if value == nil {
+		return nil
+	}
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		log.Fatalf("%s: event should be a map with a start, not %T\n", sourcePath, value)
+	}
+
+	event := &Event{
+		TimeZone: frontMatterString(fields, "timezone"),
+		Location: frontMatterString(fields, "location"),
+	}
+	if event.TimeZone != "" {
+		var err error
+		location, err = time.LoadLocation(event.TimeZone)
+		if err != nil {
+			log.Fatalf("%s: %v\n", sourcePath, err)
+		}
+	}
+
+	var err error
+	event.Start, err = parseFrontMatterDate(frontMatterValue(fields, "start"), location)
+	if err == nil {
+		event.End, err = parseFrontMatterDate(frontMatterValue(fields, "end"), location)
+	}
+	if err != nil {
+		log.Fatalf("%s: event: %v\n", sourcePath, err)
+	}
+	if event.Start.IsZero() {
+		log.Fatalf("%s: event has no start\n", sourcePath)
+	}
+	return event
+}
+
+func buildEventCalendar(pages []*Page, now time.Time) EventCalendar {
+	var calendar EventCalendar
+	for _, page := range pages {
+		if page.Event != nil {
+			calendar.All = append(calendar.All, page)
+		}
+	}
+	sort.SliceStable(calendar.All, func(i, j int) bool {
+		return calendar.All[i].Event.Start.Before(calendar.All[j].Event.Start)
+	})
+
+	for _, page := range calendar.All {
+		if page.Event.Ended(now) {
+			calendar.Past = append(calendar.Past, page)
+		} else {
+			calendar.Upcoming = append(calendar.Upcoming, page)
+		}
+
+		month := page.Event.Start.Format("2006-01")
+		if len(calendar.Months) == 0 || calendar.Months[len(calendar.Months)-1].Key != month {
+			calendar.Months = append(calendar.Months, collectionGroup{Key: month, Pages: []*Page{}})
+		}
+		group := &calendar.Months[len(calendar.Months)-1]
+		group.Pages = append(group.Pages.([]*Page), page)
+	}
+	return calendar
+}
+
+// generateEventPages builds a list page for every month with events, at
+// `<path>/<year>-<month>/index.html`, linked to the months before and after.
+func (b *builder) generateEventPages(pages []*Page) []*Page {
+	config := b.settings.Events
+	if config.MonthTemplate == "" {
+		return nil
+	}
+	directory := outputDirectory + "/" + strings.Trim(config.Path, "/")
+	if config.Path == "" {
+		directory = outputDirectory + "/events"
+	}
+
+	var months []*Page
+	for _, group := range buildEventCalendar(pages, b.settings.now()).Months {
+		events := group.Pages.([]*Page)
+		month := time.Date(events[0].Event.Start.Year(), events[0].Event.Start.Month(), 1, 0, 0, 0, 0, events[0].Event.Start.Location())
+		params := map[string]interface{}{"month": month, "events": events}
+		title := month.Format("January 2006")
+		page := b.newGeneratedPage("config.md", fmt.Sprintf("%s/%s/index.html", directory, group.Key), config.MonthTemplate, title, params, "")
+		page.IsList = true
+		months = append(months, page)
+	}
+	for i, page := range months {
+		if i > 0 {
+			page.Params["previous"] = months[i-1]
+		}
+		if i < len(months)-1 {
+			page.Params["next"] = months[i+1]
+		}
+	}
+	return months
+}
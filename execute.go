@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+type executeConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Timeout string `yaml:"timeout"`
+}
+
+// executedBlocks caches the output of every code block run by its language
+// and code, so that rebuilds in the development server do not rerun them.
+var executedBlocks sync.Map
+
+// executionEnvironment is the part of grafē's environment that code blocks
+// see: enough to find and run the tools, and nothing else. HOME is the
+// block's own directory, so that it does not find the user's files there,
+// and Go keeps using the user's build cache.
+func executionEnvironment(directory string) []string {
+	environment := []string{"TMPDIR=" + directory, "HOME=" + directory}
+	goCache := false
+	for _, variable := range os.Environ() {
+		name, _, _ := strings.Cut(variable, "=")
+		if name == "PATH" || name == "LANG" || strings.HasPrefix(name, "GO") {
+			environment = append(environment, variable)
+		}
+		goCache = goCache || name == "GOCACHE"
+	}
+	if cacheDirectory, err := os.UserCacheDir(); err == nil && !goCache {
+		environment = append(environment, "GOCACHE="+filepath.Join(cacheDirectory, "go-build"))
+	}
+	return environment
+}
+
+// runCodeBlock runs code as a Go program or a shell script in a temporary
+// directory, returning what it printed.
+func runCodeBlock(language string, code string, timeout time.Duration) (string, error) {
+	key := sha256.Sum256([]byte(language + "\x00" + code))
+	if output, ok := executedBlocks.Load(hex.EncodeToString(key[:])); ok {
+		return output.(string), nil
+	}
+
+	directory, err := os.MkdirTemp("", "grafe-run-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(directory)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var command *exec.Cmd
+	switch language {
+	case "go":
+		err = os.WriteFile(filepath.Join(directory, "main.go"), []byte(code), 0666)
+		if err != nil {
+			return "", err
+		}
+		command = exec.CommandContext(ctx, "go", "run", "main.go")
+	default:
+		command = exec.CommandContext(ctx, "sh", "-c", code)
+	}
+	command.Dir = directory
+	command.Env = executionEnvironment(directory)
+	// Stopping the block stops everything it started, such as the program
+	// `go run` builds, and stops waiting for output soon after.
+	killProcessGroupOnCancel(command)
+	command.WaitDelay = time.Second
+
+	var output bytes.Buffer
+	command.Stdout = &output
+	command.Stderr = &output
+	err = command.Run()
+	if ctx.Err() != nil {
+		return output.String(), fmt.Errorf("timed out after %s", timeout)
+	}
+	if err != nil {
+		return output.String(), err
+	}
+
+	executedBlocks.Store(hex.EncodeToString(key[:]), output.String())
+	return output.String(), nil
+}
+
+// executeCodeBlocks runs the code blocks of a page whose info string marks
+// them to be run, ```` ```go run ```` or ```` ```sh run ````, placing what
+// they print below them. A page with a block that fails is not built.
+func (b *builder) executeCodeBlocks(page *Page) {
+	config := b.settings.Execute
+	if !config.Enabled {
+		return
+	}
+	timeout := 10 * time.Second
+	if config.Timeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(config.Timeout)
+		if err != nil {
+			failAt("config.md", sourceLine("config.md", "timeout:"), "execute.timeout: %v", err)
+		}
+	}
+
+	var blocks []*ast.FencedCodeBlock
+	ast.Walk(page.document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if block, ok := node.(*ast.FencedCodeBlock); ok && entering && block.Info != nil {
+			info := strings.Fields(string(block.Info.Segment.Value(page.source)))
+			if len(info) >= 2 && info[1] == "run" && (info[0] == "go" || info[0] == "sh") {
+				blocks = append(blocks, block)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, block := range blocks {
+		var code strings.Builder
+		for i := 0; i < block.Lines().Len(); i++ {
+			line := block.Lines().At(i)
+			code.Write(line.Value(page.source))
+		}
+
+		output, err := runCodeBlock(string(block.Language(page.source)), code.String(), timeout)
+		if err != nil {
+			failAt(page.SourcePath, sourceLine(page.SourcePath, string(block.Info.Segment.Value(page.source))), "running a %s code block failed: %v\n%s", block.Language(page.source), err, output)
+		}
+
+		placeholder := ast.NewParagraph()
+		placeholder.AppendChild(placeholder, ast.NewString([]byte(shortcodePlaceholder(len(page.shortcodes)))))
+		block.Parent().InsertAfter(block.Parent(), block, placeholder)
+		page.shortcodes = append(page.shortcodes, `<pre class="output"><samp>`+html.EscapeString(output)+"</samp></pre>")
+	}
+}
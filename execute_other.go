@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os/exec"
+
+// killProcessGroupOnCancel leaves command to be killed alone; without
+// process groups, WaitDelay is what keeps its children from holding up the
+// build.
+func killProcessGroupOnCancel(command *exec.Cmd) {}
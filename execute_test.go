@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunCodeBlock(t *testing.T) {
+	home, _ := os.UserHomeDir()
+	tests := []struct {
+		name    string
+		code    string
+		timeout time.Duration
+		want    string
+		wantErr string
+	}{
+		{name: "output", code: "echo hello", timeout: 5 * time.Second, want: "hello\n"},
+		{name: "failure", code: "echo oops; exit 3", timeout: 5 * time.Second, want: "oops\n", wantErr: "exit status 3"},
+		{name: "timeout", code: "sleep 30", timeout: 200 * time.Millisecond, wantErr: "timed out"},
+		{name: "timeout with children holding output", code: "sleep 30 & sleep 30 & wait", timeout: 200 * time.Millisecond, wantErr: "timed out"},
+		{name: "no user home", code: `test "$HOME" != "` + home + `" && test "$HOME" = "$TMPDIR" && echo isolated`, timeout: 5 * time.Second, want: "isolated\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start := time.Now()
+			output, err := runCodeBlock("sh", test.code, test.timeout)
+			if elapsed := time.Since(start); elapsed > test.timeout+3*time.Second {
+				t.Errorf("the block ran for %s with a timeout of %s", elapsed, test.timeout)
+			}
+			if test.wantErr == "" && err != nil {
+				t.Fatalf("got error %v, output %q", err, output)
+			}
+			if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Fatalf("got error %v, want one containing %q", err, test.wantErr)
+			}
+			if test.want != "" && output != test.want {
+				t.Errorf("got output %q, want %q", output, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var cssAnyURLPattern = regexp.MustCompile(`url\(\s*(["']?)([^)"']*)(["']?)\s*\)`)
+
+// exportResolver finds the built files that URLs in the output directory
+// refer to.
+type exportResolver struct {
+	directory string
+	basePath  string
+}
+
+// file returns the path of the file url refers to when it is used from the
+// output file at from, or "" for external and inline URLs.
+func (resolver exportResolver) file(url string, from string) string {
+	if url == "" || strings.HasPrefix(url, "#") || strings.HasPrefix(url, "data:") || strings.Contains(url, "://") || strings.HasPrefix(url, "//") {
+		return ""
+	}
+	url = strings.SplitN(strings.SplitN(url, "?", 2)[0], "#", 2)[0]
+
+	var file string
+	if strings.HasPrefix(url, "/") {
+		file = path.Join(resolver.directory, strings.TrimPrefix(url, resolver.basePath))
+	} else {
+		file = path.Join(path.Dir(from), url)
+	}
+	if info, err := os.Stat(file); err == nil && info.IsDir() {
+		file = path.Join(file, "index.html")
+	}
+	if _, err := os.Stat(file); err != nil {
+		return ""
+	}
+	return file
+}
+
+func dataURI(file string) (string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	mimeType := mime.TypeByExtension(path.Ext(file))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// inlineCSS replaces the url() references in the stylesheet at from with
+// data URIs.
+func (resolver exportResolver) inlineCSS(css string, from string) string {
+	return cssAnyURLPattern.ReplaceAllStringFunc(css, func(match string) string {
+		parts := cssAnyURLPattern.FindStringSubmatch(match)
+		file := resolver.file(parts[2], from)
+		if file == "" {
+			return match
+		}
+		uri, err := dataURI(file)
+		if err != nil {
+			return match
+		}
+		return `url("` + uri + `")`
+	})
+}
+
+func nodeAttribute(node *html.Node, name string) string {
+	for _, attribute := range node.Attr {
+		if attribute.Key == name {
+			return attribute.Val
+		}
+	}
+	return ""
+}
+
+func setNodeAttribute(node *html.Node, name string, value string) {
+	for i, attribute := range node.Attr {
+		if attribute.Key == name {
+			node.Attr[i].Val = value
+			return
+		}
+	}
+	node.Attr = append(node.Attr, html.Attribute{Key: name, Val: value})
+}
+
+func removeNodeAttribute(node *html.Node, name string) {
+	attributes := node.Attr[:0]
+	for _, attribute := range node.Attr {
+		if attribute.Key != name {
+			attributes = append(attributes, attribute)
+		}
+	}
+	node.Attr = attributes
+}
+
+// inlineNode replaces references to stylesheets, scripts, and images below
+// node with their content, and returns the nodes to drop from the tree.
+func (resolver exportResolver) inlineNode(node *html.Node, from string) []*html.Node {
+	var dropped []*html.Node
+	if node.Type == html.ElementNode {
+		switch node.DataAtom {
+		case atom.Link:
+			file := resolver.file(nodeAttribute(node, "href"), from)
+			if file == "" {
+				break
+			}
+			if strings.Contains(nodeAttribute(node, "rel"), "stylesheet") {
+				css, err := os.ReadFile(file)
+				check(err)
+				style := &html.Node{Type: html.ElementNode, Data: "style", DataAtom: atom.Style}
+				style.AppendChild(&html.Node{Type: html.TextNode, Data: resolver.inlineCSS(string(css), file)})
+				node.Parent.InsertBefore(style, node)
+				dropped = append(dropped, node)
+			} else if uri, err := dataURI(file); err == nil {
+				setNodeAttribute(node, "href", uri)
+			}
+		case atom.Script:
+			file := resolver.file(nodeAttribute(node, "src"), from)
+			if file == "" {
+				break
+			}
+			script, err := os.ReadFile(file)
+			check(err)
+			removeNodeAttribute(node, "src")
+			node.AppendChild(&html.Node{Type: html.TextNode, Data: strings.ReplaceAll(string(script), "</script", `<\/script`)})
+		case atom.Img, atom.Video, atom.Audio:
+			for _, name := range []string{"src", "poster"} {
+				if file := resolver.file(nodeAttribute(node, name), from); file != "" {
+					uri, err := dataURI(file)
+					check(err)
+					setNodeAttribute(node, name, uri)
+				}
+			}
+			removeNodeAttribute(node, "srcset")
+			removeNodeAttribute(node, "loading")
+		case atom.Source:
+			// Inside <picture>, the inlined <img> is enough; other sources
+			// would only add copies of the same image in other sizes.
+			if node.Parent != nil && node.Parent.DataAtom == atom.Picture {
+				dropped = append(dropped, node)
+			}
+		}
+		if style := nodeAttribute(node, "style"); style != "" {
+			setNodeAttribute(node, "style", resolver.inlineCSS(style, from))
+		}
+	}
+	if node.Type == html.ElementNode && node.DataAtom == atom.Style && node.FirstChild != nil {
+		node.FirstChild.Data = resolver.inlineCSS(node.FirstChild.Data, from)
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		dropped = append(dropped, resolver.inlineNode(child, from)...)
+	}
+	return dropped
+}
+
+// exportSingleFile returns the built page at outputFile with its
+// stylesheets, scripts, and images inlined.
+func exportSingleFile(outputFile string, resolver exportResolver) ([]byte, error) {
+	page, err := os.ReadFile(outputFile)
+	if err != nil {
+		return nil, err
+	}
+	document, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, node := range resolver.inlineNode(document, outputFile) {
+		node.Parent.RemoveChild(node)
+	}
+
+	var buf bytes.Buffer
+	err = html.Render(&buf, document)
+	return buf.Bytes(), err
+}
+
+// exportCommand runs `grafe export`, which repackages the built site or its
+// content.
+func exportCommand(project projectConfig, args []string) {
+	flags := flag.NewFlagSet("grafe export", flag.ExitOnError)
+	singleFilePtr := flags.String("single-file", "", "Content file, such as `content/post.md`, to export as one self-contained HTML file.")
+	markdownPtr := flags.String("markdown", "", "Export the content as a portable Markdown bundle to this directory or .zip, .tar, or .tar.gz archive.")
+	warcPtr := flags.String("warc", "", "Archive the built site to this .warc or .warc.gz file, every file as served from its URL.")
+	outputPtr := flags.String("o", "", "File to write the export to; defaults to the page's name in the current directory.")
+	parseCommandFlagsOnly(flags, args)
+
+	_, settings := readSiteConfig(project)
+	if *markdownPtr != "" {
+		artifacts := newArtifactStore("public-generator")
+		artifacts.Prune()
+		artifacts.CopyDirectory(themeDirectory+"/templates", "templates")
+		artifacts.CopyDirectory("templates", "templates")
+		shortcodeTemplates := generateShortcodeTemplates(artifacts, "templates")
+		artifacts.Prune()
+		checkErrors(false)
+
+		target, err := newBundleTarget(*markdownPtr)
+		check(err)
+		check(exportMarkdownBundle(target, shortcodeTemplates, &settings))
+		fmt.Printf("Exported content to %s\n", *markdownPtr)
+		return
+	}
+	if *warcPtr != "" {
+		if settings.BaseURL == "" {
+			log.Fatal("-warc needs a baseURL to archive the site's files at.")
+		}
+		if _, err := os.Stat(outputDirectory); err != nil {
+			log.Fatalf("%s does not exist; build the site first.\n", outputDirectory)
+		}
+		count, err := exportWARC(*warcPtr, settings, time.Now())
+		check(err)
+		fmt.Printf("Archived %d files to %s\n", count, *warcPtr)
+		return
+	}
+	if *singleFilePtr == "" {
+		log.Fatal("usage: grafe export -single-file <content file> [-o <file>] | -markdown <directory or archive> | -warc <archive>")
+	}
+
+	contentPath := strings.TrimPrefix(filepath.ToSlash(filepath.Clean(*singleFilePtr)), contentDirectory+"/")
+	data, err := os.ReadFile(contentDirectory + "/" + contentPath)
+	check(err)
+	metaData, _, err := splitFrontMatter(string(data))
+	if err != nil {
+		log.Fatalf("%s: %v\n", *singleFilePtr, err)
+	}
+	outputFile := settings.overridePath(settings.parseContentPath(contentPath), contentPath, metaData, *singleFilePtr).outputPath
+	if _, err := os.Stat(outputFile); err != nil {
+		log.Fatalf("%s has not been built to %s; build the site first.\n", *singleFilePtr, outputFile)
+	}
+
+	exported, err := exportSingleFile(outputFile, exportResolver{directory: outputDirectory, basePath: settings.BasePath})
+	check(err)
+
+	output := *outputPtr
+	if output == "" {
+		output = strings.ReplaceAll(removeExtension(contentPath), "/", "-") + ".html"
+	}
+	err = os.WriteFile(output, exported, 0666)
+	check(err)
+	fmt.Printf("Exported %s to %s\n", *singleFilePtr, output)
+}
+
+var exportWikilinkPattern = regexp.MustCompile(`(!?)\[\[([^\]|#]*)(#[^\]|]*)?(?:\|([^\]]*))?\]\]`)
+
+// markdownLinks rewrites the wikilinks in the content file at contentPath
+// as Markdown links relative to it, resolving targets from the content root
+// like the site does.
+func markdownLinks(source string, contentPath string) string {
+	return exportWikilinkPattern.ReplaceAllStringFunc(source, func(match string) string {
+		parts := exportWikilinkPattern.FindStringSubmatch(match)
+		embed, target, fragment, label := parts[1], strings.TrimSpace(parts[2]), parts[3], parts[4]
+
+		destination := ""
+		if target != "" {
+			target = strings.TrimPrefix(target, "/")
+			if path.Ext(target) == "" {
+				target += ".md"
+			}
+			relative, err := filepath.Rel(filepath.Dir(contentPath), target)
+			check(err)
+			destination = filepath.ToSlash(relative)
+		}
+		destination += fragment
+		if label == "" {
+			label = strings.TrimPrefix(parts[2]+fragment, "#")
+		}
+		if strings.ContainsAny(destination, " ()") {
+			destination = "<" + destination + ">"
+		}
+		return embed + "[" + label + "](" + destination + ")"
+	})
+}
+
+// exportMarkdownBundle writes the content directory to target with every
+// shortcode expanded and every wikilink turned into a relative Markdown
+// link, so that it reads the same in any Markdown tool.
+func exportMarkdownBundle(target outputTarget, shortcodeTemplates map[string]*template.Template, settings *siteConfig) error {
+	var err error
+	walk(contentDirectory, func(fileName string) {
+		if err != nil || strings.Contains(fileName, "/.git") {
+			return
+		}
+		contentPath := strings.TrimPrefix(fileName, contentDirectory+"/")
+
+		var data []byte
+		data, err = os.ReadFile(fileName)
+		if err != nil {
+			return
+		}
+		if getExtension(fileName) == ".md" {
+			var source string
+			var shortcodes []string
+			source, shortcodes, err = expandShortcodes(string(data), fileName, shortcodeTemplates, nil, settings)
+			if err != nil {
+				return
+			}
+			data = []byte(markdownLinks(restoreShortcodes(source, shortcodes), contentPath))
+		}
+		err = target.WriteFile(contentPath, data)
+	})
+	if err != nil {
+		target.Close()
+		return err
+	}
+	return target.Close()
+}
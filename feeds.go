@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/xml"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed outputs/*
+var builtinOutputTemplates embed.FS
+
+var defaultOutputs = map[string]string{
+	"rss":     "index.xml",
+	"sitemap": "sitemap.xml",
+}
+
+// feedOutputs are the outputs that are also written for every section when
+// feeds.sections is set.
+var feedOutputs = []string{"atom", "rss"}
+
+type feedsConfig struct {
+	Sections bool `yaml:"sections"`
+}
+
+// outputData is what output templates are executed with: the site, the
+// pages and list pages the output covers, the output's own absolute URL,
+// and the URL of the page it is the feed of. Section feeds also have the
+// section's name.
+type outputData struct {
+	Site      *Site
+	Pages     []*Page
+	ListPages []*Page
+	URL       string
+	Link      string
+	Section   string
+}
+
+func indexablePages(pages []*Page) []*Page {
+	var indexable []*Page
+	for _, page := range pages {
+		if !page.Noindex {
+			indexable = append(indexable, page)
+		}
+	}
+	return indexable
+}
+
+func xmlEscape(value interface{}) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	err := xml.EscapeText(&buf, []byte(fmt.Sprint(value)))
+	return buf.String(), err
+}
+
+func outputFuncMap() texttemplate.FuncMap {
+	funcs := texttemplate.FuncMap(templateFuncMap())
+	funcs["xml"] = xmlEscape
+	return funcs
+}
+
+func siteOutputFuncMap(site *Site) texttemplate.FuncMap {
+	return texttemplate.FuncMap{
+		"relURL": site.settings.sitePath,
+		"absURL": site.settings.siteURL,
+		"now": func() time.Time {
+			return site.Now
+		},
+	}
+}
+
+// generateOutputTemplates parses the built-in XML output templates and any
+// of the same name in the `outputs` template directory, which replace them.
+func generateOutputTemplates(store *artifactStore, directory string) map[string]*texttemplate.Template {
+	outputTemplates := make(map[string]*texttemplate.Template)
+
+	builtins, err := fs.Glob(builtinOutputTemplates, "outputs/*")
+	check(err)
+	for _, file := range builtins {
+		text, err := builtinOutputTemplates.ReadFile(file)
+		check(err)
+		name := removeExtension(path.Base(file))
+		outputTemplates[name] = texttemplate.Must(texttemplate.New(name).Funcs(outputFuncMap()).Parse(string(text)))
+	}
+
+	files, err := store.Glob(directory + "/outputs/*")
+	check(err)
+	for _, file := range files {
+		text, err := store.ReadFile(file)
+		check(err)
+		name := removeExtension(path.Base(file))
+		guardFile(func() {
+			outputTemplate, err := texttemplate.New(name).Funcs(outputFuncMap()).Parse(string(text))
+			checkTemplateParse(templateSource(path.Base(file)), err)
+			outputTemplates[name] = outputTemplate
+		})
+	}
+
+	return outputTemplates
+}
+
+// outputs returns the outputs to write, by default those of sites with a
+// baseURL.
+func (settings siteConfig) outputs() map[string]string {
+	if settings.Outputs == nil && settings.BaseURL != "" {
+		return defaultOutputs
+	}
+	return settings.Outputs
+}
+
+// renderOutputs writes every configured output, such as the RSS feed and
+// the sitemap, from its template. Without an `outputs` setting, sites with
+// a baseURL get both at their usual paths. With feeds.sections, the RSS and
+// Atom feeds are also written for each section, as `posts/index.xml`.
+func (b *builder) renderOutputs(site *Site) {
+	outputs := b.settings.outputs()
+	if _, ok := outputs["sitemap"]; ok && b.settings.BaseURL == "" {
+		warnf("the sitemap needs a baseURL in the configuration for its URLs to be absolute")
+	}
+
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		b.renderOutput(site, name, outputs[name], outputData{
+			Site:      site,
+			Pages:     indexablePages(site.Pages),
+			ListPages: indexablePages(site.ListPages),
+			Link:      b.settings.siteURL("/"),
+		})
+	}
+
+	if !b.settings.Feeds.Sections {
+		return
+	}
+	sections := make([]string, 0, len(site.Sections))
+	for section := range site.Sections {
+		if section != "" {
+			sections = append(sections, section)
+		}
+	}
+	sort.Strings(sections)
+	for _, name := range feedOutputs {
+		if _, ok := outputs[name]; !ok {
+			continue
+		}
+		for _, section := range sections {
+			link := b.settings.siteURL("/" + section + "/")
+			var listPages []*Page
+			for _, page := range site.ListPages {
+				if page.SourcePath == contentDirectory+"/"+section+"/_index.md" {
+					link = page.Permalink
+					listPages = append(listPages, page)
+				}
+			}
+			b.renderOutput(site, name, section+"/"+path.Base(outputs[name]), outputData{
+				Site:      site,
+				Pages:     indexablePages(site.Sections[section]),
+				ListPages: indexablePages(listPages),
+				Link:      link,
+				Section:   section,
+			})
+		}
+	}
+}
+
+// renderOutput writes the output template name to outputURL, a path from
+// the root of the site, with data.
+func (b *builder) renderOutput(site *Site, name string, outputURL string, data outputData) {
+	outputTemplate, ok := b.outputTemplates[name]
+	if !ok {
+		check(fmt.Errorf("no output template named %q exists", name))
+	}
+	outputTemplate, err := outputTemplate.Clone()
+	check(err)
+	outputTemplate.Funcs(siteOutputFuncMap(site))
+
+	outputPath := outputDirectory + "/" + path.Clean("/" + outputURL)[1:]
+	data.URL = b.settings.siteURL(outputURL)
+
+	var buf bytes.Buffer
+	err = outputTemplate.Execute(&buf, data)
+	check(err)
+	b.writeOutput(outputPath, buf.Bytes())
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// fingerprints are the copies of the site's static files that templates
+// link to with `fingerprint`, named with a hash of their content so that
+// browsers fetch them again once they change, by the file they copy. Each
+// file is hashed once a build.
+type fingerprints struct {
+	mutex    sync.Mutex
+	settings siteConfig
+	minify   bool
+	files    map[string]fingerprintedFile
+}
+
+type fingerprintedFile struct {
+	url        string
+	integrity  string
+	outputPath string
+}
+
+func newFingerprints(settings siteConfig, minify bool) *fingerprints {
+	return &fingerprints{settings: settings, minify: minify, files: make(map[string]fingerprintedFile)}
+}
+
+// file copies the file at name, relative to the root of the output, to
+// where its name has the hash of its content, such as js/app.3f9a1c2e4b7d.js,
+// unless it has been already. Files that are minified are minified first,
+// so that the hash is that of what is served.
+func (fingerprints *fingerprints) file(name string) (fingerprintedFile, error) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	fingerprints.mutex.Lock()
+	defer fingerprints.mutex.Unlock()
+	if file, ok := fingerprints.files[name]; ok {
+		return file, nil
+	}
+
+	data, err := os.ReadFile(outputDirectory + "/" + name)
+	if err != nil {
+		return fingerprintedFile{}, fmt.Errorf("%s is not a static file of the site", name)
+	}
+	if minify := minifierFor(name); fingerprints.minify && minify != nil {
+		data = minify(data)
+	}
+	sum := sha256.Sum256(data)
+	extension := path.Ext(name)
+	fingerprinted := strings.TrimSuffix(name, extension) + "." + hex.EncodeToString(sum[:6]) + extension
+	outputPath := outputDirectory + "/" + fingerprinted
+	check(os.WriteFile(outputPath, data, 0666))
+
+	integrity := sha512.Sum384(data)
+	file := fingerprintedFile{
+		url:        fingerprints.settings.sitePath("/" + fingerprinted),
+		integrity:  "sha384-" + base64.StdEncoding.EncodeToString(integrity[:]),
+		outputPath: outputPath,
+	}
+	fingerprints.files[name] = file
+	return file, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// formConfig says where a form is submitted: to Netlify Forms, which reads
+// the form from the built page, to Formspree, whose form ID is the
+// endpoint, or to any other endpoint. Success is the page visitors are sent
+// to after submitting, and Honeypot the name of the hidden field that only
+// bots fill in.
+type formConfig struct {
+	Backend  string `yaml:"backend"`
+	Endpoint string `yaml:"endpoint"`
+	Success  string `yaml:"success"`
+	Honeypot string `yaml:"honeypot"`
+}
+
+var defaultFormFields = []string{"name", "email", "message"}
+
+// renderForm renders the configured form called name. Its fields are
+// inner's HTML if given, and otherwise a labelled input for each of fields:
+// `email` is an email address and `message` a text area.
+func renderForm(settings *siteConfig, name string, fields []string, inner string, submit string) (string, error) {
+	if settings == nil {
+		return "", fmt.Errorf("forms need the site configuration")
+	}
+	config, ok := settings.Forms[name]
+	if !ok {
+		return "", fmt.Errorf("no form named %q is configured in forms", name)
+	}
+
+	success := ""
+	if config.Success != "" {
+		success = config.Success
+		if strings.HasPrefix(success, "/") {
+			success = settings.siteURL(success)
+		}
+	}
+
+	attributes := fmt.Sprintf(` name="%s" method="POST"`, html.EscapeString(name))
+	var hidden []string
+	honeypot := config.Honeypot
+	switch config.Backend {
+	case "netlify":
+		if honeypot == "" {
+			honeypot = "bot-field"
+		}
+		if config.Success != "" {
+			attributes += fmt.Sprintf(` action="%s"`, html.EscapeString(settings.sitePath(config.Success)))
+		}
+		attributes += fmt.Sprintf(` data-netlify="true" netlify-honeypot="%s"`, html.EscapeString(honeypot))
+		hidden = append(hidden, formHiddenInput("form-name", name))
+	case "formspree":
+		if config.Endpoint == "" {
+			return "", fmt.Errorf("form %q needs the endpoint, or form ID, Formspree gave it", name)
+		}
+		action := config.Endpoint
+		if !strings.Contains(action, "://") {
+			action = "https://formspree.io/f/" + action
+		}
+		if honeypot == "" {
+			honeypot = "_gotcha"
+		}
+		attributes += fmt.Sprintf(` action="%s"`, html.EscapeString(action))
+		if success != "" {
+			hidden = append(hidden, formHiddenInput("_next", success))
+		}
+	case "", "custom":
+		if config.Endpoint == "" {
+			return "", fmt.Errorf("form %q needs an endpoint", name)
+		}
+		if honeypot == "" {
+			honeypot = "bot-field"
+		}
+		attributes += fmt.Sprintf(` action="%s"`, html.EscapeString(config.Endpoint))
+		if success != "" {
+			hidden = append(hidden, formHiddenInput("_next", success))
+		}
+	default:
+		return "", fmt.Errorf("form %q has unknown backend %q; expected netlify, formspree, or custom", name, config.Backend)
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "<form%s>\n", attributes)
+	for _, input := range hidden {
+		out.WriteString(input + "\n")
+	}
+	fmt.Fprintf(&out, "<p hidden><label>Leave this empty: <input name=\"%s\" tabindex=\"-1\" autocomplete=\"off\"></label></p>\n", html.EscapeString(honeypot))
+	if strings.TrimSpace(inner) != "" {
+		out.WriteString(strings.TrimSpace(inner) + "\n")
+	} else {
+		if len(fields) == 0 {
+			fields = defaultFormFields
+		}
+		for _, field := range fields {
+			out.WriteString(formField(field) + "\n")
+		}
+	}
+	if submit == "" {
+		submit = "Send"
+	}
+	fmt.Fprintf(&out, "<p><button type=\"submit\">%s</button></p>\n</form>", html.EscapeString(submit))
+	return out.String(), nil
+}
+
+func formHiddenInput(name string, value string) string {
+	return fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`, html.EscapeString(name), html.EscapeString(value))
+}
+
+func formField(field string) string {
+	name := html.EscapeString(field)
+	label := html.EscapeString(strings.ToUpper(field[:1]) + strings.ReplaceAll(field[1:], "-", " "))
+	switch field {
+	case "message":
+		return fmt.Sprintf(`<p><label>%s <textarea name="%s" required></textarea></label></p>`, label, name)
+	case "email":
+		return fmt.Sprintf(`<p><label>%s <input type="email" name="%s" required></label></p>`, label, name)
+	}
+	return fmt.Sprintf(`<p><label>%s <input type="text" name="%s" required></label></p>`, label, name)
+}
+
+// formShortcode renders `{{< form name="contact" fields="name email message" >}}`,
+// or the form around the fields it wraps.
+func formShortcode(call shortcodeCall) (string, error) {
+	name := call.ArgOr("name", strings.Join(call.Positional, ""))
+	if name == "" {
+		return "", fmt.Errorf("missing name")
+	}
+	return renderForm(call.settings, name, strings.Fields(call.Arg("fields")), call.Inner, call.Arg("submit"))
+}
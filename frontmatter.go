@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+var frontMatterPattern = regexp.MustCompile(`(?s)\A---\r?\n(.*?)\r?\n---(?:\r?\n|\z)`)
+
+var tomlFrontMatterPattern = regexp.MustCompile(`(?s)\A\+\+\+\r?\n(.*?)\r?\n\+\+\+(?:\r?\n|\z)`)
+
+// frontMatterBlock finds the front matter at the start of text: YAML
+// between `---` lines, TOML between `+++` lines, or a JSON object. It
+// returns its format, which is "" if text has none, its source, and the
+// text after it.
+func frontMatterBlock(text string) (string, string, string) {
+	if match := frontMatterPattern.FindStringSubmatchIndex(text); match != nil {
+		return "yaml", text[match[2]:match[3]], text[match[1]:]
+	}
+	if match := tomlFrontMatterPattern.FindStringSubmatchIndex(text); match != nil {
+		return "toml", text[match[2]:match[3]], text[match[1]:]
+	}
+	if strings.HasPrefix(text, "{") {
+		decoder := json.NewDecoder(strings.NewReader(text))
+		var object json.RawMessage
+		if err := decoder.Decode(&object); err == nil {
+			rest := text[decoder.InputOffset():]
+			rest = strings.TrimPrefix(strings.TrimPrefix(rest, "\r"), "\n")
+			return "json", string(object), rest
+		}
+	}
+	return "", "", text
+}
+
+func unmarshalFrontMatter(format string, source string) (map[string]interface{}, error) {
+	var metaData map[string]interface{}
+	var err error
+	switch format {
+	case "yaml":
+		err = yaml.Unmarshal([]byte(source), &metaData)
+	case "toml":
+		err = toml.Unmarshal([]byte(source), &metaData)
+		if err == nil {
+			metaData = tomlLocalTimes(metaData).(map[string]interface{})
+		}
+	case "json":
+		err = json.Unmarshal([]byte(source), &metaData)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s front matter: %w", strings.ToUpper(format), err)
+	}
+	return normalizeFrontMatterMap(metaData), nil
+}
+
+// tomlLocalTimes writes TOML's dates and times without a zone as text, as
+// YAML keeps them, so that they are read in the site's time zone rather
+// than the computer's.
+func tomlLocalTimes(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, item := range value {
+			value[key] = tomlLocalTimes(item)
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = tomlLocalTimes(item)
+		}
+	case []map[string]interface{}:
+		for _, item := range value {
+			tomlLocalTimes(item)
+		}
+	case time.Time:
+		switch value.Location().String() {
+		case "date-local":
+			return value.Format("2006-01-02")
+		case "datetime-local":
+			return value.Format("2006-01-02T15:04:05.999999999")
+		case "time-local":
+			return value.Format("15:04:05.999999999")
+		}
+	}
+	return value
+}
+
+// yamlFrontMatter rewrites TOML and JSON front matter of a content file as
+// YAML, which the Markdown parser reads, so that every format ends up in the
+// same metadata.
+func yamlFrontMatter(data []byte) ([]byte, error) {
+	format, source, rest := frontMatterBlock(string(data))
+	if format != "toml" && format != "json" {
+		return data, nil
+	}
+	metaData, err := unmarshalFrontMatter(format, source)
+	if err != nil {
+		return nil, err
+	}
+	marshalled, err := yaml.Marshal(metaData)
+	if err != nil {
+		return nil, err
+	}
+	return []byte("---\n" + string(marshalled) + "---\n" + rest), nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/sprig/v3"
+	"github.com/spf13/cast"
+)
+
+// templateFuncMap returns the functions available to every template:
+// sprig's, grafe's own, and the page functions, bound to empty settings
+// until renderPage binds them to the page being rendered, or
+// renderShortcode to the site's settings.
+func templateFuncMap() template.FuncMap {
+	funcs := sprig.FuncMap()
+	funcs["toInt"] = cast.ToInt
+	funcs["toBool"] = cast.ToBool
+	funcs["toSlice"] = cast.ToSlice
+	funcs["where"] = where
+	funcs["sort"] = sortCollection
+	funcs["groupBy"] = groupBy
+	funcs["first"] = first
+	funcs["query"] = querySite
+	funcs["debug"] = debug
+	funcs["jsonify"] = jsonify
+	funcs["logf"] = logf
+	funcs["imagePlaceholder"] = placeholderFunc
+	for name, function := range siteFuncMap(&siteConfig{}, "") {
+		funcs[name] = function
+	}
+	return funcs
+}
+
+// siteFuncMap binds the functions of pageFuncMap to the site's settings
+// alone, for shortcode templates, which run while the page they are in is
+// read. Those that need the page or the whole site fail.
+func siteFuncMap(settings *siteConfig, sourcePath string) template.FuncMap {
+	unavailable := func(name string) error {
+		return fmt.Errorf("%s needs the page and cannot be used in a shortcode", name)
+	}
+	return template.FuncMap{
+		"partial": func(name string, data interface{}) (template.HTML, error) {
+			return "", unavailable("partial")
+		},
+		"param": func(key string, fallback ...interface{}) (interface{}, error) {
+			return nil, unavailable("param")
+		},
+		"now": func() time.Time {
+			if settings.location == nil {
+				return time.Now()
+			}
+			return settings.now()
+		},
+		"relURL": func(path string) string {
+			return settings.sitePath(path)
+		},
+		"absURL": func(path string) string {
+			return settings.siteURL(path)
+		},
+		"fingerprint": func(name string) (string, error) {
+			return "", unavailable("fingerprint")
+		},
+		"integrity": func(name string) (string, error) {
+			return "", unavailable("integrity")
+		},
+		"responsiveImage": func(src string, alt string, sizes ...string) (template.HTML, error) {
+			return responsiveImageHTML(src, alt, sizes, sourcePath, *settings)
+		},
+		"form": func(name string, fields ...string) (template.HTML, error) {
+			form, err := renderForm(settings, name, fields, "", "")
+			return template.HTML(form), err
+		},
+	}
+}
+
+func pageFuncMap(page *Page, pageTemplate *template.Template, metrics *templateMetrics) template.FuncMap {
+	return template.FuncMap{
+		"partial": func(name string, data interface{}) (template.HTML, error) {
+			return executePartial(pageTemplate, metrics, name, data)
+		},
+		"param": func(key string, fallback ...interface{}) interface{} {
+			return page.Param(key, fallback...)
+		},
+		"now": func() time.Time {
+			if page == nil {
+				return time.Now()
+			}
+			return page.Site.Now
+		},
+		"relURL": func(path string) string {
+			return page.Site.settings.sitePath(path)
+		},
+		"absURL": func(path string) string {
+			return page.Site.settings.siteURL(path)
+		},
+		"fingerprint": func(name string) (string, error) {
+			file, err := page.Site.fingerprints.file(name)
+			recordOutputFor(page.SourcePath, file.outputPath)
+			return file.url, err
+		},
+		"integrity": func(name string) (string, error) {
+			file, err := page.Site.fingerprints.file(name)
+			recordOutputFor(page.SourcePath, file.outputPath)
+			return file.integrity, err
+		},
+		"responsiveImage": func(src string, alt string, sizes ...string) (template.HTML, error) {
+			return responsiveImageHTML(src, alt, sizes, page.SourcePath, page.Site.settings)
+		},
+		"form": func(name string, fields ...string) (template.HTML, error) {
+			form, err := renderForm(&page.Site.settings, name, fields, "", "")
+			return template.HTML(form), err
+		},
+	}
+}
+
+// lowercaseKeys returns params with every top-level key in lower case, so
+// that `HeroImage:` and `heroimage:` in front matter are the same param.
+func lowercaseKeys(params map[string]interface{}) map[string]interface{} {
+	lowercased := make(map[string]interface{}, len(params))
+	for key, value := range params {
+		lowercased[strings.ToLower(key)] = value
+	}
+	return lowercased
+}
+
+// lookupParam resolves a dotted key such as "social.twitter" in params,
+// ignoring case at every level.
+func lookupParam(params interface{}, key string) (interface{}, bool) {
+	value := params
+	for _, part := range strings.Split(key, ".") {
+		found := false
+		switch current := value.(type) {
+		case map[string]interface{}:
+			for name, item := range current {
+				if strings.EqualFold(name, part) {
+					value, found = item, true
+					break
+				}
+			}
+		case map[interface{}]interface{}:
+			for name, item := range current {
+				if name, ok := name.(string); ok && strings.EqualFold(name, part) {
+					value, found = item, true
+					break
+				}
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// Param returns the page param named key, falling back to the site param
+// of the same name and then to fallback.
+func (page *Page) Param(key string, fallback ...interface{}) interface{} {
+	if page != nil {
+		if value, ok := lookupParam(page.Params, key); ok && value != nil {
+			return value
+		}
+		if page.Site != nil {
+			if value, ok := lookupParam(page.Site.Params, key); ok && value != nil {
+				return value
+			}
+		}
+	}
+	if len(fallback) > 0 {
+		return fallback[0]
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func git(directory string, args ...string) (string, error) {
+	command := exec.Command("git", args...)
+	command.Dir = directory
+	var stderr bytes.Buffer
+	command.Stderr = &stderr
+	output, err := command.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// replaceDirectoryContents empties destination, except for its .git entry,
+// and copies source into it along with the .nojekyll file GitHub Pages
+// needs.
+func replaceDirectoryContents(source string, destination string) error {
+	entries, err := os.ReadDir(destination)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() == ".git" {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(destination, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	copyTree(source, destination)
+	return os.WriteFile(destination+"/.nojekyll", nil, 0666)
+}
+
+func deployMessage() string {
+	message := "Deploy site"
+	if revision, err := git(".", "rev-parse", "--short", "HEAD"); err == nil {
+		message += " from " + revision
+	}
+	return message + " at " + time.Now().UTC().Format(time.RFC3339)
+}
+
+// commitAll commits every change in the work tree at directory, limited to
+// paths if any are given, and reports whether there was anything to commit.
+func commitAll(directory string, message string, paths ...string) (bool, error) {
+	if _, err := git(directory, append([]string{"add", "-A", "--"}, paths...)...); err != nil {
+		return false, err
+	}
+	if _, err := git(directory, append([]string{"diff", "--cached", "--quiet", "--"}, paths...)...); err == nil {
+		return false, nil
+	}
+	_, err := git(directory, "commit", "-m", message)
+	return err == nil, err
+}
+
+// publishToBranch commits directory as the whole content of branch, using a
+// temporary work tree so the current checkout is left alone.
+func publishToBranch(directory string, branch string, message string) (bool, error) {
+	worktree, err := os.MkdirTemp("", "grafe-gh-pages-")
+	if err != nil {
+		return false, err
+	}
+	os.Remove(worktree)
+	if _, err := git(".", "worktree", "add", "--detach", worktree); err != nil {
+		return false, err
+	}
+	defer git(".", "worktree", "remove", "--force", worktree)
+
+	if _, err := git(".", "rev-parse", "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+		_, err = git(worktree, "checkout", branch)
+		if err != nil {
+			return false, err
+		}
+	} else if _, err := git(".", "rev-parse", "--verify", "--quiet", "refs/remotes/origin/"+branch); err == nil {
+		_, err = git(worktree, "checkout", "-b", branch, "origin/"+branch)
+		if err != nil {
+			return false, err
+		}
+	} else {
+		_, err = git(worktree, "checkout", "--orphan", branch)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	absolute, err := filepath.Abs(directory)
+	if err != nil {
+		return false, err
+	}
+	if err := replaceDirectoryContents(filepath.ToSlash(absolute), worktree); err != nil {
+		return false, err
+	}
+	return commitAll(worktree, message)
+}
+
+// ghPagesCommand runs `grafe deploy gh-pages`, which commits the built site
+// to the gh-pages branch, or to a folder of the current branch with
+// `-folder docs`, ready for GitHub Pages to serve.
+func ghPagesCommand(args []string) {
+	flags := flag.NewFlagSet("grafe deploy gh-pages", flag.ExitOnError)
+	branchPtr := flags.String("branch", "gh-pages", "Branch to commit the site to.")
+	folderPtr := flags.String("folder", "", "Commit the site to this folder of the current branch instead, such as `docs`.")
+	messagePtr := flags.String("message", "", "Commit message; defaults to one naming the source revision and time.")
+	pushPtr := flags.Bool("push", false, "Push the commit to the origin remote.")
+	parseCommandFlagsOnly(flags, args)
+
+	if _, err := os.Stat(outputDirectory); os.IsNotExist(err) {
+		log.Fatal("There is no public directory to deploy; build the site first.")
+	}
+
+	message := *messagePtr
+	if message == "" {
+		message = deployMessage()
+	}
+
+	var committed bool
+	var err error
+	if *folderPtr != "" {
+		folder := filepath.ToSlash(filepath.Clean(*folderPtr))
+		check(replaceDirectoryContents(outputDirectory, folder))
+		committed, err = commitAll(".", message, folder)
+	} else {
+		committed, err = publishToBranch(outputDirectory, *branchPtr, message)
+	}
+	check(err)
+
+	if !committed {
+		fmt.Println("The published site is already up to date.")
+		return
+	}
+	fmt.Println(message)
+
+	if *pushPtr {
+		branch := *branchPtr
+		if *folderPtr != "" {
+			branch, err = git(".", "rev-parse", "--abbrev-ref", "HEAD")
+			check(err)
+		}
+		_, err = git(".", "push", "origin", branch)
+		check(err)
+	}
+}
@@ -7,33 +7,13 @@ import (
 	"html/template"
 	"io"
 	"log"
-	"net/http"
 	"os"
-	"os/signal"
 	"path/filepath"
 	"strings"
-	"sync"
-	"syscall"
-
-	"github.com/Masterminds/sprig/v3"
 
 	"github.com/yuin/goldmark"
 	meta "github.com/yuin/goldmark-meta"
-	"github.com/yuin/goldmark/extension"
 	"github.com/yuin/goldmark/parser"
-	"github.com/yuin/goldmark/renderer"
-	"github.com/yuin/goldmark/renderer/html"
-	"github.com/yuin/goldmark/util"
-
-	fences "github.com/stefanfritsch/goldmark-fences"
-
-	wikitable "github.com/movsb/goldmark-wiki-table"
-
-	"go.abhg.dev/goldmark/wikilink"
-
-	mathjax "github.com/litao91/goldmark-mathjax"
-
-	"github.com/clarkmcc/go-typescript"
 )
 
 func check(err error) {
@@ -91,118 +71,56 @@ func copyFile(sourcePath string, destinationPath string) {
 	check(err)
 }
 
-func generateHtmlFile(templates map[string]*template.Template, markdownWriter goldmark.Markdown, sourceMd string, outputFile string, config map[string]interface{}, pagePath []string) {
-	var buf bytes.Buffer
-	var err error
-
-	context := parser.NewContext()
-	err = markdownWriter.Convert([]byte(sourceMd), &buf, parser.WithContext(context))
-	check(err)
-	metaData := meta.Get(context)
-
-	if metaData["draft"] == true {
-		return
-	}
-
-	createDirectoryPath(outputFile)
-	file, err := os.Create(outputFile)
-	check(err)
-	defer file.Close()
-
-	params := metaData["params"]
-
-	if params == nil {
-		params = *new(map[any]any)
-	}
-
-	data := struct {
-		Title      string
-		Summary    string
-		Body       template.HTML
-		PageParams any
-		SiteParams any
-		PagePath   []string
-	}{
-		Body:       template.HTML(buf.String()),
-		PageParams: metaData,
-		SiteParams: config,
-		PagePath:   pagePath,
-	}
-
-	pageTemplateFile := addExtension(metaData["template"].(string), ".html")
-
-	pageTemplate, ok := templates[pageTemplateFile]
-	if !ok {
-		log.Fatalf("The template %s does not exist.\n", pageTemplateFile)
-	}
-
-	err = pageTemplate.ExecuteTemplate(file, pageTemplateFile, data)
-	check(err)
-}
-
-func transpileTypescriptFile(tsFilePath string, jsOutputPath string) {
-	tsCode, err := os.ReadFile(tsFilePath)
-	check(err)
-
-	transpiled, err := typescript.TranspileString(string(tsCode))
-	check(err)
-
-	outputFile, err := os.Create(jsOutputPath)
-	check(err)
-
-	_, err = outputFile.WriteString(transpiled)
-	check(err)
+// builtinIncludes are available to every layout; a theme or site include
+// of the same name replaces one.
+var builtinIncludes = map[string]string{
+	consentBannerTemplate: consentBanner,
+	commentsTemplate:      commentsInclude,
+	serviceWorkerTemplate: serviceWorkerInclude,
 }
 
-func generateTemplates(directory string) map[string]*template.Template {
+func generateTemplates(store *artifactStore, directory string, cache *templateCache) map[string]*template.Template {
 	templates := make(map[string]*template.Template)
 
-	templatesDir := directory
-
-	layouts, err := filepath.Glob(templatesDir + "layouts/*")
+	layouts, err := store.Glob(directory + "/layouts/*")
 	check(err)
 
-	includes, err := filepath.Glob(templatesDir + "includes/*")
+	includes, err := store.Glob(directory + "/includes/*")
 	check(err)
 
+	texts := make(map[string]string)
+	for name, text := range builtinIncludes {
+		texts[name] = text
+	}
+	for _, file := range append(includes, layouts...) {
+		text, err := store.ReadFile(file)
+		check(err)
+		texts[file] = string(text)
+	}
+	parsed := cache.parse(texts)
+
+	// A layout that cannot be parsed is left out, so that its pages fail;
+	// one whose include cannot be fails where it uses the include.
 	for _, layout := range layouts {
-		files := append(includes, layout)
-		templates[filepath.Base(layout)] = template.Must(template.New("template").Funcs(sprig.FuncMap()).ParseFiles(files...))
+		if _, ok := parsed[layout]; !ok {
+			continue
+		}
+		guardFile(func() {
+			layoutTemplate := template.New("template").Funcs(templateFuncMap())
+			for name := range builtinIncludes {
+				checkFile(name, parsed[name].addTo(layoutTemplate))
+			}
+			for _, file := range append(includes, layout) {
+				checkFile(templateSource(filepath.Base(file)), parsed[file].addTo(layoutTemplate))
+			}
+			templates[filepath.Base(layout)] = layoutTemplate
+		})
 	}
+	warnDeprecatedFields(parsed, append(includes, layouts...))
 
 	return templates
 }
 
-func convertContentDirectory(templates map[string]*template.Template, markdownWriter goldmark.Markdown, config map[string]interface{}, ignoreObsidian bool) {
-	walk("content", func(fileName string) {
-		if getExtension(fileName) == ".md" && !strings.Contains(fileName, "IGNORE") {
-			fileData, err := os.ReadFile(fileName)
-			check(err)
-			pagePath := strings.Split(strings.TrimSuffix(strings.TrimPrefix(removeExtension(fileName), "content/"), "/index"), "/")
-			generateHtmlFile(
-				templates,
-				markdownWriter,
-				string(fileData),
-				"public/"+strings.TrimPrefix(
-					changeExtension(fileName, ".html"),
-					"content/",
-				),
-				config,
-				pagePath,
-			)
-		} else {
-			if !strings.Contains(fileName, ".git") && !strings.Contains(fileName, "IGNORE") && !(ignoreObsidian && strings.Contains(fileName, ".obsidian")) {
-				newFileName := strings.TrimPrefix(fileName, "content/")
-				createDirectoryPath("public/" + newFileName)
-				copyFile(
-					fileName,
-					"public/"+newFileName,
-				)
-			}
-		}
-	})
-}
-
 func readConfigFile(markdownWriter goldmark.Markdown, configFile string) map[string]interface{} {
 	var buf bytes.Buffer
 
@@ -213,134 +131,356 @@ func readConfigFile(markdownWriter goldmark.Markdown, configFile string) map[str
 	err = markdownWriter.Convert([]byte(string(fileData)), &buf, parser.WithContext(context))
 	check(err)
 
-	return meta.Get(context)
+	return normalizeFrontMatterMap(meta.Get(context))
 }
 
-func copyDirectoryFiles(directoryToCopy string, newDirectoryPath string) {
-	walk(directoryToCopy, func(fileName string) {
-		newFileName := strings.TrimPrefix(fileName, directoryToCopy)
-		createDirectoryPath(newDirectoryPath + newFileName)
-		copyFile(
-			fileName,
-			newDirectoryPath+newFileName,
-		)
-	})
-}
+// readSiteConfig reads config.md, applies grafe.yaml to it, checks it
+// against the theme's parameter schema and grafe's own settings, and decodes
+// the settings from it.
+func readSiteConfig(project projectConfig) (map[string]interface{}, siteConfig) {
+	configMarkdown := goldmark.New(
+		goldmark.WithExtensions(
+			meta.Meta,
+		),
+	)
 
-func transpileTypescript(directory string) {
-	walk(directory, func(fileName string) {
-		if getExtension(fileName) != ".ts" {
-			return
-		}
-		newFileName := changeExtension(fileName, ".js")
-		createDirectoryPath(directory + "/" + newFileName)
-		transpileTypescriptFile(fileName, newFileName)
-		err := os.Remove(fileName)
-		check(err)
-	})
+	config := readConfigFile(configMarkdown, "config.md")
+	project.apply(config)
+	schema, err := readThemeSchema(themeDirectory + "/params.yaml")
+	check(err)
+	check(applyThemeSchema(schema, config))
+	check(checkSettings(config, schema))
+
+	return config, decodeSiteConfig(config)
 }
 
-func startHTTPServer(directory string, port int) {
-	fmt.Printf("Started server at http://localhost:%d/\n", port)
-	http.Handle("/", http.FileServer(http.Dir(directory)))
+func pruneDirectory(directory string) {
+	err := os.RemoveAll(directory)
+	check(err)
+}
 
-	httpServerExitDone := &sync.WaitGroup{}
-	httpServerExitDone.Add(1)
+// parseCommandFlags parses args with flags, allowing flags after positional
+// arguments as in `grafe new site blog -theme tuftexx`, and returns the
+// positional arguments.
+func parseCommandFlags(flags *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		err := flags.Parse(args)
+		check(err)
+		if flags.NArg() == 0 {
+			return positional
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
 
-	closeHTTPServer := func() {
-		httpServerExitDone.Done()
-		httpServerExitDone.Wait()
-		fmt.Println("\nClosed server\n")
+// parseCommandFlagsOnly parses args with flags for a command that takes no
+// positional arguments, exiting with its usage if it is given any, as for
+// a mistyped flag.
+func parseCommandFlagsOnly(flags *flag.FlagSet, args []string) {
+	if positional := parseCommandFlags(flags, args); len(positional) > 0 {
+		fmt.Fprintf(flags.Output(), "%s takes no arguments, but was given %s\n", flags.Name(), strings.Join(positional, " "))
+		flags.Usage()
+		os.Exit(2)
 	}
+}
 
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-c
-		closeHTTPServer()
-		os.Exit(1)
-	}()
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "new" {
+		newCommand(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		initCommand(os.Args[2:])
+		return
+	}
 
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), nil))
+	project := loadProjectConfig()
+	command, args := "build", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "build":
+		buildCommand(project, args, false)
+	case "serve":
+		buildCommand(project, args, true)
+	case "clean":
+		cleanCommand(args)
+	case "check":
+		checkCommand(project, args)
+	case "calendar":
+		calendarCommand(project, args)
+	case "deploy":
+		deployCommand(project, args)
+	case "export":
+		exportCommand(project, args)
+	case "verify":
+		verifyCommand(project, args)
+	case "rollback":
+		rollbackCommand(project, args)
+	case "params":
+		paramsCommand(project, args)
+	default:
+		log.Fatalf("unknown command %q; expected build, serve, clean, check, calendar, new, init, deploy, export, verify, rollback, or params", command)
+	}
 }
 
-func pruneDirectory(directory string) {
-	err := os.RemoveAll(directory)
-	check(err)
+// cleanCommand removes the built site, its build cache, and the generator's
+// working files.
+func cleanCommand(args []string) {
+	flags := flag.NewFlagSet("grafe clean", flag.ExitOnError)
+	parseCommandFlagsOnly(flags, args)
+
+	newArtifactStore("public-generator").Prune()
+	pruneDirectory(outputDirectory)
+	pruneDirectory(buildCacheFile)
 }
 
-func main() {
+// buildCommand builds the site and, for `grafe serve` or `-server`, serves
+// it until interrupted.
+func buildCommand(project projectConfig, args []string, serve bool) {
 	var err error
 
-	enableTypeScriptTranspilationPtr := flag.Bool("transpile-ts", true, "Transpile all TypeScript in the `public` directory.")
-	createNoJekyllFilePtr := flag.Bool("nojekyll", true, "Create `public/.nojekyll`; required to host static site on GitHub pages.")
-	ignoreObsidianPtr := flag.Bool("ignoreobsidian", true, "Ignore .obsidian directory in content directory.")
-	enableHttpServerPtr := flag.Bool("server", false, "Start HTTP server of `public` directory.")
-	httpServerPortPtr := flag.Int("port", 8081, "Port at which to host HTTP server.")
+	name := "grafe build"
+	if serve {
+		name = "grafe serve"
+	}
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	enableTypeScriptTranspilationPtr := flags.Bool("transpile-ts", true, "Transpile all TypeScript in the `public` directory.")
+	createNoJekyllFilePtr := flags.Bool("nojekyll", true, "Create `public/.nojekyll`; required to host static site on GitHub pages.")
+	ignoreObsidianPtr := flags.Bool("ignoreobsidian", true, "Ignore .obsidian directory in content directory.")
+	enableHttpServerPtr := flags.Bool("server", serve, "Start HTTP server of `public` directory after building; `grafe serve` does the same.")
+	httpServerPortPtr := flags.Int("port", project.Port, "Port at which to host HTTP server; defaults to the port in grafe.yaml or 8081.")
+	productionServerPtr := flags.Bool("production", false, "Compress responses and send cache headers from the HTTP server.")
+	tlsCertificatePtr := flags.String("tls-cert", "", "TLS certificate file; serves HTTPS and HTTP/2 together with `-tls-key`.")
+	tlsKeyPtr := flags.String("tls-key", "", "TLS private key file.")
+	basicAuthPtr := flags.String("auth", os.Getenv("GRAFE_SERVER_AUTH"), "Require HTTP basic auth as `user:password` on the HTTP server; defaults to $GRAFE_SERVER_AUTH.")
+	logRequestsPtr := flags.Bool("log-requests", false, "Log every request to the HTTP server.")
+	sharePtr := flags.Bool("share", false, "Expose the HTTP server through a tunnel and print a shareable preview URL.")
+	shareProviderPtr := flags.String("share-provider", "localhost.run", "Tunnel used by `-share`: localhost.run, serveo, or cloudflared; `share.command` in config.md overrides it.")
+	accessTokenPtr := flags.String("token", os.Getenv("GRAFE_SERVER_TOKEN"), "Require an access token, given once as `?token=`, on the HTTP server; defaults to $GRAFE_SERVER_TOKEN.")
+
+	archivePtr := flags.String("archive", "", "Also write the built site to a .zip, .tar, or .tar.gz archive.")
+	releasePtr := flags.Bool("release", false, "Also copy the built site into a new dated release directory and make it the current release.")
+	uploadPtr := flags.String("upload", "", "Also upload the built site to an S3-compatible bucket given as `s3://bucket/prefix`.")
+	templateMetricsPtr := flags.Bool("template-metrics", false, "Report how long each layout and partial takes to execute.")
+	sizeReportPtr := flags.Bool("size-report", false, "Report what every page weighs with the files it loads, heaviest first.")
+	environmentPtr := flags.String("environment", "", "Build environment exposed to templates as `.Site.Environment`; defaults to development with `-server` and production otherwise.")
+
+	changedSincePtr := flags.String("changed-since", "", "Only build the pages changed since this git ref, and their list pages, into the `-preview` directory, and print their URLs.")
+	previewPtr := flags.String("preview", "preview", "Directory `-changed-since` builds into.")
+	buildDraftsPtr := flags.Bool("buildDrafts", false, "Also build draft pages, which templates can mark using `.Draft`.")
+	forcePtr := flags.Bool("force", false, "Rebuild every page from scratch instead of only those that changed since the last build.")
+	watchPtr := flags.Bool("watch", false, "Rebuild the site when its files change and reload it in the browser; used with `grafe serve`.")
+	lazyPtr := flags.Bool("lazy", false, "Render each page when it is first requested instead of building the whole site up front, and watch for changes; used with `grafe serve`.")
+	minifyPtr := flags.Bool("minify", false, "Minify the built HTML, CSS, and JavaScript; `minify: true` in config.md does the same.")
+	strictPtr := flags.Bool("strict", false, "Fail the build if it logs any warnings, such as images without alt text or wikilinks to missing pages.")
+	annotationsPtr := flags.String("annotations", "", "Also print warnings as `github` Actions annotations on the lines of the files they are about.")
+	sarifPtr := flags.String("sarif", "", "Write the build's warnings to this SARIF file for code scanning.")
+
+	conditions := make(conditionFlag)
+	flags.Var(conditions, "condition", "Set a `key=value` condition for `:::only` blocks; may be repeated.")
+
+	parseCommandFlagsOnly(flags, args)
+
+	if *sharePtr && *basicAuthPtr == "" && *accessTokenPtr == "" {
+		log.Fatal("-share makes the server, drafts and all, public to anyone with its URL; set -auth or -token to require a password or token.")
+	}
+	if *annotationsPtr != "" && *annotationsPtr != "github" {
+		log.Fatalf("-annotations must be github, not %q.\n", *annotationsPtr)
+	}
+	if *changedSincePtr != "" {
+		outputDirectory = *previewPtr
+		if err := checkOutputDirectory(outputDirectory); err != nil {
+			log.Fatalf("-preview %v\n", err)
+		}
+	}
+	lazy := *lazyPtr && *enableHttpServerPtr
+	if lazy && (*releasePtr || *archivePtr != "" || *uploadPtr != "" || *changedSincePtr != "") {
+		log.Fatalf("-lazy cannot be used with -release, -archive, -upload, or -changed-since, which need the whole site built.\n")
+	}
+	watch := (*watchPtr || lazy) && *enableHttpServerPtr
 
-	flag.Parse()
+	environment := *environmentPtr
+	if environment == "" {
+		environment = "production"
+		if *enableHttpServerPtr {
+			environment = "development"
+		}
+	}
 
-	pruneDirectory("public-generator")
+	buildFlags := make(map[string]string)
+	flags.VisitAll(func(f *flag.Flag) {
+		if f.Name != "auth" && f.Name != "token" {
+			buildFlags[f.Name] = f.Value.String()
+		}
+	})
 
-	createDirectoryPath("public-generator/templates")
-	copyDirectoryFiles("theme/templates", "public-generator/templates")
-	copyDirectoryFiles("templates", "public-generator/templates")
-	templates := generateTemplates("public-generator/templates/")
+	// buildSite builds the whole site, or with -lazy reads it for the server
+	// to render; with -watch it runs again after every change.
+	var reloads *reloadHub
+	if watch {
+		reloads = newReloadHub()
+	}
+	var lazyRenderer *lazyPages
+	if lazy {
+		lazyRenderer = &lazyPages{}
+	}
+	templateCache := newTemplateCache()
+	buildSite := func() siteConfig {
+		if lazy {
+			lazyRenderer.stop()
+		}
+		resetWarnings()
+		resetOutputs()
+		artifacts := newArtifactStore("public-generator")
+		artifacts.Prune()
+
+		artifacts.CopyDirectory(themeDirectory+"/templates", "templates")
+		artifacts.CopyDirectory("templates", "templates")
+		templates := generateTemplates(artifacts, "templates", templateCache)
+		shortcodeTemplates := generateShortcodeTemplates(artifacts, "templates")
+		outputTemplates := generateOutputTemplates(artifacts, "templates")
+
+		config, settings := readSiteConfig(project)
+		for key, value := range conditions {
+			settings.Conditions[key] = value
+		}
 
-	configMarkdown := goldmark.New(
-		goldmark.WithExtensions(
-			meta.Meta,
-		),
-	)
+		var paramSchemas map[string]*paramSchema
+		paramSchemas, err = readParamSchemas(settings.ParamSchemas)
+		check(err)
 
-	config := readConfigFile(configMarkdown, "config.md")
+		wikilinks := &wikilinkResolver{settings: settings}
+		markdownWriters := newMarkdownWriters(settings.Markdown, wikilinks)
 
-	markdownWriter := goldmark.New(
-		goldmark.WithParserOptions(
-			parser.WithAutoHeadingID(),
-			parser.WithAttribute(),
-		),
-		goldmark.WithExtensions(
-			meta.Meta,
-			extension.Table,
-			&wikilink.Extender{},
-			mathjax.MathJax,
-			extension.TaskList,
-			extension.Table,
-			&fences.Extender{},
-			wikitable.New(),
-		),
-		goldmark.WithRendererOptions(
-			renderer.WithNodeRenderers(
-				util.Prioritized(
-					extension.NewTableHTMLRenderer(),
-					500,
-				),
-			),
-			html.WithUnsafe(),
-		),
-	)
+		cache := loadBuildCache()
+		if *forcePtr || cache == nil || *changedSincePtr != "" || lazy {
+			cache = nil
+			pruneDirectory(outputDirectory)
+		}
+
+		siteBuilder := &builder{
+			templates:          templates,
+			shortcodeTemplates: shortcodeTemplates,
+			outputTemplates:    outputTemplates,
+			markdownWriters:    markdownWriters,
+			wikilinks:          wikilinks,
+			config:             config,
+			settings:           settings,
+			urlRewriter:        newURLRewriter(settings.URLRewrite, settings.BasePath),
+			ignoreObsidian:     *ignoreObsidianPtr,
+			environment:        environment,
+			isServer:           *enableHttpServerPtr,
+			flags:              buildFlags,
+			cache:              cache,
+			changedSince:       *changedSincePtr,
+			buildDrafts:        *buildDraftsPtr,
+			typescript:         *enableTypeScriptTranspilationPtr,
+			minify:             *minifyPtr || settings.Minify,
+			paramSchemas:       paramSchemas,
+		}
+		if *templateMetricsPtr {
+			siteBuilder.metrics = newTemplateMetrics()
+		}
+		if lazy {
+			lazyRenderer.replace(siteBuilder.buildLazily(), reloads.reload)
+		} else {
+			siteBuilder.build()
+		}
 
-	pruneDirectory("public")
+		// Pages are weighed, and the service worker precaches files, as
+		// they are served, so the output is minified first.
+		if !lazy && siteBuilder.minify {
+			minifyOutput(outputDirectory)
+		}
+		var weights []pageWeight
+		if !lazy && (*sizeReportPtr || settings.Budgets.Default != "" || len(settings.Budgets.Sections) > 0) {
+			weights = measurePages(settings)
+		}
+		if !lazy {
+			writeServiceWorker(settings)
+		}
 
-	copyDirectoryFiles("theme/static", "public")
+		strict := *strictPtr || settings.Strict
+		if strict {
+			failWarnings()
+		}
+		if *annotationsPtr == "github" {
+			writeAnnotations(strict)
+		}
+		if *sarifPtr != "" {
+			writeSARIF(*sarifPtr, strict)
+		}
+		checkErrors(watch)
 
-	copyDirectoryFiles("static", "public")
+		if siteBuilder.metrics != nil {
+			siteBuilder.metrics.write(os.Stdout)
+		}
 
-	convertContentDirectory(templates, markdownWriter, config, *ignoreObsidianPtr)
+		if *sizeReportPtr {
+			writeSizeReport(os.Stdout, weights)
+		}
+		artifacts.Prune()
 
-	pruneDirectory("public-generator")
+		if *createNoJekyllFilePtr {
+			_, err = os.Create(outputDirectory + "/.nojekyll")
+			check(err)
+			recordOutput(outputDirectory + "/.nojekyll")
+		}
 
-	if *enableTypeScriptTranspilationPtr {
-		transpileTypescript("public")
+		if !lazy {
+			writeIntegrityManifest(settings.Integrity)
+		}
+		siteBuilder.saveBuildCache()
+		return settings
 	}
+	settings := buildSite()
 
-	if *createNoJekyllFilePtr {
-		_, err = os.Create("public/.nojekyll")
+	if *releasePtr {
+		publishRelease(settings.Releases, settings.now())
+	}
+	if *archivePtr != "" {
+		target, err := newArchiveTarget(*archivePtr)
+		check(err)
+		check(publishOutput(outputDirectory, target))
+	}
+	if *uploadPtr != "" {
+		target, err := newS3Target(*uploadPtr)
 		check(err)
+		check(publishOutput(outputDirectory, target))
 	}
 
 	if *enableHttpServerPtr {
-		startHTTPServer("public", *httpServerPortPtr)
+		if watch {
+			go watchSite([]string{contentDirectory, staticDirectory, themeDirectory, "templates", "data", "snippets"}, func() {
+				buildSite()
+				reloads.reload()
+			})
+		}
+
+		var share *shareConfig
+		if *sharePtr {
+			provider, err := shareProvider(*shareProviderPtr, settings.Share)
+			check(err)
+			share = &provider
+		}
+
+		startHTTPServer(serverOptions{
+			directory:      outputDirectory,
+			basePath:       settings.BasePath,
+			port:           *httpServerPortPtr,
+			production:     *productionServerPtr,
+			tlsCertificate: *tlsCertificatePtr,
+			tlsKey:         *tlsKeyPtr,
+			basicAuth:      *basicAuthPtr,
+			token:          *accessTokenPtr,
+			share:          share,
+			logRequests:    *logRequestsPtr,
+			reloads:        reloads,
+			lazy:           lazyRenderer,
+		})
 	}
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestParseCommandFlags(t *testing.T) {
+	tests := []struct {
+		args           []string
+		wantPositional string
+		wantTheme      string
+	}{
+		{nil, "", ""},
+		{[]string{"-theme", "paper"}, "", "paper"},
+		{[]string{"site", "blog"}, "site blog", ""},
+		{[]string{"site", "blog", "-theme", "paper"}, "site blog", "paper"},
+		{[]string{"site", "-theme", "paper", "blog"}, "site blog", "paper"},
+	}
+
+	for _, test := range tests {
+		flags := flag.NewFlagSet("grafe new", flag.ContinueOnError)
+		themePtr := flags.String("theme", "", "")
+		positional := parseCommandFlags(flags, test.args)
+		if got := strings.Join(positional, " "); got != test.wantPositional || *themePtr != test.wantTheme {
+			t.Errorf("parseCommandFlags(%q) gave %q and -theme %q, want %q and %q", test.args, got, *themePtr, test.wantPositional, test.wantTheme)
+		}
+	}
+}
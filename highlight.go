@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+)
+
+const defaultHighlightStyle = "github"
+
+// highlightConfig turns on highlighting code blocks at build time, in the
+// chroma Style, optionally with line numbers. With a Stylesheet, code is
+// marked with classes instead of inline styles, and the style's CSS is
+// written to that path.
+type highlightConfig struct {
+	Style       string `yaml:"style"`
+	LineNumbers bool   `yaml:"lineNumbers"`
+	Stylesheet  string `yaml:"stylesheet"`
+}
+
+func (config *highlightConfig) style() *chroma.Style {
+	name := config.Style
+	if name == "" {
+		name = defaultHighlightStyle
+	}
+	style, ok := styles.Registry[strings.ToLower(name)]
+	if !ok {
+		log.Fatalf("Unknown highlight style %q; expected one of %s.\n", name, strings.Join(styles.Names(), ", "))
+	}
+	return style
+}
+
+func (config *highlightConfig) formatOptions() []chromahtml.Option {
+	return []chromahtml.Option{
+		chromahtml.WithClasses(config.Stylesheet != ""),
+		chromahtml.WithLineNumbers(config.LineNumbers),
+	}
+}
+
+// extension highlights fenced code blocks in a language chroma knows;
+// others are left for the browser, such as diagrams.
+func (config *highlightConfig) extension() goldmark.Extender {
+	return highlighting.NewHighlighting(
+		highlighting.WithCustomStyle(config.style()),
+		highlighting.WithFormatOptions(config.formatOptions()...),
+	)
+}
+
+// highlight renders code in language numbering its lines from start, or
+// returns false if chroma does not know the language.
+func (config *highlightConfig) highlight(code string, language string, start int) (string, bool) {
+	lexer := lexers.Get(language)
+	if lexer == nil {
+		return "", false
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+	if err != nil {
+		return "", false
+	}
+	var buf bytes.Buffer
+	formatter := chromahtml.New(append(config.formatOptions(), chromahtml.BaseLineNumber(start))...)
+	check(formatter.Format(&buf, config.style(), iterator))
+	return buf.String(), true
+}
+
+func (b *builder) writeHighlightStylesheet() {
+	config := b.settings.Markdown.Highlight
+	if config == nil || config.Stylesheet == "" {
+		return
+	}
+	var buf bytes.Buffer
+	check(chromahtml.New(config.formatOptions()...).WriteCSS(&buf, config.style()))
+	b.writeOutput(outputDirectory+"/"+strings.TrimPrefix(config.Stylesheet, "/"), buf.Bytes())
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"image"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+var alternativeImageFormats = []struct {
+	extension string
+	mimeType  string
+}{
+	{".avif", "image/avif"},
+	{".webp", "image/webp"},
+}
+
+var imageMimeTypes = map[string]string{
+	".avif": "image/avif",
+	".gif":  "image/gif",
+	".jpeg": "image/jpeg",
+	".jpg":  "image/jpeg",
+	".png":  "image/png",
+	".svg":  "image/svg+xml",
+	".webp": "image/webp",
+}
+
+// resolveAssetPath finds the file on disk that url refers to when it is
+// used from the content file at sourcePath. Relative URLs are resolved
+// against the content file's directory, root-relative URLs against the
+// content, static, and theme static directories in that order.
+func resolveAssetPath(url string, sourcePath string) (string, bool) {
+	if strings.Contains(url, "://") || strings.HasPrefix(url, "data:") {
+		return "", false
+	}
+	url = strings.SplitN(strings.SplitN(url, "?", 2)[0], "#", 2)[0]
+
+	var candidates []string
+	if strings.HasPrefix(url, "/") {
+		for _, directory := range []string{contentDirectory, staticDirectory, themeDirectory + "/static"} {
+			candidates = append(candidates, filepath.Join(directory, filepath.FromSlash(url)))
+		}
+	} else {
+		candidates = append(candidates, filepath.Join(filepath.Dir(sourcePath), filepath.FromSlash(url)))
+	}
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+func imageDimensions(filePath string) (int, int, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	return config.Width, config.Height, nil
+}
+
+// pictureSources returns a <source> element for each alternative format
+// that exists next to url on disk, followed by one for url itself.
+func pictureSources(url string, media string, sourcePath string) string {
+	var sources strings.Builder
+
+	mediaAttribute := ""
+	if media != "" {
+		mediaAttribute = fmt.Sprintf(` media="%s"`, html.EscapeString(media))
+	}
+
+	extension := strings.ToLower(path.Ext(url))
+	base := strings.TrimSuffix(url, path.Ext(url))
+	for _, format := range alternativeImageFormats {
+		if format.extension == extension {
+			continue
+		}
+		if _, ok := resolveAssetPath(base+format.extension, sourcePath); ok {
+			fmt.Fprintf(&sources, `<source%s srcset="%s" type="%s">`, mediaAttribute, html.EscapeString(base+format.extension), format.mimeType)
+		}
+	}
+
+	if media != "" {
+		dimensions := ""
+		if filePath, ok := resolveAssetPath(url, sourcePath); ok {
+			if width, height, err := imageDimensions(filePath); err == nil {
+				dimensions = fmt.Sprintf(` width="%d" height="%d"`, width, height)
+			}
+		}
+		typeAttribute := ""
+		if mimeType, ok := imageMimeTypes[extension]; ok {
+			typeAttribute = fmt.Sprintf(` type="%s"`, mimeType)
+		}
+		fmt.Fprintf(&sources, `<source%s srcset="%s"%s%s>`, mediaAttribute, html.EscapeString(url), typeAttribute, dimensions)
+	}
+
+	return sources.String()
+}
+
+// pictureShortcode renders
+//
+//	{{< picture src="photo.jpg" alt="..." sources="(min-width: 60em) wide.jpg; (min-width: 30em) medium.jpg" loading="eager" >}}
+//
+// as a <picture> element with one group of sources per art-direction
+// breakpoint, AVIF and WebP variants wherever they exist next to the
+// original image, or all the sizes of images.widths when it is set, and
+// intrinsic dimensions on every image to prevent layout shift. `placeholder="blur"`, `"color"`, or `"blurhash"` paints a
+// placeholder behind the image while it loads or, for blurhash, leaves it
+// in a data-blurhash attribute for a script to draw.
+func pictureShortcode(call shortcodeCall) (string, error) {
+	src := call.ArgOr("src", strings.Join(call.Positional, ""))
+	if src == "" {
+		return "", fmt.Errorf("missing src")
+	}
+
+	loading := call.ArgOr("loading", "lazy")
+	if loading != "lazy" && loading != "eager" {
+		return "", fmt.Errorf("loading must be lazy or eager, not %q", loading)
+	}
+	if _, ok := call.Args["alt"]; !ok {
+		warnAt(call.SourcePath, sourceLine(call.SourcePath, src), "%s %s has no alt text", call.Name, src)
+	}
+
+	var out strings.Builder
+	out.WriteString("<picture>")
+
+	for _, source := range strings.Split(call.Arg("sources"), ";") {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			continue
+		}
+		split := strings.LastIndexAny(source, " \t")
+		if split < 0 {
+			return "", fmt.Errorf("source %q needs a media query before its URL", source)
+		}
+		out.WriteString(pictureSources(strings.TrimSpace(source[split:]), strings.TrimSpace(source[:split]), call.SourcePath))
+	}
+	set, err := responsiveImageFor(src, call.SourcePath, *call.settings)
+	if err != nil {
+		return "", err
+	}
+	sizes := call.Arg("sizes")
+	if set != nil {
+		if sizes == "" {
+			sizes = call.settings.Images.Sizes
+		}
+		out.WriteString(set.sources(sizes))
+	} else {
+		out.WriteString(pictureSources(src, "", call.SourcePath))
+	}
+
+	width, height := call.Arg("width"), call.Arg("height")
+	if width == "" || height == "" {
+		if filePath, ok := resolveAssetPath(src, call.SourcePath); ok {
+			if w, h, err := imageDimensions(filePath); err == nil {
+				width, height = fmt.Sprint(w), fmt.Sprint(h)
+			}
+		}
+	}
+
+	fmt.Fprintf(&out, `<img src="%s" alt="%s"`, html.EscapeString(src), html.EscapeString(call.Arg("alt")))
+	if width != "" && height != "" {
+		fmt.Fprintf(&out, ` width="%s" height="%s"`, html.EscapeString(width), html.EscapeString(height))
+	}
+	if class := call.Arg("class"); class != "" {
+		fmt.Fprintf(&out, ` class="%s"`, html.EscapeString(class))
+	}
+	if set != nil {
+		fmt.Fprintf(&out, ` srcset="%s"`, html.EscapeString(set.Srcset))
+	}
+	if sizes != "" {
+		fmt.Fprintf(&out, ` sizes="%s"`, html.EscapeString(sizes))
+	}
+	if mode := call.Arg("placeholder"); mode != "" {
+		placeholder, err := placeholderFunc(src, call.SourcePath)
+		if err != nil {
+			return "", err
+		}
+		switch mode {
+		case "blur":
+			fmt.Fprintf(&out, ` style="background-size: cover; background-image: url(%s)"`, placeholder.DataURI)
+		case "color":
+			fmt.Fprintf(&out, ` style="background-color: %s"`, placeholder.Color)
+		case "blurhash":
+			fmt.Fprintf(&out, ` data-blurhash="%s"`, html.EscapeString(placeholder.BlurHash))
+		default:
+			return "", fmt.Errorf("placeholder must be blur, color, or blurhash, not %q", mode)
+		}
+	}
+	fmt.Fprintf(&out, ` loading="%s" decoding="async"`, loading)
+	if loading == "eager" {
+		out.WriteString(` fetchpriority="high"`)
+	}
+	out.WriteString("></picture>")
+
+	return out.String(), nil
+}
+
+// themedImageVariant returns the `name.<scheme>.ext` sibling of url, when
+// it exists, for the colour scheme dark or light.
+func themedImageVariant(url string, scheme string, sourcePath string) string {
+	variant := strings.TrimSuffix(url, path.Ext(url)) + "." + scheme + path.Ext(url)
+	if _, ok := resolveAssetPath(variant, sourcePath); ok {
+		return variant
+	}
+	return ""
+}
+
+// themedImageShortcode renders
+//
+//	{{< themed-image src="diagram.png" alt="..." >}}
+//
+// as a <picture> element that shows `diagram.dark.png` to readers who prefer
+// a dark colour scheme and `diagram.light.png` to the others, using
+// whichever of the two exist; `dark` and `light` name other variants.
+func themedImageShortcode(call shortcodeCall) (string, error) {
+	src := call.ArgOr("src", strings.Join(call.Positional, ""))
+	if src == "" {
+		return "", fmt.Errorf("missing src")
+	}
+
+	loading := call.ArgOr("loading", "lazy")
+	if loading != "lazy" && loading != "eager" {
+		return "", fmt.Errorf("loading must be lazy or eager, not %q", loading)
+	}
+	if _, ok := call.Args["alt"]; !ok {
+		warnAt(call.SourcePath, sourceLine(call.SourcePath, src), "%s %s has no alt text", call.Name, src)
+	}
+
+	dark := call.ArgOr("dark", themedImageVariant(src, "dark", call.SourcePath))
+	light := call.ArgOr("light", themedImageVariant(src, "light", call.SourcePath))
+	if dark == "" && light == "" {
+		return "", fmt.Errorf("%s has no dark or light variant", src)
+	}
+
+	var out strings.Builder
+	out.WriteString("<picture>")
+	if dark != "" {
+		fmt.Fprintf(&out, `<source media="(prefers-color-scheme: dark)" srcset="%s">`, html.EscapeString(dark))
+	}
+	fallback := src
+	if light != "" {
+		fmt.Fprintf(&out, `<source media="(prefers-color-scheme: light)" srcset="%s">`, html.EscapeString(light))
+		fallback = light
+	}
+
+	fmt.Fprintf(&out, `<img src="%s" alt="%s"`, html.EscapeString(fallback), html.EscapeString(call.Arg("alt")))
+	if filePath, ok := resolveAssetPath(fallback, call.SourcePath); ok {
+		if width, height, err := imageDimensions(filePath); err == nil {
+			fmt.Fprintf(&out, ` width="%d" height="%d"`, width, height)
+		}
+	}
+	if class := call.Arg("class"); class != "" {
+		fmt.Fprintf(&out, ` class="%s"`, html.EscapeString(class))
+	}
+	fmt.Fprintf(&out, ` loading="%s" decoding="async"></picture>`, loading)
+
+	return out.String(), nil
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+var defaultImageFormats = []string{"webp"}
+
+// defaultImageEncoders are the commands converting an image to each format
+// that images.formats may list, with {input}, {output}, and {quality}
+// replaced for each image.
+var defaultImageEncoders = map[string]string{
+	"webp": "cwebp -quiet -q {quality} {input} -o {output}",
+	"avif": "avifenc -q {quality} {input} {output}",
+}
+
+// imageEncoderInstalls say where to get the default encoder of each format.
+var imageEncoderInstalls = map[string]string{
+	"webp": "install libwebp from https://developers.google.com/speed/webp/download",
+	"avif": "install libavif from https://github.com/AOMediaCodec/libavif",
+}
+
+// imageVariantName matches the names of the sizes written for an image,
+// such as photo-480w, so that they are not resized in turn.
+var imageVariantName = regexp.MustCompile(`-\d+w$`)
+
+// imageSet is an image in every width of images.widths, in its own format
+// and in each of images.formats, written next to it in the output.
+type imageSet struct {
+	Src    string
+	Width  int
+	Height int
+	// Srcset lists the sizes in the image's own format.
+	Srcset string
+	// Sources has a srcset for each of images.formats, by MIME type, in
+	// the order they are preferred.
+	Sources []imageSource
+}
+
+type imageSource struct {
+	Type   string
+	Srcset string
+}
+
+// isResizableImage reports whether the image at filePath is one that can be
+// resized: a JPEG or PNG.
+func isResizableImage(filePath string) bool {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+// assetOutputPath returns where filePath, a file of the content, static, or
+// theme static directory, is copied to in the output.
+func assetOutputPath(filePath string) string {
+	filePath = filepath.ToSlash(filePath)
+	for _, directory := range []string{contentDirectory, staticDirectory, themeDirectory + "/static"} {
+		if strings.HasPrefix(filePath, directory+"/") {
+			return outputDirectory + strings.TrimPrefix(filePath, directory)
+		}
+	}
+	return outputDirectory + "/" + filePath
+}
+
+// responsiveImageFor writes the sizes of the image that src refers to from
+// the content file at sourcePath, unless they are up to date, and returns
+// them. It returns nil when images.widths is not set, or src is not a JPEG
+// or PNG of the site.
+func responsiveImageFor(src string, sourcePath string, settings siteConfig) (*imageSet, error) {
+	config := settings.Images
+	if len(config.Widths) == 0 {
+		return nil, nil
+	}
+	filePath, ok := resolveAssetPath(src, sourcePath)
+	if !ok || !isResizableImage(filePath) {
+		return nil, nil
+	}
+
+	originalWidth, originalHeight, err := imageDimensions(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", src, err)
+	}
+
+	formats := config.Formats
+	if formats == nil {
+		formats = defaultImageFormats
+	}
+	extension := strings.ToLower(filepath.Ext(filePath))
+	if extension == ".jpeg" {
+		extension = ".jpg"
+	}
+	name := removeExtension(filepath.Base(filePath))
+	outputPath := filepath.Dir(assetOutputPath(filePath))
+	urlBase := strings.TrimSuffix(src, path.Base(src))
+
+	set := &imageSet{Src: src, Width: originalWidth, Height: originalHeight}
+	var srcset []string
+	formatSrcsets := make([][]string, len(formats))
+	for _, width := range scaledWidths(config.Widths, originalWidth) {
+		height := originalHeight * width / originalWidth
+		resized := fmt.Sprintf("%s-%dw%s", name, width, extension)
+		if err := resizeImage(filePath, filepath.Join(outputPath, resized), width, height); err != nil {
+			return nil, fmt.Errorf("%s: %w", src, err)
+		}
+		recordOutputFor(sourcePath, filepath.Join(outputPath, resized))
+		srcset = append(srcset, fmt.Sprintf("%s%s %dw", urlBase, resized, width))
+
+		for i, format := range formats {
+			converted := fmt.Sprintf("%s-%dw.%s", name, width, format)
+			if err := encodeImage(filepath.Join(outputPath, resized), filepath.Join(outputPath, converted), format, config); err != nil {
+				return nil, fmt.Errorf("%s: %w", src, err)
+			}
+			recordOutputFor(sourcePath, filepath.Join(outputPath, converted))
+			formatSrcsets[i] = append(formatSrcsets[i], fmt.Sprintf("%s%s %dw", urlBase, converted, width))
+		}
+	}
+	set.Srcset = strings.Join(srcset, ", ")
+	for i, format := range formats {
+		set.Sources = append(set.Sources, imageSource{Type: imageMimeTypes["."+format], Srcset: strings.Join(formatSrcsets[i], ", ")})
+	}
+	return set, nil
+}
+
+// encodeImage converts the image at sourcePath to format at
+// destinationPath with the format's encoder, unless destinationPath is
+// already newer than the source.
+func encodeImage(sourcePath string, destinationPath string, format string, config imagesConfig) error {
+	if destinationInfo, err := os.Stat(destinationPath); err == nil {
+		if sourceInfo, err := os.Stat(sourcePath); err == nil && destinationInfo.ModTime().After(sourceInfo.ModTime()) {
+			return nil
+		}
+	}
+
+	encoder, ok := config.Encoders[format]
+	if !ok {
+		encoder, ok = defaultImageEncoders[format]
+	}
+	command := strings.Fields(encoder)
+	if !ok || len(command) == 0 {
+		return fmt.Errorf("no encoder converts images to %s; set images.encoders.%s in config.md", format, format)
+	}
+	if _, err := exec.LookPath(command[0]); err != nil {
+		install := "install it"
+		if encoder == defaultImageEncoders[format] {
+			install = imageEncoderInstalls[format]
+		}
+		log.Fatalf("%s converts the site's images to %s but is not installed; %s or set images.encoders.%s in config.md.\n", command[0], format, install, format)
+	}
+
+	// The image is written beside its destination and moved there once
+	// complete, so that pages rendering at once never see half of it.
+	temporary, err := os.CreateTemp(filepath.Dir(destinationPath), "."+filepath.Base(destinationPath)+"-*."+format)
+	if err != nil {
+		return err
+	}
+	temporary.Close()
+	defer os.Remove(temporary.Name())
+
+	quality := config.Quality
+	if quality == 0 {
+		quality = 80
+	}
+	replacer := strings.NewReplacer("{input}", sourcePath, "{output}", temporary.Name(), "{quality}", fmt.Sprint(quality))
+	args := make([]string, len(command)-1)
+	for i, arg := range command[1:] {
+		args[i] = replacer.Replace(arg)
+	}
+	var errors bytes.Buffer
+	encode := exec.Command(command[0], args...)
+	encode.Stderr = &errors
+	if err := encode.Run(); err != nil {
+		return fmt.Errorf("%s: %v\n%s", command[0], err, strings.TrimSpace(errors.String()))
+	}
+	return os.Rename(temporary.Name(), destinationPath)
+}
+
+// html renders the image as an <img> with a srcset of its sizes, wrapped in
+// a <picture> offering its other formats if it has any. attributes follow
+// src, already escaped, as in ` alt="..."`.
+func (set *imageSet) html(sizes string, attributes string) string {
+	sizesAttribute := ""
+	if sizes != "" {
+		sizesAttribute = fmt.Sprintf(` sizes="%s"`, html.EscapeString(sizes))
+	}
+	var out strings.Builder
+	if len(set.Sources) > 0 {
+		out.WriteString("<picture>")
+		out.WriteString(set.sources(sizes))
+	}
+	fmt.Fprintf(&out, `<img src="%s"%s srcset="%s"%s width="%d" height="%d">`, html.EscapeString(set.Src), attributes, html.EscapeString(set.Srcset), sizesAttribute, set.Width, set.Height)
+	if len(set.Sources) > 0 {
+		out.WriteString("</picture>")
+	}
+	return out.String()
+}
+
+// sources renders a <source> element for each of the image's other formats.
+func (set *imageSet) sources(sizes string) string {
+	sizesAttribute := ""
+	if sizes != "" {
+		sizesAttribute = fmt.Sprintf(` sizes="%s"`, html.EscapeString(sizes))
+	}
+	var out strings.Builder
+	for _, source := range set.Sources {
+		fmt.Fprintf(&out, `<source type="%s" srcset="%s"%s>`, source.Type, html.EscapeString(source.Srcset), sizesAttribute)
+	}
+	return out.String()
+}
+
+// responsiveImageHTML renders the image at src, used from the content file
+// at sourcePath, in all its sizes, with alt text, lazily loaded. sizes
+// defaults to images.sizes. Images that are not resized are rendered as a
+// plain <img>.
+func responsiveImageHTML(src string, alt string, sizes []string, sourcePath string, settings siteConfig) (template.HTML, error) {
+	attributes := fmt.Sprintf(` alt="%s" loading="lazy" decoding="async"`, html.EscapeString(alt))
+	set, err := responsiveImageFor(src, sourcePath, settings)
+	if err != nil || set == nil {
+		return template.HTML(fmt.Sprintf(`<img src="%s"%s>`, html.EscapeString(src), attributes)), err
+	}
+	sizesValue := settings.Images.Sizes
+	if len(sizes) > 0 {
+		sizesValue = sizes[0]
+	}
+	return template.HTML(set.html(sizesValue, attributes)), nil
+}
+
+// ResponsiveImage renders an image in all its sizes from a shortcode
+// template, as in {{ .ResponsiveImage (.Arg "src") (.Arg "alt") }}.
+func (call shortcodeCall) ResponsiveImage(src string, alt string, sizes ...string) (template.HTML, error) {
+	return responsiveImageHTML(src, alt, sizes, call.SourcePath, *call.settings)
+}
+
+// processContentImages replaces the Markdown images of page that are
+// resized with all their sizes. It writes the sizes too, so it is called
+// for pages whose body is kept from the last build as well.
+func (b *builder) processContentImages(page *Page) {
+	if len(b.settings.Images.Widths) == 0 {
+		return
+	}
+	var images []*ast.Image
+	ast.Walk(page.document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if image, ok := node.(*ast.Image); ok && entering {
+			images = append(images, image)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, image := range images {
+		src := string(image.Destination)
+		set, err := responsiveImageFor(src, page.SourcePath, b.settings)
+		if err != nil {
+			failAt(page.SourcePath, sourceLine(page.SourcePath, "("+src), "%v", err)
+		}
+		if set == nil {
+			continue
+		}
+		attributes := fmt.Sprintf(` alt="%s"`, html.EscapeString(string(image.Text(page.source))))
+		if image.Title != nil {
+			attributes += fmt.Sprintf(` title="%s"`, html.EscapeString(string(image.Title)))
+		}
+		attributes += ` loading="lazy" decoding="async"`
+		rendered := ast.NewString([]byte(set.html(b.settings.Images.Sizes, attributes)))
+		rendered.SetCode(true)
+		image.Parent().ReplaceChild(image.Parent(), image, rendered)
+	}
+}
+
+// processImageDirectories writes the sizes of every image in the
+// directories of images.directories, whether or not a page uses it, for
+// layouts and scripts that show them.
+func (b *builder) processImageDirectories() {
+	for _, directory := range b.settings.Images.Directories {
+		directory = "/" + strings.Trim(path.Clean("/"+directory), "/")
+		var images []string
+		walk(outputDirectory+directory, func(fileName string) {
+			if isResizableImage(fileName) && !imageVariantName.MatchString(removeExtension(filepath.Base(fileName))) {
+				images = append(images, strings.TrimPrefix(fileName, outputDirectory))
+			}
+		})
+		for _, image := range images {
+			guardFile(func() {
+				if _, err := responsiveImageFor(image, "", b.settings); err != nil {
+					filePath, _ := resolveAssetPath(image, "")
+					failAt(filePath, 0, "%v", err)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+const buildCacheFile = ".grafe-cache"
+
+// buildCache records what the previous build rendered, so that pages whose
+// source and surroundings have not changed since are neither converted nor
+// executed again. Inputs covers the configuration, templates, theme, static
+// files, and data every page depends on; Structure every page's path, front
+// matter, and headings, which wikilinks and templates read; and Site the
+// structure together with the link graph, when each page last changed, and
+// its reactions, which templates can also read. Outputs lists every file
+// the build wrote, by its path in the output, so that the next build can
+// remove those it no longer writes.
+type buildCache struct {
+	Inputs    string                `json:"inputs"`
+	Structure string                `json:"structure"`
+	Site      string                `json:"site"`
+	Pages     map[string]cachedPage `json:"pages"`
+	Outputs   []string              `json:"outputs"`
+}
+
+// cachedPage is what the cache keeps of a page. Outputs are the files
+// written for it besides its own, such as the sizes of its images and the
+// fingerprinted files its template links to, which are kept along with its
+// body.
+type cachedPage struct {
+	Source          string        `json:"source"`
+	Body            template.HTML `json:"body"`
+	TableOfContents template.HTML `json:"toc"`
+	Headings        []*Heading    `json:"headings,omitempty"`
+	Outputs         []string      `json:"outputs,omitempty"`
+}
+
+// buildCacheStore keeps the cache, which holds rendered drafts, sealed
+// like any other artifact when GRAFE_CACHE_KEY is set.
+func buildCacheStore() *artifactStore {
+	return newArtifactStore(".")
+}
+
+// loadBuildCache reads the cache the previous build left, or returns nil if
+// there is none.
+func loadBuildCache() *buildCache {
+	data, err := buildCacheStore().ReadFile(buildCacheFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		warnAt(buildCacheFile, 0, "%v; rebuilding everything", err)
+		return nil
+	}
+
+	var cache buildCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		warnAt(buildCacheFile, 0, "%v; rebuilding everything", err)
+		return nil
+	}
+	return &cache
+}
+
+// page returns what the cache holds for the page written to outputPath.
+func (cache *buildCache) page(outputPath string) (cachedPage, bool) {
+	if cache == nil {
+		return cachedPage{}, false
+	}
+	page, ok := cache.Pages[outputPath]
+	return page, ok
+}
+
+func (cache *buildCache) save() {
+	data, err := json.Marshal(cache)
+	check(err)
+	check(buildCacheStore().WriteFile(buildCacheFile, data))
+}
+
+// saveBuildCache saves the cache of the last build with every file written
+// to the output since, so that files written after the pages, such as the
+// service worker, are tracked too.
+func (b *builder) saveBuildCache() {
+	if b.built == nil {
+		return
+	}
+	b.built.Outputs = recordedOutputs()
+	b.built.save()
+}
+
+func hashString(h hash.Hash) string {
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashInputs hashes everything outside the content that a page's output
+// can depend on, including grafē itself.
+func (b *builder) hashInputs() string {
+	h := sha256.New()
+	files := []string{"config.md", projectConfigFile, tsconfigFile}
+	if executable, err := os.Executable(); err == nil {
+		if info, err := os.Stat(executable); err == nil {
+			fmt.Fprintf(h, "%s %d %d\n", executable, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	for _, directory := range []string{"templates", themeDirectory, staticDirectory, "data", "snippets"} {
+		walk(directory, func(fileName string) {
+			files = append(files, fileName)
+		})
+	}
+	walk(contentDirectory, func(fileName string) {
+		if !b.isContentFile(fileName) {
+			files = append(files, fileName)
+		}
+	})
+	for _, dataPages := range b.settings.DataPages {
+		files = append(files, dataPages.Data)
+	}
+	sections := make([]string, 0, len(b.settings.ParamSchemas))
+	for section := range b.settings.ParamSchemas {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	for _, section := range sections {
+		files = append(files, b.settings.ParamSchemas[section])
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		check(err)
+		fmt.Fprintf(h, "%s %x\n", file, sha256.Sum256(data))
+	}
+
+	names := make([]string, 0, len(b.flags))
+	for name := range b.flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "-%s=%s\n", name, b.flags[name])
+	}
+	fmt.Fprintf(h, "%s %t\n", b.environment, b.isServer)
+	return hashString(h)
+}
+
+func hashPageSource(page *Page) string {
+	h := sha256.New()
+	h.Write(page.source)
+	for _, shortcode := range page.shortcodes {
+		fmt.Fprintf(h, "\x00%s", shortcode)
+	}
+	return hashString(h)
+}
+
+func hashStructure(pages []*Page, resolver *wikilinkResolver) string {
+	h := sha256.New()
+	for _, page := range pages {
+		metaData, err := json.Marshal(page.metaData)
+		if err != nil {
+			metaData = []byte(fmt.Sprint(page.metaData))
+		}
+		fmt.Fprintf(h, "%s %s %s\n", page.OutputPath, page.Title, metaData)
+
+		var headings []string
+		for key, id := range resolver.headings[page.RelPermalink] {
+			headings = append(headings, key+"="+id)
+		}
+		sort.Strings(headings)
+		fmt.Fprintf(h, "%s\n", strings.Join(headings, " "))
+	}
+	return hashString(h)
+}
+
+func hashSite(structure string, pages []*Page) string {
+	h := sha256.New()
+	fmt.Fprintln(h, structure)
+	for _, page := range pages {
+		fmt.Fprintf(h, "%s %g %d", page.OutputPath, page.Rank, page.Lastmod.UnixNano())
+		for _, link := range page.Links {
+			fmt.Fprintf(h, " %s", link.OutputPath)
+		}
+		if page.Reactions != nil {
+			kinds := make([]string, 0, len(page.Reactions.Counts))
+			for kind := range page.Reactions.Counts {
+				kinds = append(kinds, kind)
+			}
+			sort.Strings(kinds)
+			for _, kind := range kinds {
+				fmt.Fprintf(h, " %s=%d", kind, page.Reactions.Counts[kind])
+			}
+		}
+		fmt.Fprintln(h)
+	}
+	return hashString(h)
+}
+
+// removeStaleOutputs deletes every file the previous build wrote to the
+// output that the current one has not, such as the outputs of removed pages
+// and static files and fingerprinted copies of files since changed.
+func removeStaleOutputs(previous *buildCache) {
+	current := make(map[string]bool)
+	for _, name := range recordedOutputs() {
+		current[name] = true
+	}
+	for _, name := range previous.Outputs {
+		if current[name] || !fs.ValidPath(name) {
+			continue
+		}
+		outputPath := outputDirectory + "/" + name
+		if err := os.Remove(outputPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			check(err)
+		}
+		// Remove the directories the output leaves empty.
+		for directory := path.Dir(outputPath); directory != outputDirectory && directory != "." && os.Remove(directory) == nil; directory = path.Dir(directory) {
+		}
+	}
+}
+
+func outputExists(outputPath string) bool {
+	_, err := os.Stat(outputPath)
+	return err == nil
+}
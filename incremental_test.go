@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// chdir runs the rest of the test from directory, as grafē runs from the
+// root of a site.
+func chdir(t *testing.T, directory string) {
+	t.Helper()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(directory); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(previous) })
+}
+
+func writeFiles(t *testing.T, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0770); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func outputFiles(t *testing.T) []string {
+	t.Helper()
+	var files []string
+	walk(outputDirectory, func(fileName string) {
+		files = append(files, strings.TrimPrefix(fileName, outputDirectory+"/"))
+	})
+	sort.Strings(files)
+	return files
+}
+
+func TestRemoveStaleOutputs(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous []string
+		current  []string
+		want     []string
+	}{
+		{
+			name:     "nothing removed",
+			previous: []string{"index.html", "css/site.css"},
+			current:  []string{"index.html", "css/site.css"},
+			want:     []string{"css/site.css", "index.html"},
+		},
+		{
+			name:     "removed page and its directory",
+			previous: []string{"index.html", "posts/a/index.html"},
+			current:  []string{"index.html"},
+			want:     []string{"index.html"},
+		},
+		{
+			name:     "old fingerprint",
+			previous: []string{"css/site.css", "css/site.2708d73bf31c.css"},
+			current:  []string{"css/site.css", "css/site.74d94aede163.css"},
+			want:     []string{"css/site.74d94aede163.css", "css/site.css"},
+		},
+		{
+			name:     "paths outside the output",
+			previous: []string{"../keep.txt", "/keep.txt", "index.html"},
+			current:  []string{"index.html"},
+			want:     []string{"index.html"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			directory := t.TempDir()
+			chdir(t, directory)
+			writeFiles(t, map[string]string{"keep.txt": "outside"})
+			for _, name := range append(test.previous, test.current...) {
+				if !strings.HasPrefix(name, "/") && !strings.HasPrefix(name, "..") {
+					writeFiles(t, map[string]string{outputDirectory + "/" + name: name})
+				}
+			}
+
+			resetOutputs()
+			for _, name := range test.current {
+				recordOutput(outputDirectory + "/" + name)
+			}
+			removeStaleOutputs(&buildCache{Outputs: test.previous})
+
+			if got := outputFiles(t); strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Errorf("output is %v, want %v", got, test.want)
+			}
+			if _, err := os.Stat(filepath.Join(directory, "keep.txt")); err != nil {
+				t.Errorf("a file outside the output was removed: %v", err)
+			}
+			if _, err := os.Stat(outputDirectory + "/posts"); err == nil {
+				t.Errorf("the emptied directory %s/posts was kept", outputDirectory)
+			}
+		})
+	}
+}
+
+func TestRecordOutputFor(t *testing.T) {
+	resetOutputs()
+	recordOutputFor("content/post.md", outputDirectory+"/images/photo-480w.jpg")
+	recordOutputFor("content/post.md", outputDirectory+"/css/../css/site.1234abcd.css")
+	recordOutputFor("", outputDirectory+"/index.html")
+	recordOutput("elsewhere/file.txt")
+
+	if got, want := strings.Join(outputsFor("content/post.md"), " "), "css/site.1234abcd.css images/photo-480w.jpg"; got != want {
+		t.Errorf("outputs of the page are %q, want %q", got, want)
+	}
+	if got, want := strings.Join(recordedOutputs(), " "), "css/site.1234abcd.css images/photo-480w.jpg index.html"; got != want {
+		t.Errorf("recorded outputs are %q, want %q", got, want)
+	}
+}
+
+// fingerprinted is the name `fingerprint` gives css/site.css with content.
+func fingerprinted(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return "css/site." + hex.EncodeToString(sum[:6]) + ".css"
+}
+
+func TestIncrementalBuildPrunesOutputs(t *testing.T) {
+	oldStyle, newStyle := "body {}\n", "body { color: red; }\n"
+	chdir(t, t.TempDir())
+	writeFiles(t, map[string]string{
+		"config.md":                      "---\ntitle: Site\n---\n",
+		"templates/layouts/page.html":    `<html><head><link rel="stylesheet" href="{{ fingerprint "css/site.css" }}"></head><body>{{ .Body }}</body></html>`,
+		"static/css/site.css":            oldStyle,
+		"static/old.txt":                 "old\n",
+		"content/index.md":               "---\ntitle: Home\ntemplate: page\n---\nHome\n",
+		"content/posts/a.md":             "---\ntitle: A\ntemplate: page\n---\nA\n",
+		"content/posts/bundle/index.md":  "---\ntitle: Bundle\ntemplate: page\n---\nBundle\n",
+		"content/posts/bundle/notes.txt": "notes\n",
+	})
+
+	build := func() []string {
+		t.Helper()
+		buildCommand(loadProjectConfig(), []string{"-transpile-ts=false", "-nojekyll=false"}, false)
+		return outputFiles(t)
+	}
+
+	steps := []struct {
+		name   string
+		change func()
+		want   []string
+	}{
+		{
+			name:   "first build",
+			change: func() {},
+			want:   []string{fingerprinted(oldStyle), "css/site.css", "index.html", "old.txt", "posts/a.html", "posts/bundle/index.html", "posts/bundle/notes.txt"},
+		},
+		{
+			name:   "unchanged",
+			change: func() {},
+			want:   []string{fingerprinted(oldStyle), "css/site.css", "index.html", "old.txt", "posts/a.html", "posts/bundle/index.html", "posts/bundle/notes.txt"},
+		},
+		{
+			name: "page body changed",
+			change: func() {
+				writeFiles(t, map[string]string{"content/index.md": "---\ntitle: Home\ntemplate: page\n---\nWelcome\n"})
+			},
+			want: []string{fingerprinted(oldStyle), "css/site.css", "index.html", "old.txt", "posts/a.html", "posts/bundle/index.html", "posts/bundle/notes.txt"},
+		},
+		{
+			name: "files removed",
+			change: func() {
+				for _, name := range []string{"static/old.txt", "content/posts/a.md", "content/posts/bundle/notes.txt"} {
+					if err := os.Remove(name); err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
+			want: []string{fingerprinted(oldStyle), "css/site.css", "index.html", "posts/bundle/index.html"},
+		},
+		{
+			name: "fingerprinted file changed",
+			change: func() {
+				writeFiles(t, map[string]string{"static/css/site.css": newStyle})
+			},
+			want: []string{fingerprinted(newStyle), "css/site.css", "index.html", "posts/bundle/index.html"},
+		},
+	}
+
+	for _, step := range steps {
+		step.change()
+		sort.Strings(step.want)
+		if got := build(); strings.Join(got, " ") != strings.Join(step.want, " ") {
+			t.Errorf("%s: output is %v, want %v", step.name, got, step.want)
+		}
+	}
+}
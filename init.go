@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// siteAnswers are what `grafe init` asks a new site's author.
+type siteAnswers struct {
+	title   string
+	baseURL string
+	theme   string
+	feeds   bool
+	sitemap bool
+	search  bool
+}
+
+// prompter asks questions on the terminal, taking the default for an empty
+// answer or once the input runs out, so that answers can be piped in too.
+type prompter struct {
+	in  *bufio.Scanner
+	out io.Writer
+}
+
+func (p prompter) ask(question string, fallback string) string {
+	if fallback != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, fallback)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	if !p.in.Scan() {
+		fmt.Fprintln(p.out)
+		return fallback
+	}
+	if answer := strings.TrimSpace(p.in.Text()); answer != "" {
+		return answer
+	}
+	return fallback
+}
+
+func (p prompter) confirm(question string, fallback bool) bool {
+	choices := "y/N"
+	if fallback {
+		choices = "Y/n"
+	}
+	for {
+		switch strings.ToLower(p.ask(question+" ("+choices+")", "")) {
+		case "":
+			return fallback
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+		fmt.Fprintln(p.out, "Please answer yes or no.")
+	}
+}
+
+// askBaseURL asks for the URL the site is published at, which must be
+// absolute, and adds the trailing slash grafē expects.
+func (p prompter) askBaseURL() string {
+	for {
+		answer := p.ask("Base URL the site is published at, such as https://example.com/ (empty for none yet)", "")
+		if answer == "" {
+			return ""
+		}
+		parsed, err := url.Parse(answer)
+		if err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != "" {
+			return strings.TrimSuffix(answer, "/") + "/"
+		}
+		fmt.Fprintf(p.out, "%s is not an http or https URL.\n", answer)
+	}
+}
+
+func yamlScalar(value string) string {
+	data, err := yaml.Marshal(value)
+	check(err)
+	return strings.TrimSpace(string(data))
+}
+
+// siteConfigFile writes config.md for the answers, explaining each setting
+// so that the file is a guide to changing them later.
+func siteConfigFile(answers siteAnswers) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	b.WriteString("# The site's name, which templates show as .Site.Title.\n")
+	fmt.Fprintf(&b, "title: %s\n", yamlScalar(answers.title))
+	b.WriteString("\n# Where the site is published, which feeds, the sitemap, and .Permalink need.\n")
+	if answers.baseURL != "" {
+		fmt.Fprintf(&b, "baseURL: %s\n", yamlScalar(answers.baseURL))
+	} else {
+		b.WriteString("# baseURL: https://example.com/\n")
+	}
+
+	b.WriteString("\n# The files written besides the pages, by name and path; `outputs: {}` writes none.\n")
+	var outputs []string
+	if answers.feeds {
+		outputs = append(outputs, "  rss: index.xml", "  atom: atom.xml")
+	}
+	if answers.sitemap {
+		outputs = append(outputs, "  sitemap: sitemap.xml")
+	}
+	if len(outputs) == 0 {
+		b.WriteString("outputs: {}\n")
+	} else {
+		b.WriteString("outputs:\n" + strings.Join(outputs, "\n") + "\n")
+	}
+	if answers.feeds {
+		b.WriteString("# Uncomment to also write the feeds of each section, such as blog/index.xml.\n")
+		b.WriteString("# feeds:\n#   sections: true\n")
+	}
+
+	b.WriteString("\n# A search index for client-side search scripts, written to search-index.json.\n")
+	fmt.Fprintf(&b, "search:\n  enabled: %t\n", answers.search)
+	b.WriteString("---\n")
+	return b.String()
+}
+
+// initCommand runs `grafe init`, which asks for a site's title, baseURL,
+// theme, and outputs, and writes its config.md, with a home page and a
+// layout or the theme, in the current directory or the one given.
+func initCommand(args []string) {
+	flags := flag.NewFlagSet("grafe init", flag.ExitOnError)
+	positional := parseCommandFlags(flags, args)
+	directory := "."
+	if len(positional) > 1 {
+		log.Fatal("usage: grafe init [directory]")
+	} else if len(positional) == 1 {
+		directory = strings.TrimSuffix(positional[0], "/")
+	}
+	if fileExists(directory + "/config.md") {
+		log.Fatalf("%s/config.md already exists.\n", directory)
+	}
+
+	p := prompter{in: bufio.NewScanner(os.Stdin), out: os.Stdout}
+	var answers siteAnswers
+	answers.title = p.ask("Site title", "My site")
+	answers.baseURL = p.askBaseURL()
+	answers.theme = p.ask("Theme, as a directory or git repository URL (empty for none)", "")
+	answers.feeds = p.confirm("RSS and Atom feeds?", true)
+	answers.sitemap = p.confirm("A sitemap?", true)
+	answers.search = p.confirm("A search index?", false)
+	if answers.baseURL == "" && (answers.feeds || answers.sitemap) {
+		fmt.Println("Feeds and the sitemap need absolute URLs; set baseURL in config.md before publishing.")
+	}
+
+	check(os.MkdirAll(directory, 0770))
+	if answers.theme != "" {
+		if fileExists(directory + "/theme") {
+			log.Fatalf("%s/theme already exists.\n", directory)
+		}
+		check(installTheme(answers.theme, directory+"/theme"))
+	}
+	for name, text := range starterSiteFiles {
+		if name == "config.md" {
+			text = siteConfigFile(answers)
+		} else if answers.theme != "" && strings.HasPrefix(name, "templates/") || fileExists(directory+"/"+name) {
+			continue
+		}
+		createDirectoryPath(directory + "/" + name)
+		check(os.WriteFile(directory+"/"+name, []byte(text), 0666))
+	}
+	for _, name := range []string{"static", "templates/layouts", "templates/includes"} {
+		check(os.MkdirAll(directory+"/"+name, 0770))
+	}
+
+	fmt.Printf("Wrote %s/config.md; run grafe serve there to see the site.\n", directory)
+}
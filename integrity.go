@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const signingKeyVariable = "GRAFE_SIGNING_KEY"
+
+// integrityConfig writes a manifest of the SHA-256 hash of every file in
+// the output, in the format `sha256sum -c` reads, and signs it as minisign
+// does when the build has a signing key, so that copies of the site can be
+// checked against it. PublicKey is the minisign public key `grafe verify`
+// checks the signature with.
+type integrityConfig struct {
+	Manifest  string `yaml:"manifest"`
+	PublicKey string `yaml:"publicKey"`
+}
+
+// signingKey is a minisign Ed25519 key: its 8-byte ID and the key itself.
+type signingKey struct {
+	id  [8]byte
+	key []byte
+}
+
+func (key signingKey) idString() string {
+	return fmt.Sprintf("%016X", binary.LittleEndian.Uint64(key.id[:]))
+}
+
+// parseSigningKey decodes a key as grafe writes it, the base64 of `Ed`, the
+// ID, and an Ed25519 key of size bytes.
+func parseSigningKey(text string, size int) (signingKey, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+	if err != nil {
+		return signingKey{}, err
+	}
+	if len(data) != 10+size || string(data[:2]) != "Ed" {
+		return signingKey{}, errors.New("not an Ed25519 minisign key")
+	}
+	var key signingKey
+	copy(key.id[:], data[2:10])
+	key.key = data[10:]
+	return key, nil
+}
+
+func (key signingKey) String() string {
+	return base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), key.id[:]...), key.key...))
+}
+
+// publicKey reads a minisign public key, alone or as a file with its
+// untrusted comment.
+func publicKey(text string) (signingKey, error) {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	return parseSigningKey(lines[len(lines)-1], ed25519.PublicKeySize)
+}
+
+// outputManifest hashes every file in directory but the manifest and
+// its signature.
+func outputManifest(directory string, manifest string) []byte {
+	var names []string
+	walk(directory, func(fileName string) {
+		name := strings.TrimPrefix(fileName, directory+"/")
+		if name != manifest && name != manifest+".minisig" {
+			names = append(names, name)
+		}
+	})
+	sort.Strings(names)
+
+	var out bytes.Buffer
+	for _, name := range names {
+		data, err := os.ReadFile(directory + "/" + name)
+		check(err)
+		fmt.Fprintf(&out, "%x  %s\n", sha256.Sum256(data), name)
+	}
+	return out.Bytes()
+}
+
+// minisign signs data as minisign does by default, prehashed with BLAKE2b,
+// with a trusted comment saying when.
+func minisign(key signingKey, data []byte, now time.Time) []byte {
+	hash := blake2b.Sum512(data)
+	signature := ed25519.Sign(ed25519.PrivateKey(key.key), hash[:])
+	trusted := fmt.Sprintf("timestamp:%d", now.Unix())
+	global := ed25519.Sign(ed25519.PrivateKey(key.key), append(append([]byte(nil), signature...), trusted...))
+
+	return []byte(fmt.Sprintf("untrusted comment: signature from grafe key %s\n%s\ntrusted comment: %s\n%s\n",
+		key.idString(),
+		base64.StdEncoding.EncodeToString(append(append([]byte("ED"), key.id[:]...), signature...)),
+		trusted,
+		base64.StdEncoding.EncodeToString(global)))
+}
+
+// verifyMinisign checks a minisign signature of data, legacy or prehashed,
+// with key, returning its trusted comment.
+func verifyMinisign(key signingKey, data []byte, signatureFile []byte) (string, error) {
+	lines := strings.Split(strings.TrimSpace(string(signatureFile)), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return "", errors.New("not a minisign signature")
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(signature) != 10+ed25519.SignatureSize {
+		return "", errors.New("not a minisign signature")
+	}
+	if !bytes.Equal(signature[2:10], key.id[:]) {
+		return "", fmt.Errorf("signed with key %016X, not %s", binary.LittleEndian.Uint64(signature[2:10]), key.idString())
+	}
+	message := data
+	switch string(signature[:2]) {
+	case "ED":
+		hash := blake2b.Sum512(data)
+		message = hash[:]
+	case "Ed":
+	default:
+		return "", fmt.Errorf("unknown signature algorithm %q", signature[:2])
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key.key), message, signature[10:]) {
+		return "", errors.New("the signature does not match the manifest")
+	}
+
+	trusted := strings.TrimPrefix(lines[2], "trusted comment: ")
+	global, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || !ed25519.Verify(ed25519.PublicKey(key.key), append(append([]byte(nil), signature[10:]...), trusted...), global) {
+		return "", errors.New("the trusted comment has been changed")
+	}
+	return trusted, nil
+}
+
+// writeIntegrityManifest writes the manifest of the output, and its
+// signature if $GRAFE_SIGNING_KEY holds a key.
+func writeIntegrityManifest(config integrityConfig) {
+	if config.Manifest == "" {
+		return
+	}
+	manifest := outputManifest(outputDirectory, config.Manifest)
+	check(os.WriteFile(outputDirectory+"/"+config.Manifest, manifest, 0666))
+	recordOutput(outputDirectory + "/" + config.Manifest)
+
+	secret := os.Getenv(signingKeyVariable)
+	if secret == "" {
+		return
+	}
+	key, err := parseSigningKey(secret, ed25519.PrivateKeySize)
+	if err != nil {
+		log.Fatalf("$%s: %v\n", signingKeyVariable, err)
+	}
+	check(os.WriteFile(outputDirectory+"/"+config.Manifest+".minisig", minisign(key, manifest, time.Now()), 0666))
+	recordOutput(outputDirectory + "/" + config.Manifest + ".minisig")
+}
+
+// siteFiles reads the files of a copy of the site, in a directory or at a
+// URL.
+type siteFiles func(name string) ([]byte, error)
+
+func openSiteFiles(location string) siteFiles {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return func(name string) ([]byte, error) {
+			return os.ReadFile(location + "/" + name)
+		}
+	}
+	client := &http.Client{Timeout: time.Minute}
+	base := strings.TrimSuffix(location, "/") + "/"
+	return func(name string) ([]byte, error) {
+		response, err := client.Get(base + name)
+		if err != nil {
+			return nil, err
+		}
+		defer response.Body.Close()
+		if response.StatusCode == http.StatusNotFound {
+			return nil, os.ErrNotExist
+		}
+		if response.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("GET %s: %s", base+name, response.Status)
+		}
+		return io.ReadAll(response.Body)
+	}
+}
+
+// verifyCommand checks a copy of the site against its signed manifest: the
+// signature first, then the hash of every file the manifest lists. It
+// fails if anything does not match. `-keygen` makes a new signing key.
+func verifyCommand(project projectConfig, args []string) {
+	flags := flag.NewFlagSet("grafe verify", flag.ExitOnError)
+	keyPtr := flags.String("key", "", "The minisign public key, or a file holding it, to check the signature with; defaults to integrity.publicKey.")
+	keygenPtr := flags.Bool("keygen", false, "Make a new signing key and print it with its public key.")
+	positional := parseCommandFlags(flags, args)
+
+	if *keygenPtr {
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		check(err)
+		var id [8]byte
+		_, err = rand.Read(id[:])
+		check(err)
+		publicKey := signingKey{id: id, key: public}
+		fmt.Printf("%s=%s\n\n", signingKeyVariable, signingKey{id: id, key: private})
+		fmt.Printf("untrusted comment: minisign public key %s\n%s\n", publicKey.idString(), publicKey)
+		fmt.Fprintf(os.Stderr, "Keep %s secret, and publish the public key or set it as integrity.publicKey.\n", signingKeyVariable)
+		return
+	}
+
+	_, settings := readSiteConfig(project)
+	config := settings.Integrity
+	if config.Manifest == "" {
+		config.Manifest = "SHA256SUMS"
+	}
+	location := outputDirectory
+	if len(positional) > 0 {
+		location = positional[0]
+	}
+
+	keyText := *keyPtr
+	if data, err := os.ReadFile(keyText); keyText != "" && err == nil {
+		keyText = string(data)
+	}
+	if keyText == "" {
+		keyText = config.PublicKey
+	}
+	if keyText == "" {
+		log.Fatal("usage: grafe verify -key <public key> [directory or URL]")
+	}
+	key, err := publicKey(keyText)
+	if err != nil {
+		log.Fatalf("public key: %v\n", err)
+	}
+
+	files := openSiteFiles(location)
+	manifest, err := files(config.Manifest)
+	if err != nil {
+		log.Fatalf("Could not read the manifest: %v\n", err)
+	}
+	signature, err := files(config.Manifest + ".minisig")
+	if err != nil {
+		log.Fatalf("Could not read the manifest's signature: %v\n", err)
+	}
+	trusted, err := verifyMinisign(key, manifest, signature)
+	if err != nil {
+		log.Fatalf("%s: %v\n", config.Manifest, err)
+	}
+	fmt.Printf("%s is signed by key %s (%s)\n", config.Manifest, key.idString(), trusted)
+
+	failed, checked := 0, 0
+	listed := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(manifest))
+	for scanner.Scan() {
+		sum, name, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok {
+			continue
+		}
+		listed[name] = true
+		checked++
+		data, err := files(name)
+		if err != nil {
+			fmt.Printf("%s: %v\n", name, err)
+			failed++
+			continue
+		}
+		if actual := sha256.Sum256(data); hex.EncodeToString(actual[:]) != sum {
+			fmt.Printf("%s: changed\n", name)
+			failed++
+		}
+	}
+	check(scanner.Err())
+
+	// A directory can also be checked for files added to it.
+	if info, err := os.Stat(location); err == nil && info.IsDir() {
+		for _, line := range strings.Split(strings.TrimSpace(string(outputManifest(location, config.Manifest))), "\n") {
+			if _, name, _ := strings.Cut(line, "  "); name != "" && !listed[name] {
+				fmt.Printf("%s: not in the manifest\n", name)
+				failed++
+			}
+		}
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d files do not match the manifest.\n", failed, checked)
+		os.Exit(1)
+	}
+	fmt.Printf("All %d files match the manifest.\n", checked)
+}
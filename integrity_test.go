@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSigningKeys returns a fixed private key and its public key.
+func testSigningKeys(seed byte) (signingKey, signingKey) {
+	private := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+	id := [8]byte{seed, 1, 2, 3, 4, 5, 6, 7}
+	return signingKey{id: id, key: private}, signingKey{id: id, key: private.Public().(ed25519.PublicKey)}
+}
+
+func TestParseSigningKey(t *testing.T) {
+	private, public := testSigningKeys(1)
+	tests := []struct {
+		name    string
+		text    string
+		size    int
+		wantErr bool
+	}{
+		{"private key", private.String(), ed25519.PrivateKeySize, false},
+		{"public key", public.String(), ed25519.PublicKeySize, false},
+		{"surrounding space", "\n " + public.String() + " \n", ed25519.PublicKeySize, false},
+		{"wrong size", public.String(), ed25519.PrivateKeySize, true},
+		{"wrong algorithm", base64.StdEncoding.EncodeToString(append([]byte("XX"), make([]byte, 8+ed25519.PublicKeySize)...)), ed25519.PublicKeySize, true},
+		{"not base64", "not a key!", ed25519.PublicKeySize, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := parseSigningKey(test.text, test.size)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parseSigningKey gave error %v, want error %v", err, test.wantErr)
+			}
+			if err == nil && key.String() != strings.TrimSpace(test.text) {
+				t.Errorf("parsed key is %s, want %s", key, strings.TrimSpace(test.text))
+			}
+		})
+	}
+
+	file := "untrusted comment: minisign public key " + public.idString() + "\n" + public.String() + "\n"
+	if key, err := publicKey(file); err != nil || key.String() != public.String() {
+		t.Errorf("publicKey of a key file gave %s, %v, want %s", key, err, public)
+	}
+}
+
+func TestVerifyMinisign(t *testing.T) {
+	private, public := testSigningKeys(1)
+	_, otherPublic := testSigningKeys(2)
+	manifest := []byte("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  index.html\n")
+	now := time.Unix(1700000000, 0)
+	signature := string(minisign(private, manifest, now))
+	lines := strings.Split(strings.TrimSpace(signature), "\n")
+
+	legacy := func() string {
+		raw, _ := base64.StdEncoding.DecodeString(lines[1])
+		signed := ed25519.Sign(ed25519.PrivateKey(private.key), manifest)
+		raw = append(append([]byte("Ed"), raw[2:10]...), signed...)
+		trusted := strings.TrimPrefix(lines[2], "trusted comment: ")
+		global := ed25519.Sign(ed25519.PrivateKey(private.key), append(append([]byte(nil), signed...), trusted...))
+		return strings.Join([]string{lines[0], base64.StdEncoding.EncodeToString(raw), lines[2], base64.StdEncoding.EncodeToString(global)}, "\n")
+	}
+
+	tests := []struct {
+		name      string
+		key       signingKey
+		data      []byte
+		signature string
+		want      string
+		wantErr   string
+	}{
+		{
+			name:      "prehashed",
+			key:       public,
+			data:      manifest,
+			signature: signature,
+			want:      "timestamp:1700000000",
+		},
+		{
+			name:      "legacy",
+			key:       public,
+			data:      manifest,
+			signature: legacy(),
+			want:      "timestamp:1700000000",
+		},
+		{
+			name:      "manifest changed",
+			key:       public,
+			data:      append([]byte("0"), manifest[1:]...),
+			signature: signature,
+			wantErr:   "the signature does not match the manifest",
+		},
+		{
+			name:      "trusted comment changed",
+			key:       public,
+			data:      manifest,
+			signature: strings.Replace(signature, "timestamp:1700000000", "timestamp:1800000000", 1),
+			wantErr:   "the trusted comment has been changed",
+		},
+		{
+			name:      "other key",
+			key:       signingKey{id: [8]byte{9}, key: otherPublic.key},
+			data:      manifest,
+			signature: signature,
+			wantErr:   "signed with key " + private.idString(),
+		},
+		{
+			name:      "same ID, other key",
+			key:       signingKey{id: public.id, key: otherPublic.key},
+			data:      manifest,
+			signature: signature,
+			wantErr:   "the signature does not match the manifest",
+		},
+		{
+			name:      "not a signature",
+			key:       public,
+			data:      manifest,
+			signature: "untrusted comment: nothing\n",
+			wantErr:   "not a minisign signature",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			trusted, err := verifyMinisign(test.key, test.data, []byte(test.signature))
+			if test.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), test.wantErr) {
+					t.Errorf("verifyMinisign gave %q, %v, want an error starting %q", trusted, err, test.wantErr)
+				}
+				return
+			}
+			if err != nil || trusted != test.want {
+				t.Errorf("verifyMinisign gave %q, %v, want %q", trusted, err, test.want)
+			}
+		})
+	}
+}
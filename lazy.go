@@ -0,0 +1,188 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"path"
+	"sync"
+)
+
+// lazySite is a site built with `-lazy`, which `grafe serve` renders a page
+// of when it is first requested instead of rendering every page up front.
+// The bodies of the pages nobody asked for are converted in the background,
+// after which the link graph and the files made from the whole site, such
+// as feeds and the search index, are written, and the pages served until
+// then are rendered again with them.
+type lazySite struct {
+	mutex     sync.Mutex
+	builder   *builder
+	site      *Site
+	pages     []*Page
+	targets   map[string]lazyTarget
+	converted map[*Page]bool
+	failed    map[*Page]bool
+	rendered  map[string]bool
+	stopped   bool
+	ready     func()
+}
+
+// lazyTarget is the page written to an output path: the paginator of a list
+// page with that index.
+type lazyTarget struct {
+	page  *Page
+	index int
+}
+
+func (b *builder) buildLazily() *lazySite {
+	pages, site := b.load()
+	lazy := &lazySite{
+		builder:   b,
+		site:      site,
+		pages:     pages,
+		targets:   make(map[string]lazyTarget),
+		converted: make(map[*Page]bool),
+		failed:    make(map[*Page]bool),
+		rendered:  make(map[string]bool),
+	}
+	for _, page := range pages {
+		lazy.targets[page.OutputPath] = lazyTarget{page: page}
+		for i, paginator := range b.paginate(page) {
+			lazy.targets[paginator.page.OutputPath] = lazyTarget{page: page, index: i}
+		}
+	}
+	return lazy
+}
+
+// convert converts the body of page, once.
+func (lazy *lazySite) convert(page *Page) {
+	if lazy.converted[page] {
+		return
+	}
+	lazy.converted[page] = true
+	lazy.builder.wikilinks.current = page
+	if !guardFile(func() { lazy.builder.renderBody(page) }) {
+		lazy.failed[page] = true
+	}
+}
+
+// render writes the page at outputPath unless it has been already, and
+// returns the error building it fails with. Output paths of no page, such
+// as static files, are left alone.
+func (lazy *lazySite) render(outputPath string) error {
+	lazy.mutex.Lock()
+	defer lazy.mutex.Unlock()
+	target, ok := lazy.targets[outputPath]
+	if !ok || lazy.stopped || lazy.rendered[outputPath] {
+		return nil
+	}
+
+	page := target.page
+	lazy.convert(page)
+	if lazy.failed[page] {
+		return fileError{file: page.SourcePath, message: "the page failed to build; see the log"}
+	}
+	err := guardFileError(func() {
+		if paginators := lazy.builder.paginate(page); target.index > 0 {
+			page = paginators[target.index].page
+		}
+		lazy.builder.renderPage(page)
+	})
+	if err == nil {
+		lazy.rendered[outputPath] = true
+	}
+	return err
+}
+
+// convertAll converts the bodies of the pages not yet requested, then
+// writes what needs every page.
+func (lazy *lazySite) convertAll() {
+	var wikilinkProblems []wikilinkProblem
+	for _, page := range lazy.pages {
+		lazy.mutex.Lock()
+		if lazy.stopped {
+			lazy.mutex.Unlock()
+			return
+		}
+		wikilinkProblems = append(wikilinkProblems, lazy.builder.checkPageLinks(page)...)
+		lazy.convert(page)
+		lazy.mutex.Unlock()
+	}
+
+	lazy.mutex.Lock()
+	if lazy.stopped {
+		lazy.mutex.Unlock()
+		return
+	}
+	b := lazy.builder
+	writeWikilinkReport(b.settings.Wikilinks.Report, wikilinkProblems)
+	buildLinkGraph(lazy.site, lazy.pages)
+	b.fetchReactions(lazy.pages)
+	b.writeSiteOutputs(lazy.site, lazy.pages)
+	served := len(lazy.rendered) > 0
+	lazy.rendered = make(map[string]bool)
+	lazy.mutex.Unlock()
+
+	log.Printf("Converted all %d pages\n", len(lazy.pages))
+	if served && lazy.ready != nil {
+		lazy.ready()
+	}
+}
+
+// stop keeps a site that has been rebuilt from rendering any more.
+func (lazy *lazySite) stop() {
+	lazy.mutex.Lock()
+	lazy.stopped = true
+	lazy.mutex.Unlock()
+}
+
+// lazyPages holds the lazily built site the server renders pages of, which
+// every rebuild replaces.
+type lazyPages struct {
+	mutex sync.Mutex
+	site  *lazySite
+}
+
+// stop stops the site being served before it is rebuilt, so that it does
+// not write to the output as the rebuild clears it.
+func (pages *lazyPages) stop() {
+	if site := pages.current(); site != nil {
+		site.stop()
+	}
+}
+
+// replace serves site instead of the one before and starts converting its
+// pages, calling ready once they are.
+func (pages *lazyPages) replace(site *lazySite, ready func()) {
+	pages.mutex.Lock()
+	defer pages.mutex.Unlock()
+	site.ready = ready
+	pages.site = site
+	go site.convertAll()
+}
+
+func (pages *lazyPages) current() *lazySite {
+	pages.mutex.Lock()
+	defer pages.mutex.Unlock()
+	return pages.site
+}
+
+// renderOnRequest renders the page a request is for, by the output paths
+// indexFileServer would answer it with, before next serves it.
+func renderOnRequest(pages *lazyPages, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if site := pages.current(); site != nil {
+			file := outputDirectory + path.Clean("/"+r.URL.Path)
+			for _, outputPath := range []string{file, file + ".html", path.Join(file, "index.html")} {
+				if _, ok := site.targets[outputPath]; !ok {
+					continue
+				}
+				if err := site.render(outputPath); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				break
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	rankDamping     = 0.85
+	rankIterations  = 50
+	suggestionCount = 5
+)
+
+var hrefPattern = regexp.MustCompile(`\shref="([^"]*)"`)
+
+// linkKey normalizes a site path so that `/post/`, `/post`, and
+// `/post/index.html` name the same page.
+func linkKey(p string) string {
+	p = strings.TrimSuffix(p, "index.html")
+	if p != "/" {
+		p = strings.TrimSuffix(p, "/")
+	}
+	return p
+}
+
+// pageLinks returns the pages that the rendered body of page links to,
+// each once, in the order they are first linked.
+func pageLinks(page *Page, pagesByURL map[string]*Page) []*Page {
+	base, err := url.Parse(page.RelPermalink)
+	if err != nil {
+		return nil
+	}
+
+	var links []*Page
+	seen := map[*Page]bool{page: true}
+	for _, match := range hrefPattern.FindAllStringSubmatch(string(page.Body), -1) {
+		href, err := url.Parse(match[1])
+		if err != nil || (href.Host != "" && href.Host != base.Host) {
+			continue
+		}
+		target, ok := pagesByURL[linkKey(base.ResolveReference(href).Path)]
+		if ok && !seen[target] {
+			seen[target] = true
+			links = append(links, target)
+		}
+	}
+	return links
+}
+
+// rankPages scores pages by PageRank over the link graph: a page ranks
+// highly when many pages, or a few highly ranked ones, link to it.
+func rankPages(pages []*Page) {
+	if len(pages) == 0 {
+		return
+	}
+	count := float64(len(pages))
+	ranks := make(map[*Page]float64, len(pages))
+	for _, page := range pages {
+		ranks[page] = 1 / count
+	}
+
+	for i := 0; i < rankIterations; i++ {
+		dangling := 0.0
+		for _, page := range pages {
+			if len(page.Links) == 0 {
+				dangling += ranks[page]
+			}
+		}
+		next := make(map[*Page]float64, len(pages))
+		for _, page := range pages {
+			next[page] = (1-rankDamping)/count + rankDamping*dangling/count
+		}
+		for _, page := range pages {
+			for _, target := range page.Links {
+				next[target] += rankDamping * ranks[page] / float64(len(page.Links))
+			}
+		}
+		ranks = next
+	}
+
+	for _, page := range pages {
+		page.Rank = ranks[page]
+	}
+}
+
+// suggestPages returns the pages to read after page: its neighbours in the
+// link graph and theirs, weighted by closeness and by rank.
+func suggestPages(page *Page) []*Page {
+	scores := make(map[*Page]float64)
+	neighbours := func(p *Page) []*Page {
+		return append(append([]*Page{}, p.Links...), p.Backlinks...)
+	}
+	for _, neighbour := range neighbours(page) {
+		scores[neighbour] += 1
+		for _, next := range neighbours(neighbour) {
+			scores[next] += 0.5
+		}
+	}
+	delete(scores, page)
+
+	suggestions := make([]*Page, 0, len(scores))
+	for suggestion := range scores {
+		suggestions = append(suggestions, suggestion)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		a := scores[suggestions[i]] * suggestions[i].Rank
+		b := scores[suggestions[j]] * suggestions[j].Rank
+		if a != b {
+			return a > b
+		}
+		return suggestions[i].RelPermalink < suggestions[j].RelPermalink
+	})
+	if len(suggestions) > suggestionCount {
+		suggestions = suggestions[:suggestionCount]
+	}
+	return suggestions
+}
+
+// buildLinkGraph links every page to the pages its body links to and back,
+// ranks them, and suggests next reads for each. Site.Hubs lists the linked
+// pages from the highest ranked down.
+func buildLinkGraph(site *Site, pages []*Page) {
+	pagesByURL := make(map[string]*Page, len(pages))
+	for _, page := range pages {
+		pagesByURL[linkKey(page.RelPermalink)] = page
+	}
+
+	for _, page := range pages {
+		page.Links = pageLinks(page, pagesByURL)
+		for _, target := range page.Links {
+			target.Backlinks = append(target.Backlinks, page)
+		}
+	}
+	rankPages(pages)
+
+	site.Hubs = nil
+	for _, page := range pages {
+		page.Suggestions = suggestPages(page)
+		if len(page.Links) > 0 || len(page.Backlinks) > 0 {
+			site.Hubs = append(site.Hubs, page)
+		}
+	}
+	sort.SliceStable(site.Hubs, func(i, j int) bool {
+		return site.Hubs[i].Rank > site.Hubs[j].Rank
+	})
+}
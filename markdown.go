@@ -0,0 +1,97 @@
+package main
+
+import (
+	"path"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	meta "github.com/yuin/goldmark-meta"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+
+	fences "github.com/stefanfritsch/goldmark-fences"
+
+	wikitable "github.com/movsb/goldmark-wiki-table"
+
+	"go.abhg.dev/goldmark/wikilink"
+
+	mathjax "github.com/litao91/goldmark-mathjax"
+)
+
+type markdownProfileWriter struct {
+	path   string
+	writer goldmark.Markdown
+}
+
+type markdownWriters struct {
+	defaultWriter goldmark.Markdown
+	profiles      []markdownProfileWriter
+}
+
+func newMarkdownWriter(options markdownOptions, resolver wikilink.Resolver) goldmark.Markdown {
+	extensions := []goldmark.Extender{
+		meta.Meta,
+		extension.Table,
+		&wikilink.Extender{Resolver: resolver},
+	}
+	if options.Math == nil || *options.Math {
+		extensions = append(extensions, mathjax.MathJax)
+	}
+	extensions = append(extensions,
+		extension.TaskList,
+		extension.Table,
+		&fences.Extender{},
+		wikitable.New(),
+		newHTMLSanitizer(options.Sanitize, options.AllowedTags, options.AllowedAttributes),
+	)
+	if options.Highlight != nil {
+		extensions = append(extensions, options.Highlight.extension())
+	}
+
+	return goldmark.New(
+		goldmark.WithParserOptions(
+			parser.WithAutoHeadingID(),
+			parser.WithAttribute(),
+		),
+		goldmark.WithExtensions(extensions...),
+		goldmark.WithRendererOptions(
+			renderer.WithNodeRenderers(
+				util.Prioritized(
+					extension.NewTableHTMLRenderer(),
+					500,
+				),
+			),
+		),
+	)
+}
+
+func newMarkdownWriters(config markdownConfig, resolver wikilink.Resolver) markdownWriters {
+	writers := markdownWriters{
+		defaultWriter: newMarkdownWriter(config.markdownOptions, resolver),
+	}
+	for _, profile := range config.Profiles {
+		writers.profiles = append(writers.profiles, markdownProfileWriter{
+			path:   profile.Path,
+			writer: newMarkdownWriter(config.markdownOptions.merge(profile.markdownOptions), resolver),
+		})
+	}
+	return writers
+}
+
+// writerFor returns the writer of the first profile whose path rule matches
+// contentPath, a path relative to the content directory. Rules containing
+// glob characters are matched with path.Match; all others are prefixes.
+func (writers markdownWriters) writerFor(contentPath string) goldmark.Markdown {
+	for _, profile := range writers.profiles {
+		if strings.ContainsAny(profile.path, "*?[") {
+			if matched, _ := path.Match(profile.path, contentPath); matched {
+				return profile.writer
+			}
+		} else if strings.HasPrefix(contentPath, profile.path) {
+			return profile.writer
+		}
+	}
+	return writers.defaultWriter
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// minifyOutput minifies the HTML, CSS, and JavaScript files in directory
+// in place. Each minifier only drops what cannot change how the file
+// works, such as comments and the indentation templates leave, so that
+// minifying a file twice changes nothing and an unchanged page kept from the
+// last build needs no special case.
+func minifyOutput(directory string) {
+	walk(directory, func(fileName string) {
+		minify := minifierFor(fileName)
+		if minify == nil {
+			return
+		}
+		data, err := os.ReadFile(fileName)
+		check(err)
+		if minified := minify(data); len(minified) < len(data) {
+			check(os.WriteFile(fileName, minified, 0666))
+		}
+	})
+}
+
+// minifierFor returns the minifier of the file at fileName, or nil if it
+// is not HTML, CSS, or JavaScript.
+func minifierFor(fileName string) func([]byte) []byte {
+	switch getExtension(fileName) {
+	case ".html", ".htm":
+		return minifyHTML
+	case ".css":
+		return minifyCSS
+	case ".js", ".mjs":
+		return minifyJS
+	}
+	return nil
+}
+
+// isSpace reports whether c is whitespace in HTML, CSS, and JavaScript
+// alike.
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// collapseSpace replaces every run of whitespace in text with a newline if
+// it has one, and a space otherwise.
+func collapseSpace(text []byte) []byte {
+	var out bytes.Buffer
+	for i := 0; i < len(text); {
+		if !isSpace(text[i]) {
+			out.WriteByte(text[i])
+			i++
+			continue
+		}
+		separator := byte(' ')
+		for ; i < len(text) && isSpace(text[i]); i++ {
+			if text[i] == '\n' {
+				separator = '\n'
+			}
+		}
+		out.WriteByte(separator)
+	}
+	return out.Bytes()
+}
+
+// minifyHTML collapses the whitespace between and inside the elements of a
+// page, except in <pre> and <textarea>, drops its comments, except
+// conditional ones, and minifies its inline styles and scripts. Tags are
+// written as they are, attributes and all.
+func minifyHTML(data []byte) []byte {
+	var out bytes.Buffer
+	tokenizer := html.NewTokenizer(bytes.NewReader(data))
+	preformatted := 0
+	var rawText func([]byte) []byte
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			if tokenizer.Err() != io.EOF {
+				return data
+			}
+			return out.Bytes()
+		}
+		raw := append([]byte(nil), tokenizer.Raw()...)
+		switch tokenType {
+		case html.CommentToken:
+			if bytes.HasPrefix(raw, []byte("<!--[if")) {
+				out.Write(raw)
+			}
+		case html.TextToken:
+			switch {
+			case rawText != nil:
+				out.Write(rawText(raw))
+			case preformatted > 0:
+				out.Write(raw)
+			default:
+				// Text around a dropped comment joins the text before it.
+				text := collapseSpace(raw)
+				if end := out.Len() - 1; len(text) > 0 && isSpace(text[0]) && end >= 0 && isSpace(out.Bytes()[end]) {
+					if text[0] == '\n' {
+						out.Bytes()[end] = '\n'
+					}
+					text = text[1:]
+				}
+				out.Write(text)
+			}
+		case html.StartTagToken, html.EndTagToken:
+			name, hasAttributes := tokenizer.TagName()
+			start := tokenType == html.StartTagToken
+			switch string(name) {
+			case "pre", "textarea":
+				if start {
+					preformatted++
+				} else if preformatted > 0 {
+					preformatted--
+				}
+			case "style":
+				rawText = nil
+				if start {
+					rawText = minifyCSS
+				}
+			case "script":
+				rawText = nil
+				if start {
+					scriptType := ""
+					for hasAttributes {
+						var key, value []byte
+						key, value, hasAttributes = tokenizer.TagAttr()
+						if string(key) == "type" {
+							scriptType = strings.ToLower(strings.TrimSpace(string(value)))
+						}
+					}
+					switch scriptType {
+					case "", "module", "text/javascript", "application/javascript":
+						rawText = minifyJS
+					default:
+						rawText = func(text []byte) []byte { return text }
+					}
+				}
+			}
+			out.Write(raw)
+		default:
+			out.Write(raw)
+		}
+	}
+}
+
+// minifyCSS drops the comments of a stylesheet, except those starting
+// `/*!`, such as licenses, collapses its whitespace, drops the whitespace
+// around braces, semicolons, commas, and child combinators, and drops the
+// last semicolon of every block. Whitespace around colons is kept, as in a
+// selector such as `a :hover` it is a descendant combinator.
+func minifyCSS(data []byte) []byte {
+	var out []byte
+	trimmed := func(c byte) bool {
+		return strings.IndexByte("{};,>", c) >= 0
+	}
+	// pendingSpace is whether whitespace was dropped before the next
+	// token, which needs it unless it or the token before is trimmed.
+	pendingSpace := false
+	emit := func(token []byte) {
+		if pendingSpace && len(out) > 0 && !trimmed(out[len(out)-1]) && !trimmed(token[0]) {
+			out = append(out, ' ')
+		}
+		pendingSpace = false
+		if token[0] == '}' && len(out) > 0 && out[len(out)-1] == ';' {
+			out = out[:len(out)-1]
+		}
+		out = append(out, token...)
+	}
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '"' || c == '\'':
+			end := stringEnd(data, i)
+			emit(data[i:end])
+			i = end
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				return append(out, data[i:]...)
+			}
+			end += i + 4
+			if data[i+2] == '!' {
+				emit(data[i:end])
+			} else {
+				pendingSpace = true
+			}
+			i = end
+		case isSpace(c):
+			pendingSpace = true
+			i++
+		default:
+			emit(data[i : i+1])
+			i++
+		}
+	}
+	return out
+}
+
+// stringEnd returns the index after the string literal starting at start,
+// skipping escaped quotes.
+func stringEnd(data []byte, start int) int {
+	quote := data[start]
+	for i := start + 1; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		case '\n':
+			if quote != '`' {
+				return i
+			}
+		}
+	}
+	return len(data)
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// regexpKeywords are the keywords after which a slash starts a regular
+// expression rather than dividing.
+var regexpKeywords = map[string]bool{
+	"return": true, "typeof": true, "instanceof": true, "in": true, "of": true, "new": true,
+	"delete": true, "void": true, "throw": true, "case": true, "do": true, "else": true, "yield": true, "await": true,
+}
+
+// minifyJS drops the comments of a script, except those starting `/*!`,
+// and the indentation, blank lines, and spaces its tokens do not need. Line
+// breaks are kept, since automatic semicolon insertion depends on them.
+// Scripts with a source map are left as they are, as the map would no
+// longer match them.
+func minifyJS(data []byte) []byte {
+	if bytes.Contains(data, []byte("//# sourceMappingURL=")) {
+		return data
+	}
+	var out []byte
+	// templates holds the brace depth of every template literal whose
+	// ${} the script is in, and braces the current depth.
+	var templates []int
+	braces := 0
+	lastWord := ""
+	// pendingSpace is the whitespace dropped before the next token: 0, ' ',
+	// or '\n'.
+	var pendingSpace byte
+	space := func(separator byte) {
+		if separator == '\n' || pendingSpace == 0 {
+			pendingSpace = separator
+		}
+	}
+	emit := func(token []byte) {
+		if pendingSpace != 0 && len(out) > 0 {
+			previous, next := out[len(out)-1], token[0]
+			needed := isWordByte(previous) && isWordByte(next) ||
+				strings.IndexByte("+-", previous) >= 0 && previous == next ||
+				previous == '.' || next == '.' || previous == '/' && (next == '/' || next == '*')
+			if pendingSpace == '\n' {
+				out = append(out, '\n')
+			} else if needed {
+				out = append(out, ' ')
+			}
+		}
+		pendingSpace = 0
+		out = append(out, token...)
+	}
+	regexpAllowed := func() bool {
+		if len(out) == 0 {
+			return true
+		}
+		previous := out[len(out)-1]
+		if isWordByte(previous) {
+			return regexpKeywords[lastWord]
+		}
+		return strings.IndexByte(")]}", previous) < 0
+	}
+	// templateEnd returns the index after the literal text of a template
+	// starting at i, after its closing backtick or opening ${.
+	templateEnd := func(i int) (int, bool) {
+		for ; i < len(data); i++ {
+			switch {
+			case data[i] == '\\':
+				i++
+			case data[i] == '`':
+				return i + 1, false
+			case data[i] == '$' && i+1 < len(data) && data[i+1] == '{':
+				return i + 2, true
+			}
+		}
+		return len(data), false
+	}
+
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '\n' || c == '\r':
+			space('\n')
+			i++
+		case isSpace(c):
+			space(' ')
+			i++
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			end := bytes.IndexByte(data[i:], '\n')
+			if end < 0 {
+				end = len(data) - i
+			}
+			i += end
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				return append(out, data[i:]...)
+			}
+			comment := data[i : i+end+4]
+			if comment[2] == '!' {
+				emit(comment)
+			} else if bytes.IndexByte(comment, '\n') >= 0 {
+				space('\n')
+			} else {
+				space(' ')
+			}
+			i += len(comment)
+		case c == '"' || c == '\'':
+			end := stringEnd(data, i)
+			emit(data[i:end])
+			lastWord = ""
+			i = end
+		case c == '`':
+			end, expression := templateEnd(i + 1)
+			if expression {
+				templates = append(templates, braces)
+			}
+			emit(data[i:end])
+			lastWord = ""
+			i = end
+		case c == '}' && len(templates) > 0 && templates[len(templates)-1] == braces:
+			templates = templates[:len(templates)-1]
+			end, expression := templateEnd(i + 1)
+			if expression {
+				templates = append(templates, braces)
+			}
+			emit(data[i:end])
+			lastWord = ""
+			i = end
+		case c == '/' && regexpAllowed():
+			end, class := i+1, false
+			for ; end < len(data) && data[end] != '\n'; end++ {
+				if data[end] == '\\' {
+					end++
+				} else if data[end] == '[' {
+					class = true
+				} else if data[end] == ']' {
+					class = false
+				} else if data[end] == '/' && !class {
+					end++
+					break
+				}
+			}
+			emit(data[i:min(end, len(data))])
+			lastWord = ""
+			i = end
+		case isWordByte(c):
+			end := i
+			for end < len(data) && isWordByte(data[end]) {
+				end++
+			}
+			emit(data[i:end])
+			lastWord = string(data[i:end])
+			i = end
+		default:
+			if c == '{' {
+				braces++
+			} else if c == '}' {
+				braces--
+			}
+			emit(data[i : i+1])
+			lastWord = ""
+			i++
+		}
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const exampleSiteDirectory = "exampleSite"
+
+var starterSiteFiles = map[string]string{
+	"config.md": "---\ntitle: My site\n---\n",
+	"content/index.md": "---\ntitle: Home\ntemplate: page\n---\n\n" +
+		"Welcome to your new site.\n",
+	"templates/layouts/page.html": "<!DOCTYPE html>\n<html>\n<head><title>{{ .Title }}</title></head>\n" +
+		"<body>\n<main>{{ .Body }}</main>\n</body>\n</html>\n",
+}
+
+func copyTree(sourceDirectory string, destinationDirectory string) {
+	walk(sourceDirectory, func(fileName string) {
+		destination := destinationDirectory + strings.TrimPrefix(fileName, sourceDirectory)
+		createDirectoryPath(destination)
+		copyFile(fileName, destination)
+	})
+}
+
+func isGitRepository(theme string) bool {
+	return strings.Contains(theme, "://") || strings.HasPrefix(theme, "git@") || strings.HasSuffix(theme, ".git")
+}
+
+// installTheme clones theme into directory if it is a git repository URL, or
+// copies it there if it is a local directory.
+func installTheme(theme string, directory string) error {
+	if isGitRepository(theme) {
+		clone := exec.Command("git", "clone", "--depth", "1", theme, directory)
+		clone.Stdout = os.Stdout
+		clone.Stderr = os.Stderr
+		return clone.Run()
+	}
+
+	info, err := os.Stat(theme)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a theme directory", theme)
+	}
+	copyTree(filepath.ToSlash(filepath.Clean(theme)), directory)
+	return nil
+}
+
+// newSiteCommand creates a site in an empty directory. With `-theme`, the
+// theme is installed as the site's theme and its exampleSite directory,
+// if it has one, is copied into the site as its starting content;
+// otherwise a minimal config, home page, and layout are written.
+func newSiteCommand(args []string) {
+	flags := flag.NewFlagSet("grafe new site", flag.ExitOnError)
+	themePtr := flags.String("theme", "", "Theme to install into `theme`: a directory or a git repository URL.")
+	positional := parseCommandFlags(flags, args)
+	if len(positional) != 1 {
+		log.Fatal("usage: grafe new site <directory> [-theme <theme>]")
+	}
+	directory := filepath.ToSlash(filepath.Clean(positional[0]))
+
+	entries, err := os.ReadDir(directory)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		check(err)
+	}
+	if len(entries) > 0 {
+		log.Fatalf("%s already exists and is not empty.\n", directory)
+	}
+	err = os.MkdirAll(directory, 0770)
+	check(err)
+
+	example := ""
+	if *themePtr != "" {
+		err = installTheme(*themePtr, directory+"/theme")
+		check(err)
+		if info, err := os.Stat(directory + "/theme/" + exampleSiteDirectory); err == nil && info.IsDir() {
+			example = directory + "/theme/" + exampleSiteDirectory
+		}
+	}
+
+	if example != "" {
+		copyTree(example, directory)
+	} else {
+		for name, text := range starterSiteFiles {
+			if *themePtr != "" && strings.HasPrefix(name, "templates/") {
+				continue
+			}
+			createDirectoryPath(directory + "/" + name)
+			err = os.WriteFile(directory+"/"+name, []byte(text), 0666)
+			check(err)
+		}
+	}
+	for _, name := range []string{"static", "templates/layouts", "templates/includes"} {
+		err = os.MkdirAll(directory+"/"+name, 0770)
+		check(err)
+	}
+
+	fmt.Printf("Created a new site in %s; run grafe there to build it.\n", directory)
+}
+
+// newCommand runs `grafe new <kind> ...`.
+func newCommand(args []string) {
+	if len(args) == 0 || args[0] != "site" {
+		log.Fatal("usage: grafe new site <directory> [-theme <theme>]")
+	}
+	newSiteCommand(args[1:])
+}
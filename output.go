@@ -0,0 +1,247 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var defaultAssetExtensions = []string{
+	".css", ".js", ".mjs", ".map",
+	".avif", ".gif", ".ico", ".jpeg", ".jpg", ".png", ".svg", ".webp",
+	".otf", ".ttf", ".woff", ".woff2",
+	".mp3", ".mp4", ".ogg", ".webm", ".pdf",
+}
+
+var urlAttributePattern = regexp.MustCompile(`(\s(?:src|href|poster|data-src|action)\s*=\s*)(["'])(/[^"']*)(["'])`)
+
+var srcsetAttributePattern = regexp.MustCompile(`(\s(?:srcset|data-srcset)\s*=\s*)(["'])([^"']*)(["'])`)
+
+var cssURLPattern = regexp.MustCompile(`(url\(\s*)(["']?)(/[^)"']*)(["']?\s*\))`)
+
+type urlRewriter struct {
+	assetHost       string
+	assetExtensions map[string]bool
+	pathPrefix      string
+}
+
+func newURLRewriter(config urlRewriteConfig, basePath string) *urlRewriter {
+	if config.PathPrefix == "" {
+		config.PathPrefix = basePath
+	}
+	if config.AssetHost == "" && strings.Trim(config.PathPrefix, "/") == "" {
+		return nil
+	}
+
+	extensions := config.AssetExtensions
+	if len(extensions) == 0 {
+		extensions = defaultAssetExtensions
+	}
+
+	rewriter := &urlRewriter{
+		assetHost:       strings.TrimSuffix(config.AssetHost, "/"),
+		assetExtensions: make(map[string]bool),
+		pathPrefix:      "/" + strings.Trim(config.PathPrefix, "/"),
+	}
+	if rewriter.pathPrefix == "/" {
+		rewriter.pathPrefix = ""
+	}
+	for _, extension := range extensions {
+		rewriter.assetExtensions[strings.ToLower(extension)] = true
+	}
+	return rewriter
+}
+
+// rewrite maps a root-relative URL to its location under the path prefix
+// and, for assets, on the asset host. URLs that already start with the path
+// prefix are not prefixed again; any other URL is returned unchanged.
+func (rewriter *urlRewriter) rewrite(url string) string {
+	if !strings.HasPrefix(url, "/") || strings.HasPrefix(url, "//") {
+		return url
+	}
+
+	if rewriter.pathPrefix != "" && url != rewriter.pathPrefix && !strings.HasPrefix(url, rewriter.pathPrefix+"/") {
+		url = rewriter.pathPrefix + url
+	}
+
+	urlPath := strings.SplitN(strings.SplitN(url, "?", 2)[0], "#", 2)[0]
+	if rewriter.assetHost != "" && rewriter.assetExtensions[strings.ToLower(path.Ext(urlPath))] {
+		return rewriter.assetHost + url
+	}
+	return url
+}
+
+func (rewriter *urlRewriter) rewriteSrcset(srcset string) string {
+	candidates := strings.Split(srcset, ",")
+	for i, candidate := range candidates {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+		fields[0] = rewriter.rewrite(fields[0])
+		candidates[i] = strings.Join(fields, " ")
+	}
+	return strings.Join(candidates, ", ")
+}
+
+func (rewriter *urlRewriter) rewriteCSS(css string) string {
+	return cssURLPattern.ReplaceAllStringFunc(css, func(match string) string {
+		parts := cssURLPattern.FindStringSubmatch(match)
+		return parts[1] + parts[2] + rewriter.rewrite(parts[3]) + parts[4]
+	})
+}
+
+func (rewriter *urlRewriter) rewriteHTML(html string) string {
+	html = urlAttributePattern.ReplaceAllStringFunc(html, func(match string) string {
+		parts := urlAttributePattern.FindStringSubmatch(match)
+		return parts[1] + parts[2] + rewriter.rewrite(parts[3]) + parts[4]
+	})
+	html = srcsetAttributePattern.ReplaceAllStringFunc(html, func(match string) string {
+		parts := srcsetAttributePattern.FindStringSubmatch(match)
+		return parts[1] + parts[2] + rewriter.rewriteSrcset(parts[3]) + parts[4]
+	})
+	return rewriter.rewriteCSS(html)
+}
+
+// transformOutput applies the output-time rewrites to a file about to be
+// written to outputPath.
+func (b *builder) transformOutput(outputPath string, data []byte) []byte {
+	if b.urlRewriter == nil {
+		return data
+	}
+	switch strings.ToLower(filepath.Ext(outputPath)) {
+	case ".html", ".htm":
+		return []byte(b.urlRewriter.rewriteHTML(string(data)))
+	case ".css":
+		return []byte(b.urlRewriter.rewriteCSS(string(data)))
+	}
+	return data
+}
+
+// builtOutputs holds the files the build has written to the output, or
+// found up to date there, by their path in the output, and which of them
+// were written for a content file, such as the sizes of its images. The
+// next build removes the files this one wrote that it does not.
+var builtOutputs struct {
+	sync.Mutex
+	files    map[string]bool
+	bySource map[string]map[string]bool
+}
+
+// resetOutputs forgets the outputs of a previous build.
+func resetOutputs() {
+	builtOutputs.Lock()
+	builtOutputs.files = make(map[string]bool)
+	builtOutputs.bySource = make(map[string]map[string]bool)
+	builtOutputs.Unlock()
+}
+
+// outputName is the path of outputPath within the output, or false if it
+// is not in the output.
+func outputName(outputPath string) (string, bool) {
+	directory := filepath.ToSlash(filepath.Clean(outputDirectory))
+	name := filepath.ToSlash(filepath.Clean(outputPath))
+	if !strings.HasPrefix(name, directory+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(name, directory+"/"), true
+}
+
+func recordOutput(outputPath string) {
+	recordOutputFor("", outputPath)
+}
+
+// recordOutputFor records that the file at outputPath was written for the
+// content file at sourcePath, so that it is kept by a build that keeps the
+// page's body from the cache rather than writing it again.
+func recordOutputFor(sourcePath string, outputPath string) {
+	name, ok := outputName(outputPath)
+	if !ok {
+		return
+	}
+	builtOutputs.Lock()
+	defer builtOutputs.Unlock()
+	if builtOutputs.files == nil {
+		builtOutputs.files = make(map[string]bool)
+		builtOutputs.bySource = make(map[string]map[string]bool)
+	}
+	builtOutputs.files[name] = true
+	if sourcePath == "" {
+		return
+	}
+	if builtOutputs.bySource[sourcePath] == nil {
+		builtOutputs.bySource[sourcePath] = make(map[string]bool)
+	}
+	builtOutputs.bySource[sourcePath][name] = true
+}
+
+func sortedNames(names map[string]bool) []string {
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// recordedOutputs returns the path within the output of every file the
+// build has written.
+func recordedOutputs() []string {
+	builtOutputs.Lock()
+	defer builtOutputs.Unlock()
+	return sortedNames(builtOutputs.files)
+}
+
+// outputsFor returns the path within the output of every file written for
+// the content file at sourcePath.
+func outputsFor(sourcePath string) []string {
+	builtOutputs.Lock()
+	defer builtOutputs.Unlock()
+	if len(builtOutputs.bySource[sourcePath]) == 0 {
+		return nil
+	}
+	return sortedNames(builtOutputs.bySource[sourcePath])
+}
+
+func (b *builder) writeOutput(outputPath string, data []byte) {
+	createDirectoryPath(outputPath)
+	err := os.WriteFile(outputPath, b.transformOutput(outputPath, data), 0666)
+	check(err)
+	recordOutput(outputPath)
+}
+
+func (b *builder) copyToOutput(sourcePath string, outputPath string) {
+	if transform, ok := b.transformFor(sourcePath); ok {
+		data, err := transform.run(sourcePath)
+		check(err)
+		b.writeOutput(transform.transformedPath(outputPath), data)
+		return
+	}
+
+	switch strings.ToLower(filepath.Ext(sourcePath)) {
+	case ".html", ".htm", ".css":
+		data, err := os.ReadFile(sourcePath)
+		check(err)
+		b.writeOutput(outputPath, b.settings.expandTokens(data))
+	default:
+		if b.settings.expandsTokens(outputPath) {
+			data, err := os.ReadFile(sourcePath)
+			check(err)
+			b.writeOutput(outputPath, b.settings.expandTokens(data))
+			return
+		}
+		createDirectoryPath(outputPath)
+		copyFile(sourcePath, outputPath)
+		recordOutput(outputPath)
+	}
+}
+
+func (b *builder) copyDirectory(directoryToCopy string, newDirectoryPath string) {
+	walk(directoryToCopy, func(fileName string) {
+		b.copyToOutput(fileName, newDirectoryPath+strings.TrimPrefix(fileName, directoryToCopy))
+	})
+}
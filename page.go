@@ -0,0 +1,847 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"path"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark"
+	meta "github.com/yuin/goldmark-meta"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+var taxonomyNames = []string{"tags", "categories"}
+
+var datedNamePattern = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})-(.+)$`)
+
+var frontMatterDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"06-01-02",
+}
+
+// Page is the data every page template is executed with.
+type Page struct {
+	Title           string
+	Summary         string
+	Date            time.Time
+	Section         string
+	Slug            string
+	Status          string
+	Draft           bool
+	Owner           string
+	ReviewBy        time.Time
+	Lastmod         time.Time
+	IsList          bool
+	Noindex         bool
+	Nofollow        bool
+	Robots          string
+	NoAI            bool
+	License         *licenseConfig
+	InSitemap       bool
+	Template        string
+	Params          map[string]interface{}
+	Tags            []string
+	Categories      []string
+	Terms           map[string][]string
+	Permalink       string
+	RelPermalink    string
+	Body            template.HTML
+	TableOfContents template.HTML
+	Headings        []*Heading
+	Cover           *coverImage
+	Event           *Event
+	Pages           []*Page
+	ListPages       []*Page
+	Links           []*Page
+	Backlinks       []*Page
+	Rank            float64
+	Suggestions     []*Page
+	Comments        []*Comment
+	Paginator       *Paginator
+	Reactions       *Reactions
+	Scratch         *Scratch
+	Site            *Site
+
+	// PageParams, SiteParams, and PagePath predate the typed page model and
+	// are kept for existing themes.
+	PageParams map[string]interface{}
+	SiteParams map[string]interface{}
+	PagePath   []string
+
+	SourcePath string
+	OutputPath string
+
+	metaData       map[string]interface{}
+	source         []byte
+	document       ast.Node
+	shortcodes     []string
+	markdownWriter goldmark.Markdown
+	assets         *pageAssets
+	commentsKey    string
+
+	// termMembers is set on generated taxonomy term pages, which list the
+	// pages with their term rather than those below them.
+	termMembers []*Page
+}
+
+// Site is the data shared by every page: all pages in the order they are
+// listed (newest first), grouped by section and by taxonomy term. List pages
+// (`_index.md`) are kept apart in ListPages.
+type Site struct {
+	Title      string
+	BaseURL    string
+	Author     interface{}
+	Pages      []*Page
+	ListPages  []*Page
+	Sections   map[string][]*Page
+	Taxonomies map[string]map[string][]*Page
+	Events     EventCalendar
+	Hubs       []*Page
+	Params     map[string]interface{}
+	Data       map[string]interface{}
+	BasePath   string
+	Scratch    *Scratch
+	Now        time.Time
+
+	Environment  string
+	IsServer     bool
+	IsProduction bool
+	Flags        map[string]string
+
+	settings     siteConfig
+	termPages    map[string]map[string]*Page
+	fingerprints *fingerprints
+}
+
+type builder struct {
+	templates          map[string]*template.Template
+	shortcodeTemplates map[string]*template.Template
+	markdownWriters    markdownWriters
+	commentWriter      goldmark.Markdown
+	wikilinks          *wikilinkResolver
+	config             map[string]interface{}
+	settings           siteConfig
+	urlRewriter        *urlRewriter
+	ignoreObsidian     bool
+	environment        string
+	isServer           bool
+	flags              map[string]string
+	outputTemplates    map[string]*texttemplate.Template
+	metrics            *templateMetrics
+	cache              *buildCache
+	changedSince       string
+	buildDrafts        bool
+	typescript         bool
+	minify             bool
+	paramSchemas       map[string]*paramSchema
+	termPages          map[string]map[string]*Page
+	built              *buildCache
+}
+
+// contentPathInfo is the metadata implied by where a content file is and
+// what it is called.
+type contentPathInfo struct {
+	outputPath string
+	slug       string
+	date       time.Time
+	isList     bool
+}
+
+func splitDatedName(name string) (string, time.Time) {
+	match := datedNamePattern.FindStringSubmatch(name)
+	if match == nil {
+		return name, time.Time{}
+	}
+	date, err := time.Parse("2006-01-02", match[1])
+	if err != nil {
+		return name, time.Time{}
+	}
+	return match[2], date
+}
+
+// parseContentPath derives the output path, slug, and date of a content
+// file from its path relative to the content directory:
+// `posts/2024-05-01-my-post.md` is written to `public/posts/my-post.html`,
+// or `public/posts/my-post/index.html` with pretty URLs, and dated
+// 2024-05-01, and `posts/_index.md` is the list page written to
+// `public/posts/index.html`. Page bundles take their slug and date from
+// their directory, which keeps its name so that bundled files still resolve.
+func (settings siteConfig) parseContentPath(contentPath string) contentPathInfo {
+	var info contentPathInfo
+	directory, name := path.Split(removeExtension(contentPath))
+	if name == "_index" {
+		info.isList = true
+		name = "index"
+	}
+
+	if name == "index" {
+		if directory != "" {
+			info.slug, info.date = splitDatedName(path.Base(directory))
+		}
+	} else {
+		info.slug, info.date = splitDatedName(name)
+		name = info.slug
+	}
+
+	info.outputPath = settings.pageFile(directory, name)
+	return info
+}
+
+// overridePath applies the `url` or `slug` front matter of the page at
+// contentPath to where it is written, so that it can keep an old URL
+// whatever its file is called. A slug renames the file within its
+// directory, which page bundles and list pages keep.
+func (settings siteConfig) overridePath(info contentPathInfo, contentPath string, metaData map[string]interface{}, sourcePath string) contentPathInfo {
+	slug := frontMatterString(metaData, "slug")
+	if url := frontMatterString(metaData, "url"); url != "" {
+		urlPath := path.Clean("/" + url)
+		switch {
+		case urlPath == "/" || strings.HasSuffix(url, "/"):
+			info.outputPath = outputDirectory + strings.TrimSuffix(urlPath, "/") + "/index.html"
+		case path.Ext(urlPath) != "":
+			info.outputPath = outputDirectory + urlPath
+		default:
+			directory, name := path.Split(strings.TrimPrefix(urlPath, "/"))
+			info.outputPath = settings.pageFile(directory, name)
+		}
+		info.slug = path.Base(removeExtension(strings.TrimSuffix(urlPath, "/")))
+		if info.slug == "/" {
+			info.slug = ""
+		}
+	} else if slug != "" {
+		directory, name := path.Split(removeExtension(contentPath))
+		switch {
+		case strings.Contains(slug, "/"):
+			warnAt(sourcePath, sourceLine(sourcePath, "slug:"), "slug %q names a directory; use url to move the page", slug)
+			return info
+		case name == "index" || name == "_index":
+			warnAt(sourcePath, sourceLine(sourcePath, "slug:"), "slug cannot rename a page bundle or list page, which are written to their directory; use url")
+			return info
+		}
+		info.outputPath = settings.pageFile(directory, slug)
+	}
+	if slug != "" {
+		info.slug = slug
+	}
+	return info
+}
+
+// pageFile returns the output path of the page name in directory, which is
+// relative to the output directory: `name.html`, or `name/index.html` with
+// pretty URLs.
+func (settings siteConfig) pageFile(directory string, name string) string {
+	if name != "index" && settings.UglyURLs != nil && !*settings.UglyURLs {
+		return outputDirectory + "/" + directory + name + "/index.html"
+	}
+	return outputDirectory + "/" + directory + name + ".html"
+}
+
+// parseFrontMatterDate parses a front matter date, reading dates without an
+// offset in location.
+func parseFrontMatterDate(value interface{}, location *time.Location) (time.Time, error) {
+	switch date := value.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return date, nil
+	case string:
+		for _, layout := range frontMatterDateLayouts {
+			if parsed, err := time.ParseInLocation(layout, strings.TrimSpace(date), location); err == nil {
+				return parsed, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse date %v", value)
+}
+
+func frontMatterString(metaData map[string]interface{}, key string) string {
+	if value := frontMatterValue(metaData, key); value != nil {
+		return fmt.Sprint(value)
+	}
+	return ""
+}
+
+func frontMatterStrings(metaData map[string]interface{}, key string) []string {
+	switch value := frontMatterValue(metaData, key).(type) {
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values
+	case string:
+		return []string{value}
+	}
+	return nil
+}
+
+// normalizeFrontMatter converts decoded YAML into the shapes templates
+// expect everywhere: maps with string keys, lists of normalized values, and
+// scalars as they are.
+func normalizeFrontMatter(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		normalized := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			normalized[fmt.Sprint(key)] = normalizeFrontMatter(item)
+		}
+		return normalized
+	case map[string]interface{}:
+		normalized := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			normalized[key] = normalizeFrontMatter(item)
+		}
+		return normalized
+	case []interface{}:
+		normalized := make([]interface{}, len(value))
+		for i, item := range value {
+			normalized[i] = normalizeFrontMatter(item)
+		}
+		return normalized
+	}
+	return value
+}
+
+func normalizeFrontMatterMap(metaData map[string]interface{}) map[string]interface{} {
+	if metaData == nil {
+		return make(map[string]interface{})
+	}
+	return normalizeFrontMatter(metaData).(map[string]interface{})
+}
+
+// frontMatterParams returns the params map of normalized front matter. Any
+// other value is ignored with a warning rather than failing the build.
+func frontMatterParams(metaData map[string]interface{}, sourcePath string) map[string]interface{} {
+	switch value := frontMatterValue(metaData, "params").(type) {
+	case nil:
+	case map[string]interface{}:
+		return value
+	default:
+		warnAt(sourcePath, sourceLine(sourcePath, "params:"), "params should be a map of names to values, not %T; ignoring it", value)
+	}
+	return make(map[string]interface{})
+}
+
+// setIndexing reads the `Noindex`, `Nofollow`, `Sitemap`, and `NoAI` front
+// matter flags, the last defaulting to the site's crawlers.noai setting.
+// Pages that are not to be indexed are left out of the sitemap and feeds as
+// well, and `.Robots` holds their robots meta tag content.
+func (page *Page) setIndexing(metaData map[string]interface{}, settings siteConfig) {
+	page.Noindex = frontMatterValue(metaData, "noindex") == true
+	page.Nofollow = frontMatterValue(metaData, "nofollow") == true
+	page.InSitemap = !page.Noindex && frontMatterValue(metaData, "sitemap") != false
+	page.NoAI = settings.Crawlers.NoAI
+	if noAI, ok := frontMatterValue(metaData, "noai").(bool); ok {
+		page.NoAI = noAI
+	}
+
+	var robots []string
+	if page.Noindex {
+		robots = append(robots, "noindex")
+	}
+	if page.Nofollow {
+		robots = append(robots, "nofollow")
+	}
+	if page.NoAI {
+		robots = append(robots, "noai", "noimageai")
+	}
+	page.Robots = strings.Join(robots, ", ")
+}
+
+// loadPage parses the content file at sourcePath. It returns nil for pages
+// whose status the build environment leaves out, such as drafts.
+func (b *builder) loadPage(sourcePath string) *Page {
+	fileData, err := b.readContentFile(sourcePath)
+	checkFile(sourcePath, err)
+	fileData = b.settings.expandTokens(fileData)
+	fileData, err = stripConditionalBlocks(fileData, b.settings.Conditions)
+	checkFile(sourcePath, err)
+
+	contentPath := strings.TrimPrefix(sourcePath, contentDirectory+"/")
+	assets := newPageAssets()
+	source, shortcodes, err := expandShortcodes(string(fileData), sourcePath, b.shortcodeTemplates, assets, &b.settings)
+	checkFile(sourcePath, err)
+	source = string(b.settings.expandTokens([]byte(source)))
+
+	markdownWriter := b.markdownWriters.writerFor(contentPath)
+	context := parser.NewContext()
+	document := markdownWriter.Parser().Parse(text.NewReader([]byte(source)), parser.WithContext(context))
+	rawMetaData, err := meta.TryGet(context)
+	if err != nil {
+		failAt(sourcePath, 0, "front matter: %v", err)
+	}
+	metaData := normalizeFrontMatterMap(rawMetaData)
+
+	status := pageStatus(metaData, sourcePath)
+	if !b.settings.buildsStatus(b.environment, status) && !(b.buildDrafts && status == "draft") {
+		return nil
+	}
+
+	warnUnknownFrontMatter(metaData, sourcePath, b.settings.taxonomies())
+
+	pageAssets := newPageAssets()
+	pageAssets.addFrontMatterAssets(metaData, sourcePath)
+	for _, requirement := range assets.requirements {
+		pageAssets.add(requirement)
+	}
+	b.settings.Consent.checkRequirements(pageAssets, sourcePath)
+
+	pathInfo := b.settings.overridePath(b.settings.parseContentPath(contentPath), contentPath, metaData, sourcePath)
+
+	date, err := parseFrontMatterDate(frontMatterValue(metaData, "date"), b.settings.location)
+	if err != nil {
+		failAt(sourcePath, sourceLine(sourcePath, "date:"), "date: %v", err)
+	}
+	if date.IsZero() && !pathInfo.date.IsZero() {
+		date = time.Date(pathInfo.date.Year(), pathInfo.date.Month(), pathInfo.date.Day(), 0, 0, 0, 0, b.settings.location)
+	}
+
+	reviewBy, err := parseFrontMatterDate(frontMatterValue(metaData, "reviewBy"), b.settings.location)
+	if err != nil {
+		failAt(sourcePath, sourceLine(sourcePath, "reviewBy:"), "reviewBy: %v", err)
+	}
+
+	section := ""
+	if strings.Contains(contentPath, "/") {
+		section = strings.SplitN(contentPath, "/", 2)[0]
+	}
+
+	outputPath := pathInfo.outputPath
+
+	templateName := frontMatterString(metaData, "template")
+	if templateName == "" {
+		templateName = b.settings.Template
+		if pathInfo.isList && b.settings.ListTemplate != "" {
+			templateName = b.settings.ListTemplate
+		}
+	}
+
+	params := frontMatterParams(metaData, sourcePath)
+	if !pathInfo.isList {
+		b.checkParams(section, params, sourcePath)
+	}
+
+	page := &Page{
+		Title:        b.pageTitle(metaData, document, []byte(source), pathInfo.slug, sourcePath),
+		Summary:      frontMatterString(metaData, "summary"),
+		Date:         date,
+		Section:      section,
+		Slug:         pathInfo.slug,
+		Status:       status,
+		Draft:        status == "draft",
+		Owner:        frontMatterString(metaData, "owner"),
+		ReviewBy:     reviewBy,
+		Lastmod:      pageLastmod(metaData, sourcePath, date, b.settings.location),
+		IsList:       pathInfo.isList,
+		Template:     templateName,
+		Params:       lowercaseKeys(params),
+		Tags:         frontMatterStrings(metaData, "tags"),
+		Categories:   frontMatterStrings(metaData, "categories"),
+		Terms:        b.settings.pageTerms(metaData),
+		Event:        parseEvent(metaData, sourcePath, b.settings.location),
+		RelPermalink: b.settings.sitePath(b.settings.pageURL(outputPath)),
+		Scratch:      newScratch(),
+		PageParams:   metaData,
+		SiteParams:   b.config,
+		PagePath:     strings.Split(strings.TrimSuffix(removeExtension(contentPath), "/index"), "/"),
+
+		SourcePath: sourcePath,
+		OutputPath: outputPath,
+
+		metaData:       metaData,
+		source:         []byte(source),
+		document:       document,
+		shortcodes:     shortcodes,
+		markdownWriter: markdownWriter,
+		assets:         pageAssets,
+	}
+	page.Permalink = b.settings.siteURL(b.settings.pageURL(outputPath))
+	page.setIndexing(metaData, b.settings)
+	page.License = pageLicense(metaData, sourcePath, b.settings.License)
+	page.commentsKey = commentsKey(outputPath)
+	page.Comments = b.pageComments(page.commentsKey)
+
+	return page
+}
+
+// pageTitle returns the title in the front matter or, for pages without
+// one, the text of their first top-level heading. Failing that, it makes one
+// from the file name, or for the home page takes the site's, with a
+// warning.
+func (b *builder) pageTitle(metaData map[string]interface{}, document ast.Node, source []byte, slug string, sourcePath string) string {
+	if title := frontMatterString(metaData, "title"); title != "" {
+		return title
+	}
+	title := ""
+	ast.Walk(document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if heading, ok := node.(*ast.Heading); ok && entering && heading.Level == 1 {
+			title = strings.TrimSpace(string(heading.Text(source)))
+			return ast.WalkStop, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	if title != "" {
+		return title
+	}
+
+	title = strings.TrimSpace(strings.NewReplacer("-", " ", "_", " ").Replace(slug))
+	if title == "" {
+		title = frontMatterString(b.config, "title")
+	}
+	if first, size := utf8.DecodeRuneInString(title); size > 0 {
+		title = string(unicode.ToUpper(first)) + title[size:]
+	}
+	warnAt(sourcePath, 0, "no title in the front matter or heading; using %q", title)
+	return title
+}
+
+func (b *builder) collectContent() []*Page {
+	var pages []*Page
+	written := make(map[string]string)
+	walk(contentDirectory, func(fileName string) {
+		if b.isContentFile(fileName) && !strings.Contains(fileName, "IGNORE") {
+			var page *Page
+			if guardFile(func() { page = b.loadPage(fileName) }) && page != nil {
+				if other, ok := written[page.OutputPath]; ok {
+					warnAt(fileName, 0, "is written to %s, as %s is, and replaces it", page.OutputPath, other)
+				}
+				written[page.OutputPath] = fileName
+				pages = append(pages, page)
+			}
+		} else {
+			if !strings.Contains(fileName, ".git") && !strings.Contains(fileName, "IGNORE") && !(b.ignoreObsidian && strings.Contains(fileName, ".obsidian")) {
+				b.copyToOutput(fileName, outputDirectory+"/"+strings.TrimPrefix(fileName, contentDirectory+"/"))
+			}
+		}
+	})
+	return pages
+}
+
+// eachFrontMatter calls fn with the front matter of every content file, for
+// commands that report on the content without building it. Files whose
+// front matter cannot be read are recorded for checkErrors and skipped.
+func (b *builder) eachFrontMatter(fn func(sourcePath string, metaData map[string]interface{})) {
+	walk(contentDirectory, func(fileName string) {
+		if !b.isContentFile(fileName) || strings.Contains(fileName, "IGNORE") {
+			return
+		}
+		guardFile(func() {
+			data, err := b.readContentFile(fileName)
+			checkFile(fileName, err)
+			metaData, _, err := splitFrontMatter(string(data))
+			checkFile(fileName, err)
+			fn(fileName, metaData)
+		})
+	})
+}
+
+func sortPages(pages []*Page) {
+	sort.SliceStable(pages, func(i, j int) bool {
+		if !pages[i].Date.Equal(pages[j].Date) {
+			return pages[i].Date.After(pages[j].Date)
+		}
+		return pages[i].RelPermalink < pages[j].RelPermalink
+	})
+}
+
+func (b *builder) assembleSite(pages []*Page, data map[string]interface{}) *Site {
+	site := &Site{
+		Title:      frontMatterString(b.config, "title"),
+		BaseURL:    b.settings.BaseURL,
+		Author:     normalizeFrontMatter(frontMatterValue(b.config, "author")),
+		Sections:   make(map[string][]*Page),
+		Taxonomies: make(map[string]map[string][]*Page),
+		Params:     lowercaseKeys(b.config),
+		Data:       data,
+		BasePath:   b.settings.sitePath("/"),
+		Scratch:    newScratch(),
+		Now:        b.settings.now(),
+
+		Environment:  b.environment,
+		IsServer:     b.isServer,
+		IsProduction: b.environment == "production",
+		Flags:        b.flags,
+
+		settings:     b.settings,
+		termPages:    b.termPages,
+		fingerprints: newFingerprints(b.settings, b.minify),
+	}
+
+	for _, page := range pages {
+		page.Site = site
+		if page.IsList {
+			site.ListPages = append(site.ListPages, page)
+		} else {
+			site.Pages = append(site.Pages, page)
+		}
+	}
+	sortPages(site.Pages)
+	sortPages(site.ListPages)
+	for _, list := range site.ListPages {
+		list.Pages = pagesBelow(site.Pages, list)
+		if list.termMembers != nil {
+			list.Pages = list.termMembers
+		}
+		list.ListPages = pagesBelow(site.ListPages, list)
+	}
+	site.Events = buildEventCalendar(site.Pages, site.Now)
+
+	for _, taxonomy := range b.settings.taxonomies() {
+		site.Taxonomies[taxonomy] = make(map[string][]*Page)
+	}
+
+	for _, page := range site.Pages {
+		site.Sections[page.Section] = append(site.Sections[page.Section], page)
+		for taxonomy, terms := range page.Terms {
+			for _, term := range terms {
+				// Spellings sharing a term page are listed as one term.
+				if termPage := b.termPages[taxonomy][term]; termPage != nil {
+					term = termPage.Params["term"].(string)
+				}
+				listed := site.Taxonomies[taxonomy][term]
+				if len(listed) == 0 || listed[len(listed)-1] != page {
+					site.Taxonomies[taxonomy][term] = append(listed, page)
+				}
+			}
+		}
+	}
+
+	return site
+}
+
+// pagesBelow returns the pages written within the directory of the list
+// page list, such as every post for the `_index.md` of a blog.
+func pagesBelow(pages []*Page, list *Page) []*Page {
+	directory := path.Dir(list.OutputPath) + "/"
+	var below []*Page
+	for _, page := range pages {
+		if page != list && strings.HasPrefix(page.OutputPath, directory) {
+			below = append(below, page)
+		}
+	}
+	return below
+}
+
+func (b *builder) renderBody(page *Page) {
+	b.executeCodeBlocks(page)
+	toc := b.pageTOC(page.metaData, page.SourcePath)
+	entries := numberHeadings(page.document, page.source, toc)
+	page.TableOfContents = renderTOC(entries, toc)
+	page.Headings = headingTree(entries)
+
+	b.processContentImages(page)
+
+	var buf bytes.Buffer
+	err := page.markdownWriter.Renderer().Render(&buf, page.source, page.document)
+	checkFile(page.SourcePath, err)
+
+	page.Body = template.HTML(restoreShortcodes(buf.String(), page.shortcodes))
+	page.Cover = deriveCoverImage(page.SourcePath, page.OutputPath, page.metaData, b.settings)
+}
+
+func (b *builder) renderPage(page *Page) {
+	if page.Template == "" {
+		failAt(page.SourcePath, 0, "no template is set in the front matter, and config.md sets no default template")
+	}
+	pageTemplateFile := addExtension(page.Template, ".html")
+
+	pageTemplate, ok := b.templates[pageTemplateFile]
+	if !ok {
+		failAt(page.SourcePath, sourceLine(page.SourcePath, "template:"), "the template %s does not exist", pageTemplateFile)
+	}
+
+	pageTemplate, err := pageTemplate.Clone()
+	checkFile(page.SourcePath, err)
+	pageTemplate.Funcs(pageFuncMap(page, pageTemplate, b.metrics))
+
+	var buf bytes.Buffer
+	start := time.Now()
+	err = pageTemplate.ExecuteTemplate(&buf, pageTemplateFile, page)
+	checkFile(page.SourcePath, err)
+	b.metrics.record("layout "+pageTemplateFile, start)
+
+	b.writeOutput(page.OutputPath, buf.Bytes())
+}
+
+// renderPages executes the templates of pages, each with the pages of its
+// list after it, on every CPU. Rendering only reads the site, which is
+// complete by then, so that a template can read any other page.
+func (b *builder) renderPages(pages [][]*Page) {
+	var wait sync.WaitGroup
+	limit := make(chan struct{}, runtime.GOMAXPROCS(0))
+	for _, outputs := range pages {
+		wait.Add(1)
+		go func(outputs []*Page) {
+			defer wait.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+
+			guardFile(func() {
+				for _, page := range outputs {
+					b.renderPage(page)
+				}
+			})
+		}(outputs)
+	}
+	wait.Wait()
+}
+
+// load copies the static files to the output, compiling their Sass and
+// TypeScript, reads every page of the site, without converting or
+// executing any of them, and resizes the images of images.directories.
+func (b *builder) load() ([]*Page, *Site) {
+	b.copyDirectory(themeDirectory+"/static", outputDirectory)
+	b.copyDirectory(staticDirectory, outputDirectory)
+	b.compileSass(outputDirectory)
+	if b.typescript {
+		transpileTypescript(outputDirectory)
+	}
+	b.writeHighlightStylesheet()
+
+	pages := b.collectContent()
+	b.processImageDirectories()
+	for _, dataPages := range b.settings.DataPages {
+		pages = append(pages, b.generateDataPages(dataPages)...)
+	}
+	pages = append(pages, b.generateEventPages(pages)...)
+	data := readSiteData(dataDirectory)
+	pages = append(pages, b.generateTaxonomyPages(pages, data)...)
+	site := b.assembleSite(pages, data)
+
+	b.wikilinks.index(pages)
+	return pages, site
+}
+
+// writeSiteOutputs writes the files made from the whole site rather than
+// one page, such as feeds and the search index.
+func (b *builder) writeSiteOutputs(site *Site, pages []*Page) {
+	b.writeAliases(pages)
+	b.renderOutputs(site)
+	b.writeDomainFiles()
+	b.writeRobotsFile(site)
+	b.writeSearchIndex(site)
+	b.writeContentAPI(site)
+	b.writeQueryOutputs(site)
+}
+
+// build builds the site in phases: load collects the pages and assembles
+// the site of them, their bodies are converted and linked up, completing
+// the site, the pages are rendered from it in parallel, and the files made
+// from the whole site are written.
+func (b *builder) build() *Site {
+	pages, site := b.load()
+	previous := b.cache
+	cache := &buildCache{
+		Inputs:    b.hashInputs(),
+		Structure: hashStructure(pages, b.wikilinks),
+		Pages:     make(map[string]cachedPage, len(pages)),
+	}
+	reuseBodies := previous != nil && previous.Inputs == cache.Inputs && previous.Structure == cache.Structure
+
+	var preview map[*Page]bool
+	if b.changedSince != "" {
+		var err error
+		preview, err = changedPages(b.changedSince, pages)
+		if err != nil {
+			log.Fatalf("Could not find the pages changed since %s: %v\n", b.changedSince, err)
+		}
+	}
+
+	var wikilinkProblems []wikilinkProblem
+	unchanged := make(map[*Page]bool)
+	failed := make(map[*Page]bool)
+	for _, page := range pages {
+		if preview != nil && !preview[page] {
+			continue
+		}
+		wikilinkProblems = append(wikilinkProblems, b.checkPageLinks(page)...)
+		source := hashPageSource(page)
+		if cached, ok := previous.page(page.OutputPath); reuseBodies && ok && cached.Source == source {
+			page.Body, page.TableOfContents, page.Headings = cached.Body, cached.TableOfContents, cached.Headings
+			for _, output := range cached.Outputs {
+				recordOutputFor(page.SourcePath, outputDirectory+"/"+output)
+			}
+			if !guardFile(func() {
+				page.Cover = deriveCoverImage(page.SourcePath, page.OutputPath, page.metaData, b.settings)
+				b.processContentImages(page)
+			}) {
+				failed[page] = true
+				continue
+			}
+			unchanged[page] = true
+		} else {
+			b.wikilinks.current = page
+			if !guardFile(func() { b.renderBody(page) }) {
+				failed[page] = true
+				continue
+			}
+		}
+		cache.Pages[page.OutputPath] = cachedPage{Source: source, Body: page.Body, TableOfContents: page.TableOfContents, Headings: page.Headings}
+	}
+	writeWikilinkReport(b.settings.Wikilinks.Report, wikilinkProblems)
+	buildLinkGraph(site, pages)
+
+	b.fetchReactions(pages)
+	cache.Site = hashSite(cache.Structure, pages)
+	reusePages := reuseBodies && previous.Site == cache.Site
+
+	var rendering [][]*Page
+	for _, page := range pages {
+		paginators := b.paginate(page)
+		for i := 1; i < len(paginators); i++ {
+			cache.Pages[paginators[i].page.OutputPath] = cachedPage{}
+		}
+		if failed[page] || preview != nil && !preview[page] || reusePages && unchanged[page] && outputExists(page.OutputPath) {
+			continue
+		}
+		outputs := []*Page{page}
+		for i := 1; i < len(paginators); i++ {
+			outputs = append(outputs, paginators[i].page)
+		}
+		rendering = append(rendering, outputs)
+	}
+	b.renderPages(rendering)
+	if preview != nil {
+		fmt.Printf("Built %d pages changed since %s:\n", len(preview), b.changedSince)
+		for _, page := range pages {
+			if preview[page] {
+				fmt.Println(page.Permalink)
+			}
+		}
+	}
+	b.writeSiteOutputs(site, pages)
+	if preview == nil {
+		for _, page := range pages {
+			if cached, ok := cache.Pages[page.OutputPath]; ok {
+				cached.Outputs = outputsFor(page.SourcePath)
+				cache.Pages[page.OutputPath] = cached
+			}
+		}
+		for outputPath := range cache.Pages {
+			recordOutput(outputPath)
+		}
+		if previous != nil {
+			removeStaleOutputs(previous)
+		}
+		b.built = cache
+	}
+
+	return site
+}
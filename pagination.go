@@ -0,0 +1,78 @@
+package main
+
+import (
+	"path"
+
+	"github.com/spf13/cast"
+)
+
+// Paginator is one page of a list page's `.Pages`: the pages on it, its
+// number counting from 1, its URL, and its neighbours, which are nil past
+// either end.
+type Paginator struct {
+	Pages      []*Page
+	PageNumber int
+	TotalPages int
+	URL        string
+	First      *Paginator
+	Last       *Paginator
+	Prev       *Paginator
+	Next       *Paginator
+
+	page *Page
+}
+
+// paginate splits the pages below list into pages of its `paginate` front
+// matter, or the site's, number of items. The first is list itself; the
+// others are copies of it written to `page/2/index.html` and on within its
+// directory. It returns nil for lists that are not paginated.
+func (b *builder) paginate(list *Page) []*Paginator {
+	size := b.settings.Paginate
+	if value := frontMatterValue(list.metaData, "paginate"); value != nil {
+		size = cast.ToInt(value)
+	}
+	if size <= 0 || !list.IsList {
+		return nil
+	}
+
+	total := (len(list.Pages) + size - 1) / size
+	if total == 0 {
+		total = 1
+	}
+	paginators := make([]*Paginator, total)
+	for i := range paginators {
+		end := (i + 1) * size
+		if end > len(list.Pages) {
+			end = len(list.Pages)
+		}
+		paginator := &Paginator{
+			Pages:      list.Pages[i*size : end],
+			PageNumber: i + 1,
+			TotalPages: total,
+			page:       list,
+		}
+		if i > 0 {
+			// Copying the list after its body is rendered gives every
+			// page of it the same body.
+			page := *list
+			page.OutputPath = path.Join(path.Dir(list.OutputPath), "page", cast.ToString(i+1), "index.html")
+			page.RelPermalink = b.settings.sitePath(b.settings.pageURL(page.OutputPath))
+			page.Permalink = b.settings.siteURL(b.settings.pageURL(page.OutputPath))
+			page.Scratch = newScratch()
+			paginator.page = &page
+		}
+		paginator.page.Paginator = paginator
+		paginator.URL = paginator.page.RelPermalink
+		paginators[i] = paginator
+	}
+	for i, paginator := range paginators {
+		paginator.First, paginator.Last = paginators[0], paginators[total-1]
+		if i > 0 {
+			paginator.Prev = paginators[i-1]
+		}
+		if i < total-1 {
+			paginator.Next = paginators[i+1]
+		}
+	}
+	return paginators
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// paramSchema is the part of JSON Schema that describes the params of a
+// section's pages: their types, which are required, the values they may
+// take, and their defaults, which pages that leave a param out get.
+// Schemas are read as YAML, so they can be written in either.
+type paramSchema struct {
+	Type                 schemaTypes             `yaml:"type"`
+	Title                string                  `yaml:"title"`
+	Description          string                  `yaml:"description"`
+	Properties           map[string]*paramSchema `yaml:"properties"`
+	Required             []string                `yaml:"required"`
+	AdditionalProperties interface{}             `yaml:"additionalProperties"`
+	Items                *paramSchema            `yaml:"items"`
+	Enum                 []interface{}           `yaml:"enum"`
+	Default              interface{}             `yaml:"default"`
+	Pattern              string                  `yaml:"pattern"`
+	Minimum              *float64                `yaml:"minimum"`
+	Maximum              *float64                `yaml:"maximum"`
+	MinLength            *int                    `yaml:"minLength"`
+	MaxLength            *int                    `yaml:"maxLength"`
+	Deprecated           bool                    `yaml:"deprecated"`
+
+	pattern *regexp.Regexp
+}
+
+// schemaTypes is the type of a schema, one name or a list of them.
+type schemaTypes []string
+
+func (types *schemaTypes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		*types = schemaTypes{name}
+		return nil
+	}
+	var names []string
+	if err := unmarshal(&names); err != nil {
+		return fmt.Errorf("type should be a type name or a list of them")
+	}
+	*types = names
+	return nil
+}
+
+// readParamSchemas reads the schema of every section in paramSchemas, by
+// the section, and compiles their patterns.
+func readParamSchemas(paramSchemas map[string]string) (map[string]*paramSchema, error) {
+	schemas := make(map[string]*paramSchema, len(paramSchemas))
+	for section, schemaFile := range paramSchemas {
+		data, err := os.ReadFile(schemaFile)
+		if err != nil {
+			return nil, fmt.Errorf("paramSchemas.%s: %w", section, err)
+		}
+		var schema paramSchema
+		if err := yaml.Unmarshal(data, &schema); err != nil {
+			return nil, fmt.Errorf("%s: %w", schemaFile, err)
+		}
+		if err := schema.compile(); err != nil {
+			return nil, fmt.Errorf("%s: %w", schemaFile, err)
+		}
+		schemas[section] = &schema
+	}
+	return schemas, nil
+}
+
+func (schema *paramSchema) compile() error {
+	for _, name := range schema.Type {
+		switch name {
+		case "string", "number", "integer", "boolean", "array", "object", "null":
+		default:
+			return fmt.Errorf("unknown type %q", name)
+		}
+	}
+	if schema.Pattern != "" {
+		pattern, err := regexp.Compile(schema.Pattern)
+		if err != nil {
+			return fmt.Errorf("pattern: %w", err)
+		}
+		schema.pattern = pattern
+	}
+	for name, property := range schema.Properties {
+		if err := property.compile(); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if schema.Items != nil {
+		return schema.Items.compile()
+	}
+	return nil
+}
+
+// schemaFor returns the schema of the params of pages in section: its own,
+// or the one of every other section, "*".
+func (b *builder) schemaFor(section string) *paramSchema {
+	if schema, ok := b.paramSchemas[section]; ok {
+		return schema
+	}
+	return b.paramSchemas["*"]
+}
+
+// checkParams checks the params of the page at sourcePath, which is not a
+// list page, against the schema of its section, filling in the defaults of
+// those it leaves out. Params that break the schema fail the page; params
+// that are not in it but look like a misspelling of one that is are warned
+// about.
+func (b *builder) checkParams(section string, params map[string]interface{}, sourcePath string) {
+	schema := b.schemaFor(section)
+	if schema == nil {
+		return
+	}
+	var problems []string
+	schema.check("params", params, sourcePath, &problems)
+	if len(problems) > 0 {
+		failAt(sourcePath, sourceLine(sourcePath, "params:"), "the params do not match the schema of the section:\n    %s", strings.Join(problems, "\n    "))
+	}
+	for name, property := range schema.Properties {
+		if property.Default != nil && frontMatterValue(params, name) == nil {
+			params[name] = normalizeFrontMatter(property.Default)
+		}
+	}
+}
+
+// schemaTypeOf returns the schema types value has; a whole number is both
+// an integer and a number.
+func schemaTypeOf(value interface{}) []string {
+	switch value := value.(type) {
+	case nil:
+		return []string{"null"}
+	case string:
+		return []string{"string"}
+	case bool:
+		return []string{"boolean"}
+	case int:
+		return []string{"integer", "number"}
+	case float64:
+		if value == math.Trunc(value) {
+			return []string{"integer", "number"}
+		}
+		return []string{"number"}
+	case []interface{}:
+		return []string{"array"}
+	case map[string]interface{}:
+		return []string{"object"}
+	}
+	return []string{fmt.Sprintf("%T", value)}
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	switch value := value.(type) {
+	case int:
+		return float64(value), true
+	case float64:
+		return value, true
+	}
+	return 0, false
+}
+
+// check adds a problem for every way value, the param at key, breaks the
+// schema.
+func (schema *paramSchema) check(key string, value interface{}, sourcePath string, problems *[]string) {
+	if len(schema.Type) > 0 {
+		matches := false
+		for _, name := range schemaTypeOf(value) {
+			for _, wanted := range schema.Type {
+				matches = matches || name == wanted
+			}
+		}
+		if !matches {
+			*problems = append(*problems, fmt.Sprintf("%s should be %s, not %#v", key, strings.Join(schema.Type, " or "), value))
+			return
+		}
+	}
+	if len(schema.Enum) > 0 {
+		allowed := false
+		for _, option := range schema.Enum {
+			allowed = allowed || fmt.Sprint(normalizeFrontMatter(option)) == fmt.Sprint(value)
+		}
+		if !allowed {
+			options := make([]string, len(schema.Enum))
+			for i, option := range schema.Enum {
+				options[i] = fmt.Sprintf("%#v", option)
+			}
+			*problems = append(*problems, fmt.Sprintf("%s should be one of %s, not %#v", key, strings.Join(options, ", "), value))
+		}
+	}
+	if schema.Deprecated {
+		warnAt(sourcePath, sourceLine(sourcePath, key[strings.LastIndex(key, ".")+1:]+":"), "%s is deprecated by the schema of the section", key)
+	}
+
+	switch value := value.(type) {
+	case string:
+		length := len([]rune(value))
+		if schema.MinLength != nil && length < *schema.MinLength {
+			*problems = append(*problems, fmt.Sprintf("%s should be at least %d characters long", key, *schema.MinLength))
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			*problems = append(*problems, fmt.Sprintf("%s should be at most %d characters long", key, *schema.MaxLength))
+		}
+		if schema.pattern != nil && !schema.pattern.MatchString(value) {
+			*problems = append(*problems, fmt.Sprintf("%s should match %s, not %q", key, schema.Pattern, value))
+		}
+	case int, float64:
+		number, _ := toNumber(value)
+		if schema.Minimum != nil && number < *schema.Minimum {
+			*problems = append(*problems, fmt.Sprintf("%s should be at least %g, not %g", key, *schema.Minimum, number))
+		}
+		if schema.Maximum != nil && number > *schema.Maximum {
+			*problems = append(*problems, fmt.Sprintf("%s should be at most %g, not %g", key, *schema.Maximum, number))
+		}
+	case []interface{}:
+		if schema.Items != nil {
+			for i, item := range value {
+				schema.Items.check(fmt.Sprintf("%s[%d]", key, i), item, sourcePath, problems)
+			}
+		}
+	case map[string]interface{}:
+		schema.checkProperties(key, value, sourcePath, problems)
+	}
+}
+
+// checkProperties checks the entries of an object, which like all params
+// are named without regard to case.
+func (schema *paramSchema) checkProperties(key string, value map[string]interface{}, sourcePath string, problems *[]string) {
+	for _, name := range schema.Required {
+		if frontMatterValue(value, name) == nil {
+			*problems = append(*problems, fmt.Sprintf("%s.%s is required", key, name))
+		}
+	}
+	for _, name := range sortedKeys(value) {
+		var property *paramSchema
+		for propertyName, candidate := range schema.Properties {
+			if strings.EqualFold(name, propertyName) {
+				property = candidate
+			}
+		}
+		if property != nil {
+			property.check(key+"."+name, value[name], sourcePath, problems)
+			continue
+		}
+		closest := closestSetting(name, schema.Properties)
+		switch {
+		case schema.AdditionalProperties == false:
+			problem := fmt.Sprintf("%s.%s is not a param of the schema", key, name)
+			if closest != "" {
+				problem += fmt.Sprintf("; did you mean %s.%s?", key, closest)
+			}
+			*problems = append(*problems, problem)
+		case closest != "":
+			warnAt(sourcePath, sourceLine(sourcePath, name+":"), "%s.%s is not in the schema; did you mean %s.%s?", key, name, key, closest)
+		}
+	}
+}
+
+// writeParamDocs writes a Markdown table row for the param at key, then
+// those of its entries and of the entries of its items.
+func writeParamDocs(b *strings.Builder, key string, schema *paramSchema, required bool) {
+	defaultValue := ""
+	if schema.Default != nil {
+		defaultValue = fmt.Sprintf("`%v`", schema.Default)
+	}
+	requiredText := ""
+	if required {
+		requiredText = "yes"
+	}
+	description := schema.Description
+	if schema.Title != "" {
+		description = strings.TrimSpace(schema.Title + ". " + description)
+	}
+	if len(schema.Enum) > 0 {
+		options := make([]string, len(schema.Enum))
+		for i, option := range schema.Enum {
+			options[i] = fmt.Sprintf("`%v`", option)
+		}
+		description = strings.TrimSpace(description + " One of " + strings.Join(options, ", ") + ".")
+	}
+	if schema.Deprecated {
+		description = strings.TrimSpace("Deprecated. " + description)
+	}
+	fmt.Fprintf(b, "| `%s` | %s | %s | %s | %s |\n", key, strings.Join(schema.Type, " or "), requiredText, defaultValue, strings.ReplaceAll(description, "|", "\\|"))
+
+	writePropertyDocs(b, key+".", schema)
+	if schema.Items != nil {
+		writePropertyDocs(b, key+"[].", schema.Items)
+	}
+}
+
+// writePropertyDocs writes the rows of the entries of an object, named
+// after prefix, as in `links[].url`.
+func writePropertyDocs(b *strings.Builder, prefix string, schema *paramSchema) {
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		required := false
+		for _, requiredName := range schema.Required {
+			required = required || requiredName == name
+		}
+		writeParamDocs(b, prefix+name, schema.Properties[name], required)
+	}
+}
+
+// paramsCommand runs `grafe params`, which prints a Markdown reference of
+// the params the pages of each section take, from paramSchemas, for theme
+// and content authors.
+func paramsCommand(project projectConfig, args []string) {
+	flags := flag.NewFlagSet("grafe params", flag.ExitOnError)
+	parseCommandFlagsOnly(flags, args)
+
+	_, settings := readSiteConfig(project)
+	schemas, err := readParamSchemas(settings.ParamSchemas)
+	check(err)
+	if len(schemas) == 0 {
+		log.Fatal("config.md sets no paramSchemas.")
+	}
+
+	sections := make([]string, 0, len(schemas))
+	for section := range schemas {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+
+	var b strings.Builder
+	for i, section := range sections {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		if section == "*" {
+			b.WriteString("## Every other section\n\n")
+		} else {
+			fmt.Fprintf(&b, "## %s\n\n", section)
+		}
+		schema := schemas[section]
+		if schema.Description != "" {
+			b.WriteString(schema.Description + "\n\n")
+		}
+		b.WriteString("| Param | Type | Required | Default | Description |\n| --- | --- | --- | --- | --- |\n")
+		writePropertyDocs(&b, "", schema)
+	}
+	fmt.Print(b.String())
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	placeholderWidth   = 16
+	blurHashComponents = 4
+	base83Characters   = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+)
+
+// imagePlaceholder stands in for an image while it loads: a tiny blurred
+// JPEG as a data URI, a BlurHash string, and the image's average colour.
+type imagePlaceholder struct {
+	DataURI  string
+	BlurHash string
+	Color    string
+}
+
+// placeholders caches placeholders by the hash of the image's content, so
+// an image used on many pages, or copied under several names, is only
+// processed once.
+var placeholders sync.Map
+
+func sRGBToLinear(value uint32) float64 {
+	v := float64(value) / 0xffff
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value float64, exponent float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exponent), value)
+}
+
+func encodeBase83(value int, length int) string {
+	var encoded strings.Builder
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		encoded.WriteByte(base83Characters[digit])
+	}
+	return encoded.String()
+}
+
+// blurHash encodes img as a BlurHash (https://blurha.sh) with
+// blurHashComponents components in each direction.
+func blurHash(img image.Image) string {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	factors := make([][3]float64, 0, blurHashComponents*blurHashComponents)
+	for j := 0; j < blurHashComponents; j++ {
+		for i := 0; i < blurHashComponents; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var factor [3]float64
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := normalisation * math.Cos(math.Pi*float64(i*x)/float64(width)) * math.Cos(math.Pi*float64(j*y)/float64(height))
+					r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+					factor[0] += basis * sRGBToLinear(r)
+					factor[1] += basis * sRGBToLinear(g)
+					factor[2] += basis * sRGBToLinear(b)
+				}
+			}
+			for c := range factor {
+				factor[c] /= float64(width * height)
+			}
+			factors = append(factors, factor)
+		}
+	}
+
+	hash := encodeBase83((blurHashComponents-1)+(blurHashComponents-1)*9, 1)
+
+	maximum := 0.0
+	for _, factor := range factors[1:] {
+		for _, component := range factor {
+			maximum = math.Max(maximum, math.Abs(component))
+		}
+	}
+	quantisedMaximum := int(math.Max(0, math.Min(82, math.Floor(maximum*166-0.5))))
+	maximumValue := float64(quantisedMaximum+1) / 166
+	hash += encodeBase83(quantisedMaximum, 1)
+
+	dc := factors[0]
+	hash += encodeBase83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4)
+
+	for _, factor := range factors[1:] {
+		var quantised [3]int
+		for c, component := range factor {
+			quantised[c] = int(math.Max(0, math.Min(18, math.Floor(signPow(component/maximumValue, 0.5)*9+9.5))))
+		}
+		hash += encodeBase83(quantised[0]*19*19+quantised[1]*19+quantised[2], 2)
+	}
+	return hash
+}
+
+func averageColor(img image.Image) string {
+	bounds := img.Bounds()
+	var sum [3]uint64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			sum[0] += uint64(r >> 8)
+			sum[1] += uint64(g >> 8)
+			sum[2] += uint64(b >> 8)
+		}
+	}
+	count := uint64(bounds.Dx() * bounds.Dy())
+	return fmt.Sprintf("#%02x%02x%02x", sum[0]/count, sum[1]/count, sum[2]/count)
+}
+
+// generatePlaceholder returns the placeholder of the image at filePath.
+func generatePlaceholder(filePath string) (imagePlaceholder, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return imagePlaceholder{}, err
+	}
+	hash := sha256.Sum256(data)
+	if cached, ok := placeholders.Load(hash); ok {
+		return cached.(imagePlaceholder), nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return imagePlaceholder{}, fmt.Errorf("%s: %w", filePath, err)
+	}
+	bounds := img.Bounds()
+	height := max(1, bounds.Dy()*placeholderWidth/max(1, bounds.Dx()))
+	small := image.NewRGBA(image.Rect(0, 0, placeholderWidth, height))
+	draw.ApproxBiLinear.Scale(small, small.Bounds(), img, bounds, draw.Over, nil)
+
+	var encoded bytes.Buffer
+	err = jpeg.Encode(&encoded, small, &jpeg.Options{Quality: 60})
+	if err != nil {
+		return imagePlaceholder{}, err
+	}
+
+	placeholder := imagePlaceholder{
+		DataURI:  "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(encoded.Bytes()),
+		BlurHash: blurHash(small),
+		Color:    averageColor(small),
+	}
+	placeholders.Store(hash, placeholder)
+	return placeholder, nil
+}
+
+// placeholderFunc is the `imagePlaceholder` template function. It resolves
+// url like the picture shortcode does, relative to the content file at
+// sourcePath when one is given: `imagePlaceholder (.Arg "src") .SourcePath`.
+func placeholderFunc(url string, sourcePath ...string) (imagePlaceholder, error) {
+	from := contentDirectory + "/index.md"
+	if len(sourcePath) > 0 {
+		from = sourcePath[0]
+	}
+	filePath, ok := resolveAssetPath(url, from)
+	if !ok {
+		return imagePlaceholder{}, fmt.Errorf("image %q not found", url)
+	}
+	return generatePlaceholder(filePath)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// changedPages returns the pages affected by the changes to the content
+// since the git ref, including uncommitted and untracked files: the page
+// of each changed file or of the bundle it is in, and the list pages of
+// the directories above it.
+func changedPages(ref string, pages []*Page) (map[*Page]bool, error) {
+	changed, err := git(contentDirectory, "diff", "--name-only", "--relative", ref, "--", ".")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := git(contentDirectory, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+
+	bySource := make(map[string]*Page, len(pages))
+	for _, page := range pages {
+		bySource[strings.TrimPrefix(page.SourcePath, contentDirectory+"/")] = page
+	}
+
+	affected := make(map[*Page]bool)
+	for _, file := range strings.Split(changed+"\n"+untracked, "\n") {
+		if file == "" {
+			continue
+		}
+		if page, ok := bySource[file]; ok {
+			affected[page] = true
+		}
+		directory := path.Dir(file)
+		if page, ok := bySource[path.Join(directory, "index.md")]; ok {
+			affected[page] = true
+		}
+		for {
+			if page, ok := bySource[path.Join(directory, "_index.md")]; ok {
+				affected[page] = true
+			}
+			if directory == "." {
+				break
+			}
+			directory = path.Dir(directory)
+		}
+	}
+	return affected, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const projectConfigFile = "grafe.yaml"
+
+// The directories grafē reads a site from and writes it to, relative to
+// the directory it runs in. grafe.yaml changes them.
+var (
+	contentDirectory = "content"
+	staticDirectory  = "static"
+	themeDirectory   = "theme"
+	outputDirectory  = "public"
+)
+
+// projectConfig is grafe.yaml: where the site's directories are, the port
+// of the development server, and the baseURL and params, which take
+// precedence over the ones in config.md.
+type projectConfig struct {
+	ContentDir string                 `yaml:"contentDir"`
+	StaticDir  string                 `yaml:"staticDir"`
+	ThemeDir   string                 `yaml:"themeDir"`
+	OutputDir  string                 `yaml:"outputDir"`
+	BaseURL    string                 `yaml:"baseURL"`
+	Port       int                    `yaml:"port"`
+	Params     map[string]interface{} `yaml:"params"`
+}
+
+func projectDirectory(directory string, fallback string) string {
+	if directory == "" {
+		return fallback
+	}
+	return strings.TrimSuffix(filepath.ToSlash(filepath.Clean(directory)), "/")
+}
+
+// loadProjectConfig reads grafe.yaml, if there is one, and points grafē at
+// the directories it names.
+func loadProjectConfig() projectConfig {
+	project := projectConfig{Port: 8081}
+
+	data, err := os.ReadFile(projectConfigFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return project
+	}
+	check(err)
+	err = yaml.UnmarshalStrict(data, &project)
+	if err != nil {
+		log.Fatalf("%s: %v\n", projectConfigFile, err)
+	}
+
+	contentDirectory = projectDirectory(project.ContentDir, contentDirectory)
+	staticDirectory = projectDirectory(project.StaticDir, staticDirectory)
+	themeDirectory = projectDirectory(project.ThemeDir, themeDirectory)
+	outputDirectory = projectDirectory(project.OutputDir, outputDirectory)
+	if err := checkOutputDirectory(outputDirectory); err != nil {
+		log.Fatalf("%s: outputDir %v\n", projectConfigFile, err)
+	}
+	project.Params = normalizeFrontMatterMap(project.Params)
+	return project
+}
+
+// checkOutputDirectory makes sure that directory, which builds remove and
+// write the site to, is within the project, is not the project itself, and
+// neither is nor holds a directory the site is read from.
+func checkOutputDirectory(directory string) error {
+	root, err := filepath.Abs(".")
+	if err != nil {
+		return err
+	}
+	output, err := filepath.Abs(directory)
+	if err != nil {
+		return err
+	}
+	relative, err := filepath.Rel(root, output)
+	if err != nil || relative == "." || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%q must be a directory within the project", directory)
+	}
+	for _, source := range []string{contentDirectory, staticDirectory, themeDirectory, "templates", "data", "snippets"} {
+		source, err := filepath.Abs(source)
+		if err != nil {
+			return err
+		}
+		if source == output || strings.HasPrefix(source, output+string(filepath.Separator)) {
+			return fmt.Errorf("%q holds %s, which building the site would remove", directory, filepath.ToSlash(strings.TrimPrefix(source, root+string(filepath.Separator))))
+		}
+	}
+	return nil
+}
+
+// apply sets the baseURL and params of grafe.yaml in the site's config.
+func (project projectConfig) apply(config map[string]interface{}) {
+	for key, value := range project.Params {
+		config[key] = value
+	}
+	if project.BaseURL != "" {
+		config["baseURL"] = project.BaseURL
+	}
+}
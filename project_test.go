@@ -0,0 +1,43 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckOutputDirectory(t *testing.T) {
+	root := t.TempDir()
+	chdir(t, root)
+	previous := contentDirectory
+	contentDirectory = "site/content"
+	t.Cleanup(func() { contentDirectory = previous })
+
+	tests := []struct {
+		directory string
+		wantErr   string
+	}{
+		{directory: "public"},
+		{directory: "build/public"},
+		{directory: filepath.Join(root, "public")},
+		{directory: ".", wantErr: "must be a directory within the project"},
+		{directory: "./", wantErr: "must be a directory within the project"},
+		{directory: "..", wantErr: "must be a directory within the project"},
+		{directory: "../public", wantErr: "must be a directory within the project"},
+		{directory: filepath.Dir(root), wantErr: "must be a directory within the project"},
+		{directory: "site", wantErr: "holds site/content"},
+		{directory: "site/content", wantErr: "holds site/content"},
+		{directory: "static", wantErr: "holds static"},
+		{directory: "templates/", wantErr: "holds templates"},
+	}
+
+	for _, test := range tests {
+		err := checkOutputDirectory(test.directory)
+		switch {
+		case test.wantErr == "" && err != nil:
+			t.Errorf("checkOutputDirectory(%q) = %v, want no error", test.directory, err)
+		case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+			t.Errorf("checkOutputDirectory(%q) = %v, want an error saying %q", test.directory, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+type queryCondition struct {
+	Key      string      `yaml:"key"`
+	Operator string      `yaml:"op"`
+	Value    interface{} `yaml:"value"`
+}
+
+// queryConfig selects pages from the content model: the pages to start
+// from, conditions they must all match, their order ("Date desc"), how
+// many to keep, and the fields to project each page onto.
+type queryConfig struct {
+	From   string           `yaml:"from"`
+	Where  []queryCondition `yaml:"where"`
+	Sort   string           `yaml:"sort"`
+	Limit  int              `yaml:"limit"`
+	Fields []string         `yaml:"fields"`
+}
+
+type queryOutputConfig struct {
+	Output      string `yaml:"output"`
+	Template    string `yaml:"template"`
+	queryConfig `yaml:",inline"`
+}
+
+// queryOutputData is what query output templates are executed with.
+type queryOutputData struct {
+	Site    *Site
+	Results []interface{}
+	URL     string
+}
+
+var defaultQueryFields = []string{"Title", "RelPermalink", "Date", "Section", "Summary"}
+
+func runQuery(site *Site, query queryConfig) ([]interface{}, error) {
+	var pages []*Page
+	switch query.From {
+	case "", "pages":
+		pages = site.Pages
+	case "listPages":
+		pages = site.ListPages
+	case "all":
+		pages = append(append(pages, site.Pages...), site.ListPages...)
+	default:
+		return nil, fmt.Errorf("query: unknown page collection %q", query.From)
+	}
+
+	var collection interface{} = pages
+	for _, condition := range query.Where {
+		operator := condition.Operator
+		if operator == "" {
+			operator = "="
+		}
+		var err error
+		collection, err = where(collection, condition.Key, operator, condition.Value)
+		if err != nil {
+			return nil, fmt.Errorf("query: %w", err)
+		}
+	}
+	if query.Sort != "" {
+		var err error
+		collection, err = sortCollection(collection, strings.Fields(query.Sort)...)
+		if err != nil {
+			return nil, fmt.Errorf("query: %w", err)
+		}
+	}
+
+	pages = collection.([]*Page)
+	if query.Limit > 0 && query.Limit < len(pages) {
+		pages = pages[:query.Limit]
+	}
+
+	results := make([]interface{}, len(pages))
+	for i, page := range pages {
+		if query.Fields == nil {
+			results[i] = page
+			continue
+		}
+		fields := make(map[string]interface{}, len(query.Fields))
+		for _, field := range query.Fields {
+			fields[field], _ = fieldValue(page, field)
+		}
+		results[i] = fields
+	}
+	return results, nil
+}
+
+// querySite runs a query given as a dict in a template:
+//
+//	query .Site (dict "where" (list (dict "key" "Body" "op" "contains" "value" "go")) "sort" "Date desc")
+func querySite(site *Site, spec map[string]interface{}) ([]interface{}, error) {
+	var query queryConfig
+	data, err := yaml.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(data, &query); err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	return runQuery(site, query)
+}
+
+// writeQueryOutputs writes the result of every query in the `queries`
+// setting, through an output template when the query names one and as JSON
+// otherwise.
+func (b *builder) writeQueryOutputs(site *Site) {
+	for _, query := range b.settings.Queries {
+		if query.Output == "" {
+			check(fmt.Errorf("query: no output path given"))
+		}
+		outputPath := path.Clean("/" + query.Output)[1:]
+
+		if query.Template == "" && query.Fields == nil {
+			query.Fields = defaultQueryFields
+		}
+		results, err := runQuery(site, query.queryConfig)
+		check(err)
+
+		var data []byte
+		if query.Template == "" {
+			data, err = json.Marshal(results)
+			check(err)
+		} else {
+			outputTemplate, ok := b.outputTemplates[removeExtension(query.Template)]
+			if !ok {
+				check(fmt.Errorf("no output template named %q exists", query.Template))
+			}
+			outputTemplate, err := outputTemplate.Clone()
+			check(err)
+			outputTemplate.Funcs(siteOutputFuncMap(site))
+
+			var buf bytes.Buffer
+			err = outputTemplate.Execute(&buf, queryOutputData{
+				Site:    site,
+				Results: results,
+				URL:     b.settings.siteURL(outputPath),
+			})
+			check(err)
+			data = buf.Bytes()
+		}
+		b.writeOutput(outputDirectory+"/"+outputPath, data)
+	}
+}
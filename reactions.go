@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+const (
+	webmentionCountURL = "https://webmention.io/api/count.json"
+	githubGraphQLURL   = "https://api.github.com/graphql"
+)
+
+// reactionsConfig chooses where the build fetches the reactions to each
+// page from: the webmention.io counts of its permalink, and the reactions
+// and comments of the discussion in the Discussions repository, given as
+// `owner/name`, whose number is the page's `discussion` front matter.
+type reactionsConfig struct {
+	Webmentions bool   `yaml:"webmentions"`
+	Discussions string `yaml:"discussions"`
+}
+
+// Reactions counts the reactions to a page by kind, such as `like`,
+// `repost`, `thumbs_up`, or `comments`, and in total.
+type Reactions struct {
+	Total  int
+	Counts map[string]int
+}
+
+func (reactions *Reactions) add(kind string, count int) {
+	if count == 0 {
+		return
+	}
+	reactions.Counts[kind] += count
+	reactions.Total += count
+}
+
+// fetchReactions sets the reactions of every page from the configured
+// sources. Pages whose reactions cannot be fetched keep none, and the build
+// warns once about all of them.
+func (b *builder) fetchReactions(pages []*Page) {
+	config := b.settings.Reactions
+	if !config.Webmentions && config.Discussions == "" {
+		return
+	}
+	if config.Webmentions && b.settings.BaseURL == "" {
+		warnf("reactions.webmentions needs a baseURL to look the pages up by")
+		config.Webmentions = false
+	}
+	owner, name, _ := strings.Cut(config.Discussions, "/")
+	if config.Discussions != "" && (owner == "" || name == "") {
+		warnf("reactions.discussions should be a repository as owner/name, not %q", config.Discussions)
+		config.Discussions = ""
+	}
+	token := os.Getenv("GITHUB_TOKEN")
+	if config.Discussions != "" && token == "" {
+		warnf("fetching reactions from GitHub Discussions needs a GITHUB_TOKEN")
+		config.Discussions = ""
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	var mutex sync.Mutex
+	var failures []string
+	var wait sync.WaitGroup
+	limit := make(chan struct{}, 8)
+	for _, page := range pages {
+		discussion := frontMatterValue(page.metaData, "discussion")
+		if !config.Webmentions && (config.Discussions == "" || discussion == nil) {
+			continue
+		}
+		wait.Add(1)
+		go func(page *Page) {
+			defer wait.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+
+			reactions := &Reactions{Counts: make(map[string]int)}
+			var err error
+			if config.Webmentions {
+				err = fetchWebmentionCounts(client, page.Permalink, reactions)
+			}
+			if err == nil && config.Discussions != "" && discussion != nil {
+				err = fetchDiscussionReactions(client, token, owner, name, cast.ToInt(discussion), reactions)
+			}
+			if err != nil {
+				mutex.Lock()
+				failures = append(failures, fmt.Sprintf("%s: %v", page.SourcePath, err))
+				mutex.Unlock()
+				return
+			}
+			page.Reactions = reactions
+		}(page)
+	}
+	wait.Wait()
+
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		warnf("could not fetch the reactions to %d pages, such as %s", len(failures), failures[0])
+	}
+}
+
+func fetchWebmentionCounts(client *http.Client, target string, reactions *Reactions) error {
+	response, err := client.Get(webmentionCountURL + "?target=" + url.QueryEscape(target))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("webmention.io: %s", response.Status)
+	}
+
+	var counts struct {
+		Type map[string]int `json:"type"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&counts); err != nil {
+		return fmt.Errorf("webmention.io: %w", err)
+	}
+	for kind, count := range counts.Type {
+		reactions.add(kind, count)
+	}
+	return nil
+}
+
+const discussionReactionsQuery = `query($owner: String!, $name: String!, $number: Int!) {
+  repository(owner: $owner, name: $name) {
+    discussion(number: $number) {
+      comments { totalCount }
+      reactionGroups { content reactors { totalCount } }
+    }
+  }
+}`
+
+func fetchDiscussionReactions(client *http.Client, token string, owner string, name string, number int, reactions *Reactions) error {
+	query, err := json.Marshal(map[string]interface{}{
+		"query":     discussionReactionsQuery,
+		"variables": map[string]interface{}{"owner": owner, "name": name, "number": number},
+	})
+	check(err)
+	request, err := http.NewRequest(http.MethodPost, githubGraphQLURL, bytes.NewReader(query))
+	check(err)
+	request.Header.Set("Authorization", "bearer "+token)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GitHub: %s", response.Status)
+	}
+
+	var result struct {
+		Data struct {
+			Repository struct {
+				Discussion *struct {
+					Comments struct {
+						TotalCount int `json:"totalCount"`
+					} `json:"comments"`
+					ReactionGroups []struct {
+						Content  string `json:"content"`
+						Reactors struct {
+							TotalCount int `json:"totalCount"`
+						} `json:"reactors"`
+					} `json:"reactionGroups"`
+				} `json:"discussion"`
+			} `json:"repository"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return fmt.Errorf("GitHub: %w", err)
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("GitHub: %s", result.Errors[0].Message)
+	}
+	discussion := result.Data.Repository.Discussion
+	if discussion == nil {
+		return fmt.Errorf("discussion %d does not exist in %s/%s", number, owner, name)
+	}
+	for _, group := range discussion.ReactionGroups {
+		reactions.add(strings.ToLower(group.Content), group.Reactors.TotalCount)
+	}
+	reactions.add("comments", discussion.Comments.TotalCount)
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	defaultReleasesDirectory = "releases"
+	releasesManifest         = "releases.json"
+	currentRelease           = "current"
+)
+
+// releasesConfig keeps a copy of every build made with `-release` in a
+// directory of Directory named by its date, and a `current` symlink to the
+// one being served, so that a deploy can be rolled back by pointing the
+// link at an older one. Keep limits how many are kept; 0 keeps them all.
+type releasesConfig struct {
+	Directory string `yaml:"directory"`
+	Keep      int    `yaml:"keep"`
+}
+
+func (config releasesConfig) directory() string {
+	if config.Directory == "" {
+		return defaultReleasesDirectory
+	}
+	return config.Directory
+}
+
+type release struct {
+	Name     string    `json:"name"`
+	Date     time.Time `json:"date"`
+	Revision string    `json:"revision,omitempty"`
+}
+
+// releaseManifest lists the releases, oldest first, and which is current,
+// for hosts that cannot follow the symlink.
+type releaseManifest struct {
+	Current  string    `json:"current"`
+	Releases []release `json:"releases"`
+}
+
+func readReleaseManifest(directory string) releaseManifest {
+	var manifest releaseManifest
+	data, err := os.ReadFile(directory + "/" + releasesManifest)
+	if errors.Is(err, fs.ErrNotExist) {
+		return manifest
+	}
+	check(err)
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		log.Fatalf("%s/%s: %v\n", directory, releasesManifest, err)
+	}
+	return manifest
+}
+
+func (manifest releaseManifest) find(name string) int {
+	for i, release := range manifest.Releases {
+		if release.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// setCurrent points the current symlink at the release name, replacing it
+// in one step so the release being served is never missing, and saves the
+// manifest.
+func (manifest *releaseManifest) setCurrent(directory string, name string) {
+	manifest.Current = name
+	link := directory + "/" + currentRelease
+	check(os.RemoveAll(link + ".new"))
+	check(os.Symlink(name, link+".new"))
+	check(os.Rename(link+".new", link))
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	check(err)
+	check(os.WriteFile(directory+"/"+releasesManifest, append(data, '\n'), 0666))
+}
+
+// publishRelease copies the built site into a new release named by today's
+// date, with a number after it for later releases of the same day, makes
+// it current, and removes the oldest releases beyond the number kept.
+func publishRelease(config releasesConfig, now time.Time) {
+	directory := config.directory()
+	manifest := readReleaseManifest(directory)
+
+	name := now.Format("2006-01-02")
+	for i := 2; manifest.find(name) >= 0 || fileExists(directory+"/"+name); i++ {
+		name = fmt.Sprintf("%s-%d", now.Format("2006-01-02"), i)
+	}
+	check(os.MkdirAll(directory+"/"+name, 0770))
+	copyTree(outputDirectory, directory+"/"+name)
+
+	revision, _ := git(".", "rev-parse", "--short", "HEAD")
+	manifest.Releases = append(manifest.Releases, release{Name: name, Date: now, Revision: revision})
+	for config.Keep > 0 && len(manifest.Releases) > config.Keep {
+		check(os.RemoveAll(directory + "/" + manifest.Releases[0].Name))
+		manifest.Releases = manifest.Releases[1:]
+	}
+	manifest.setCurrent(directory, name)
+	fmt.Printf("Released the site as %s/%s\n", directory, name)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// rollbackCommand runs `grafe rollback`, which makes the release before the
+// current one, or the one named, current again.
+func rollbackCommand(project projectConfig, args []string) {
+	flags := flag.NewFlagSet("grafe rollback", flag.ExitOnError)
+	listPtr := flags.Bool("list", false, "List the releases instead, marking the current one.")
+	positional := parseCommandFlags(flags, args)
+
+	_, settings := readSiteConfig(project)
+	directory := settings.Releases.directory()
+	manifest := readReleaseManifest(directory)
+	if len(manifest.Releases) == 0 {
+		log.Fatalf("There are no releases in %s; build with -release to make one.\n", directory)
+	}
+
+	if *listPtr {
+		for _, release := range manifest.Releases {
+			marker := " "
+			if release.Name == manifest.Current {
+				marker = "*"
+			}
+			fmt.Printf("%s %-16s %s %s\n", marker, release.Name, release.Date.Format(time.RFC3339), release.Revision)
+		}
+		return
+	}
+
+	var target int
+	if len(positional) > 0 {
+		target = manifest.find(positional[0])
+		if target < 0 {
+			log.Fatalf("There is no release %q in %s.\n", positional[0], directory)
+		}
+	} else {
+		target = manifest.find(manifest.Current) - 1
+		if target < 0 {
+			log.Fatalf("%s is the oldest release; there is none to roll back to.\n", manifest.Current)
+		}
+	}
+	manifest.setCurrent(directory, manifest.Releases[target].Name)
+	fmt.Printf("%s/%s now points to %s\n", directory, currentRelease, manifest.Current)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack hands the connection over to the reload socket.
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *statusRecorder) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.bytes += n
+	return n, err
+}
+
+type notFoundEntry struct {
+	path     string
+	count    int
+	referers map[string]bool
+}
+
+// notFoundReport collects the paths that answered 404 during a server
+// session, with the pages that linked to them.
+type notFoundReport struct {
+	mu      sync.Mutex
+	entries map[string]*notFoundEntry
+}
+
+func newNotFoundReport() *notFoundReport {
+	return &notFoundReport{entries: make(map[string]*notFoundEntry)}
+}
+
+func (report *notFoundReport) record(r *http.Request) {
+	report.mu.Lock()
+	defer report.mu.Unlock()
+
+	entry, ok := report.entries[r.URL.Path]
+	if !ok {
+		entry = &notFoundEntry{path: r.URL.Path, referers: make(map[string]bool)}
+		report.entries[r.URL.Path] = entry
+	}
+	entry.count++
+	if referer := r.Referer(); referer != "" {
+		entry.referers[referer] = true
+	}
+}
+
+func (report *notFoundReport) write(w io.Writer) {
+	report.mu.Lock()
+	defer report.mu.Unlock()
+
+	if len(report.entries) == 0 {
+		return
+	}
+
+	entries := make([]*notFoundEntry, 0, len(report.entries))
+	for _, entry := range report.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].count != entries[j].count {
+			return entries[i].count > entries[j].count
+		}
+		return entries[i].path < entries[j].path
+	})
+
+	fmt.Fprintf(w, "\n%d paths were not found:\n", len(entries))
+	for _, entry := range entries {
+		fmt.Fprintf(w, "  %4d  %s\n", entry.count, entry.path)
+		referers := make([]string, 0, len(entry.referers))
+		for referer := range entry.referers {
+			referers = append(referers, referer)
+		}
+		sort.Strings(referers)
+		if len(referers) > 0 {
+			fmt.Fprintf(w, "        linked from %s\n", strings.Join(referers, ", "))
+		}
+	}
+}
+
+// recordRequests logs each request when logRequests is set and records
+// every 404 in report.
+func recordRequests(logRequests bool, report *notFoundReport, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		if recorder.status == http.StatusNotFound {
+			report.record(r)
+		}
+		if logRequests {
+			log.Printf("%s %s %d %dB %s\n", r.Method, r.URL.RequestURI(), recorder.status, recorder.bytes, time.Since(start).Round(time.Microsecond))
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+// stalePage is a page whose `reviewBy` date has passed.
+type stalePage struct {
+	sourcePath string
+	title      string
+	owner      string
+	reviewBy   time.Time
+}
+
+// stalePages returns the pages other than archived ones that were due for
+// review before now, ordered by owner and then by how long they have been
+// due.
+func (b *builder) stalePages(now time.Time) []stalePage {
+	var stale []stalePage
+	b.eachFrontMatter(func(fileName string, metaData map[string]interface{}) {
+		if pageStatus(metaData, fileName) == "archived" {
+			return
+		}
+		reviewBy, err := parseFrontMatterDate(frontMatterValue(metaData, "reviewBy"), b.settings.location)
+		if err != nil {
+			failAt(fileName, sourceLine(fileName, "reviewBy:"), "reviewBy: %v", err)
+		}
+		if reviewBy.IsZero() || !reviewBy.Before(now) {
+			return
+		}
+		stale = append(stale, stalePage{
+			sourcePath: fileName,
+			title:      frontMatterString(metaData, "title"),
+			owner:      frontMatterString(metaData, "owner"),
+			reviewBy:   reviewBy,
+		})
+	})
+
+	sort.SliceStable(stale, func(i, j int) bool {
+		if stale[i].owner != stale[j].owner {
+			return stale[i].owner < stale[j].owner
+		}
+		return stale[i].reviewBy.Before(stale[j].reviewBy)
+	})
+	return stale
+}
+
+// checkCommand reports on the state of the content. `-stale` lists the
+// pages past their review date grouped by owner, and fails if there are
+// any, so that it can run in CI.
+func checkCommand(project projectConfig, args []string) {
+	flags := flag.NewFlagSet("grafe check", flag.ExitOnError)
+	stalePtr := flags.Bool("stale", false, "List the pages past their `reviewBy` date, grouped by owner.")
+	parseCommandFlagsOnly(flags, args)
+
+	if !*stalePtr {
+		log.Fatal("usage: grafe check -stale")
+	}
+
+	_, settings := readSiteConfig(project)
+	b := &builder{settings: settings}
+	stale := b.stalePages(settings.now())
+	checkErrors(false)
+	if len(stale) == 0 {
+		fmt.Println("No pages are past their review date.")
+		return
+	}
+
+	owner := ""
+	for i, page := range stale {
+		if i == 0 || page.owner != owner {
+			owner = page.owner
+			if owner == "" {
+				fmt.Println("(no owner)")
+			} else {
+				fmt.Println(owner)
+			}
+		}
+		fmt.Printf("  %s  %s  %s\n", page.reviewBy.Format("2006-01-02"), page.sourcePath, page.title)
+	}
+	fmt.Fprintf(os.Stderr, "%d pages are past their review date.\n", len(stale))
+	os.Exit(1)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Client talks to an S3-compatible bucket with path-style requests signed
+// with AWS Signature Version 4. Credentials come from the usual
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN, and
+// AWS_REGION variables; S3_ENDPOINT points it at another provider.
+type s3Client struct {
+	endpoint     *url.URL
+	bucket       string
+	prefix       string
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+}
+
+// newS3Client returns a client for a `s3://bucket/prefix` location.
+func newS3Client(location string) (*s3Client, error) {
+	target, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	if target.Scheme != "s3" || target.Host == "" {
+		return nil, fmt.Errorf("%s is not an s3://bucket/prefix location", location)
+	}
+
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := os.Getenv("S3_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	s3 := &s3Client{
+		endpoint:     endpointURL,
+		bucket:       target.Host,
+		prefix:       strings.Trim(target.Path, "/"),
+		region:       region,
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		client:       &http.Client{Timeout: 5 * time.Minute},
+	}
+	if s3.accessKey == "" || s3.secretKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set to upload to %s", location)
+	}
+	return s3, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// s3Escape encodes a path the way Signature Version 4 expects, leaving
+// slashes alone.
+func s3Escape(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(url.PathEscape(segment), "+", "%2B")
+	}
+	return strings.Join(segments, "/")
+}
+
+// key returns the object key of name under the client's prefix.
+func (s3 *s3Client) key(name string) string {
+	if s3.prefix == "" {
+		return name
+	}
+	return s3.prefix + "/" + name
+}
+
+// sign adds the Signature Version 4 headers for payloadHash and now to
+// request, whose URL must already be escaped.
+func (s3 *s3Client) sign(request *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s3.sessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", s3.sessionToken)
+	}
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(request.Header.Get(name))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{request.Method, request.URL.EscapedPath(), request.URL.RawQuery, canonicalHeaders.String(), signedHeaders, payloadHash}, "\n")
+	scope := day + "/" + s3.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256(hmacSHA256(hmacSHA256(hmacSHA256([]byte("AWS4"+s3.secretKey), day), s3.region), "s3"), "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s3.accessKey, scope, signedHeaders, signature))
+}
+
+// request sends a signed request for the object key, or for the bucket
+// itself when key is empty.
+func (s3 *s3Client) request(method string, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	path := "/" + s3.bucket
+	if key != "" {
+		path += "/" + key
+	}
+	escapedPath := strings.TrimSuffix(s3.endpoint.Path, "/") + s3Escape(path)
+
+	request, err := http.NewRequest(method, s3.endpoint.Scheme+"://"+s3.endpoint.Host+escapedPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.URL.RawPath = escapedPath
+	request.URL.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	s3.sign(request, sha256Hex(body), time.Now().UTC())
+
+	response, err := s3.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= 300 {
+		defer response.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, response.Status, bytes.TrimSpace(message))
+	}
+	return response, nil
+}
+
+// PutObject uploads data as the object name under the client's prefix.
+func (s3 *s3Client) PutObject(name string, data []byte, header http.Header) error {
+	response, err := s3.request(http.MethodPut, s3.key(name), nil, data, header)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		ETag string `xml:"ETag"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// ListObjects returns the ETag of every object under the client's prefix,
+// keyed by its name relative to the prefix.
+func (s3 *s3Client) ListObjects() (map[string]string, error) {
+	objects := make(map[string]string)
+	prefix := ""
+	if s3.prefix != "" {
+		prefix = s3.prefix + "/"
+	}
+
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		response, err := s3.request(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(response.Body).Decode(&result)
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			objects[strings.TrimPrefix(object.Key, prefix)] = strings.Trim(object.ETag, `"`)
+		}
+		if !result.IsTruncated {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// DeleteObject removes the object name under the client's prefix.
+func (s3 *s3Client) DeleteObject(name string) error {
+	response, err := s3.request(http.MethodDelete, s3.key(name), nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
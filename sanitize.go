@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+
+	nethtml "golang.org/x/net/html"
+)
+
+const (
+	sanitizeUnsafe    = "unsafe"
+	sanitizeAllowlist = "allowlist"
+	sanitizeEscape    = "escape"
+)
+
+var defaultAllowedTags = []string{
+	"a", "abbr", "b", "blockquote", "br", "caption", "cite", "code", "col", "colgroup",
+	"dd", "del", "details", "dfn", "div", "dl", "dt", "em", "figcaption", "figure",
+	"h1", "h2", "h3", "h4", "h5", "h6", "hr", "i", "img", "ins", "kbd", "li", "mark",
+	"ol", "p", "pre", "q", "s", "samp", "small", "span", "strong", "sub", "summary",
+	"sup", "table", "tbody", "td", "tfoot", "th", "thead", "time", "tr", "u", "ul", "var",
+}
+
+var defaultAllowedAttributes = []string{
+	"alt", "cite", "class", "colspan", "datetime", "height", "href", "id", "lang",
+	"open", "rowspan", "src", "title", "width",
+}
+
+// Elements whose contents are dropped along with the element itself when
+// they are not allowlisted.
+var sanitizeDropContent = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"iframe":   true,
+	"object":   true,
+	"noscript": true,
+	"template": true,
+}
+
+type htmlSanitizer struct {
+	mode              string
+	allowedTags       map[string]bool
+	allowedAttributes map[string]bool
+}
+
+func newHTMLSanitizer(mode string, allowedTags []string, allowedAttributes []string) *htmlSanitizer {
+	if mode == "" {
+		mode = sanitizeUnsafe
+	}
+	if mode != sanitizeUnsafe && mode != sanitizeAllowlist && mode != sanitizeEscape {
+		log.Fatalf("Unknown sanitize mode %q; expected %q, %q, or %q.\n", mode, sanitizeUnsafe, sanitizeAllowlist, sanitizeEscape)
+	}
+	if len(allowedTags) == 0 {
+		allowedTags = defaultAllowedTags
+	}
+	if len(allowedAttributes) == 0 {
+		allowedAttributes = defaultAllowedAttributes
+	}
+
+	sanitizer := &htmlSanitizer{
+		mode:              mode,
+		allowedTags:       make(map[string]bool),
+		allowedAttributes: make(map[string]bool),
+	}
+	for _, tag := range allowedTags {
+		sanitizer.allowedTags[strings.ToLower(tag)] = true
+	}
+	for _, attribute := range allowedAttributes {
+		sanitizer.allowedAttributes[strings.ToLower(attribute)] = true
+	}
+	return sanitizer
+}
+
+func (s *htmlSanitizer) Extend(m goldmark.Markdown) {
+	if s.mode == sanitizeUnsafe {
+		m.Renderer().AddOptions(html.WithUnsafe())
+		return
+	}
+	m.Renderer().AddOptions(
+		renderer.WithNodeRenderers(
+			util.Prioritized(s, 100),
+		),
+	)
+}
+
+func (s *htmlSanitizer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindRawHTML, s.renderRawHTML)
+	reg.Register(ast.KindHTMLBlock, s.renderHTMLBlock)
+}
+
+func (s *htmlSanitizer) renderRawHTML(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkSkipChildren, nil
+	}
+	n := node.(*ast.RawHTML)
+	var raw bytes.Buffer
+	for i := 0; i < n.Segments.Len(); i++ {
+		segment := n.Segments.At(i)
+		raw.Write(segment.Value(source))
+	}
+	_, _ = w.Write(s.sanitize(raw.Bytes()))
+	return ast.WalkSkipChildren, nil
+}
+
+func (s *htmlSanitizer) renderHTMLBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*ast.HTMLBlock)
+	var raw bytes.Buffer
+	for i := 0; i < n.Lines().Len(); i++ {
+		line := n.Lines().At(i)
+		raw.Write(line.Value(source))
+	}
+	if n.HasClosure() {
+		raw.Write(n.ClosureLine.Value(source))
+	}
+	_, _ = w.Write(s.sanitize(raw.Bytes()))
+	return ast.WalkContinue, nil
+}
+
+func (s *htmlSanitizer) sanitize(raw []byte) []byte {
+	if s.mode == sanitizeEscape {
+		return []byte(nethtml.EscapeString(string(raw)))
+	}
+
+	var out bytes.Buffer
+	tokenizer := nethtml.NewTokenizer(bytes.NewReader(raw))
+	dropping := ""
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == nethtml.ErrorToken {
+			if tokenizer.Err() != io.EOF {
+				out.WriteString(nethtml.EscapeString(string(tokenizer.Raw())))
+			}
+			break
+		}
+		token := tokenizer.Token()
+
+		if dropping != "" {
+			if tokenType == nethtml.EndTagToken && token.Data == dropping {
+				dropping = ""
+			}
+			continue
+		}
+
+		switch tokenType {
+		case nethtml.StartTagToken, nethtml.SelfClosingTagToken:
+			if !s.allowedTags[token.Data] {
+				if tokenType == nethtml.StartTagToken && sanitizeDropContent[token.Data] {
+					dropping = token.Data
+				}
+				continue
+			}
+			token.Attr = s.sanitizeAttributes(token.Attr)
+			out.WriteString(token.String())
+		case nethtml.EndTagToken:
+			if s.allowedTags[token.Data] {
+				out.WriteString(token.String())
+			}
+		case nethtml.TextToken:
+			out.WriteString(nethtml.EscapeString(token.Data))
+		}
+	}
+	return out.Bytes()
+}
+
+func (s *htmlSanitizer) sanitizeAttributes(attributes []nethtml.Attribute) []nethtml.Attribute {
+	sanitized := attributes[:0]
+	for _, attribute := range attributes {
+		key := strings.ToLower(attribute.Key)
+		if !s.allowedAttributes[key] || strings.HasPrefix(key, "on") {
+			continue
+		}
+		if (key == "href" || key == "src") && !isSafeURL(attribute.Val) {
+			continue
+		}
+		sanitized = append(sanitized, attribute)
+	}
+	return sanitized
+}
+
+func isSafeURL(url string) bool {
+	url = strings.ToLower(strings.TrimSpace(url))
+	colon := strings.Index(url, ":")
+	if colon < 0 || strings.ContainsAny(url[:colon], "/?#") {
+		return true
+	}
+	scheme := url[:colon]
+	return scheme == "http" || scheme == "https" || scheme == "mailto"
+}
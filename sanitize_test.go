@@ -0,0 +1,103 @@
+package main
+
+import "testing"
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   string
+		tags   []string
+		source string
+		want   string
+	}{
+		{
+			name:   "allowed tags kept",
+			mode:   sanitizeAllowlist,
+			source: `<p class="note">Some <em>text</em></p>`,
+			want:   `<p class="note">Some <em>text</em></p>`,
+		},
+		{
+			name:   "unknown tag dropped, text kept",
+			mode:   sanitizeAllowlist,
+			source: `<blink>Look</blink>`,
+			want:   `Look`,
+		},
+		{
+			name:   "script dropped with its contents",
+			mode:   sanitizeAllowlist,
+			source: `<p>a</p><script>alert(1)</script><p>b</p>`,
+			want:   `<p>a</p><p>b</p>`,
+		},
+		{
+			name:   "event handler dropped",
+			mode:   sanitizeAllowlist,
+			tags:   []string{"img"},
+			source: `<img src="/cat.png" onerror="alert(1)" alt="cat">`,
+			want:   `<img src="/cat.png" alt="cat">`,
+		},
+		{
+			name:   "unsafe link dropped",
+			mode:   sanitizeAllowlist,
+			source: `<a href="javascript:alert(1)" title="t">x</a>`,
+			want:   `<a title="t">x</a>`,
+		},
+		{
+			name:   "attribute not allowlisted",
+			mode:   sanitizeAllowlist,
+			source: `<div style="color: red" id="d">x</div>`,
+			want:   `<div id="d">x</div>`,
+		},
+		{
+			name:   "configured tags replace the defaults",
+			mode:   sanitizeAllowlist,
+			tags:   []string{"b"},
+			source: `<b>bold</b> <i>italic</i>`,
+			want:   `<b>bold</b> italic`,
+		},
+		{
+			name:   "text escaped",
+			mode:   sanitizeAllowlist,
+			source: `<p>1 &lt; 2 &amp; "3"</p>`,
+			want:   `<p>1 &lt; 2 &amp; &#34;3&#34;</p>`,
+		},
+		{
+			name:   "escape mode",
+			mode:   sanitizeEscape,
+			source: `<b>hi</b>`,
+			want:   `&lt;b&gt;hi&lt;/b&gt;`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sanitizer := newHTMLSanitizer(test.mode, test.tags, nil)
+			if got := string(sanitizer.sanitize([]byte(test.source))); got != test.want {
+				t.Errorf("sanitize(%q) = %q, want %q", test.source, got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsSafeURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://example.com/", true},
+		{"http://example.com/", true},
+		{"mailto:someone@example.com", true},
+		{"/posts/a.html", true},
+		{"posts/a.html?at=10:30", true},
+		{"#top", true},
+		{"javascript:alert(1)", false},
+		{" JavaScript:alert(1)", false},
+		{"data:text/html,<script>alert(1)</script>", false},
+		{"vbscript:msgbox", false},
+	}
+
+	for _, test := range tests {
+		if got := isSafeURL(test.url); got != test.want {
+			t.Errorf("isSafeURL(%q) = %v, want %v", test.url, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// sassConfig sets how .scss and .sass files are compiled to CSS: the
+// command running Dart Sass, "sass" by default, the output style, expanded
+// or compressed, and more directories `@use` and `@import` look in.
+type sassConfig struct {
+	Command   string   `yaml:"command"`
+	Style     string   `yaml:"style"`
+	LoadPaths []string `yaml:"loadPaths"`
+}
+
+func isSassFile(fileName string) bool {
+	extension := getExtension(fileName)
+	return extension == ".scss" || extension == ".sass"
+}
+
+// compileSass compiles the Sass stylesheets copied to directory into CSS
+// beside them, then removes every .scss and .sass file. They are compiled
+// where they were copied, so that `@use` finds the partials of the site and
+// the theme alike, a site's partial replacing the theme's of the same name.
+// Partials, whose names start with an underscore, are only compiled as part
+// of the stylesheets using them.
+func (b *builder) compileSass(directory string) {
+	var stylesheets, files []string
+	walk(directory, func(fileName string) {
+		if !isSassFile(fileName) {
+			return
+		}
+		files = append(files, fileName)
+		if !strings.HasPrefix(filepath.Base(fileName), "_") {
+			stylesheets = append(stylesheets, fileName)
+		}
+	})
+	if len(files) == 0 {
+		return
+	}
+
+	config := b.settings.Sass
+	command := strings.Fields(config.Command)
+	if len(command) == 0 {
+		command = []string{"sass"}
+	}
+	if len(stylesheets) > 0 {
+		if _, err := exec.LookPath(command[0]); err != nil {
+			log.Fatalf("%s compiles the site's .scss and .sass files but is not installed; install Dart Sass from https://sass-lang.com/install or set sass.command in config.md.\n", command[0])
+		}
+	}
+
+	args := append(command[1:], "--no-source-map", "--load-path="+directory)
+	if config.Style != "" {
+		args = append(args, "--style="+config.Style)
+	}
+	for _, loadPath := range config.LoadPaths {
+		args = append(args, "--load-path="+loadPath)
+	}
+	for _, stylesheet := range stylesheets {
+		guardFile(func() {
+			var output, errors bytes.Buffer
+			compile := exec.Command(command[0], append(args, stylesheet)...)
+			compile.Stdout = &output
+			compile.Stderr = &errors
+			if err := compile.Run(); err != nil {
+				failAt(staticSource(stylesheet), 0, "%v\n%s", err, strings.TrimSpace(errors.String()))
+			}
+			b.writeOutput(changeExtension(stylesheet, ".css"), output.Bytes())
+		})
+	}
+	for _, file := range files {
+		check(os.Remove(file))
+	}
+}
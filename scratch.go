@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/spf13/cast"
+)
+
+// Scratch is a key-value store templates can write to while they render,
+// available per page as .Scratch and per build as .Site.Scratch. Its
+// methods return an empty string so that calls render nothing.
+type Scratch struct {
+	mu     sync.RWMutex
+	values map[string]interface{}
+}
+
+func newScratch() *Scratch {
+	return &Scratch{values: make(map[string]interface{})}
+}
+
+func (s *Scratch) Set(key string, value interface{}) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+	return ""
+}
+
+func (s *Scratch) Get(key string) interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.values[key]
+}
+
+func (s *Scratch) Delete(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+	return ""
+}
+
+func (s *Scratch) Values() map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	values := make(map[string]interface{}, len(s.values))
+	for key, value := range s.values {
+		values[key] = value
+	}
+	return values
+}
+
+// Add adds value to the value stored at key: numbers are summed, strings
+// concatenated, and lists appended to. A missing key is set to value.
+func (s *Scratch) Add(key string, value interface{}) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.values[key]
+	if !ok || existing == nil {
+		s.values[key] = value
+		return "", nil
+	}
+
+	existingValue := reflect.ValueOf(existing)
+	switch existingValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		list := make([]interface{}, 0, existingValue.Len()+1)
+		for i := 0; i < existingValue.Len(); i++ {
+			list = append(list, existingValue.Index(i).Interface())
+		}
+		addedValue := reflect.ValueOf(value)
+		if addedValue.Kind() == reflect.Slice || addedValue.Kind() == reflect.Array {
+			for i := 0; i < addedValue.Len(); i++ {
+				list = append(list, addedValue.Index(i).Interface())
+			}
+		} else {
+			list = append(list, value)
+		}
+		s.values[key] = list
+	case reflect.String:
+		s.values[key] = existing.(string) + cast.ToString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		added, err := cast.ToInt64E(value)
+		if err != nil {
+			return "", fmt.Errorf("cannot add %v to the number at %q", value, key)
+		}
+		s.values[key] = cast.ToInt64(existing) + added
+	case reflect.Float32, reflect.Float64:
+		added, err := cast.ToFloat64E(value)
+		if err != nil {
+			return "", fmt.Errorf("cannot add %v to the number at %q", value, key)
+		}
+		s.values[key] = cast.ToFloat64(existing) + added
+	default:
+		return "", fmt.Errorf("cannot add to the %T at %q", existing, key)
+	}
+	return "", nil
+}
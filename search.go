@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/cast"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var defaultSearchWeights = map[string]float64{
+	"title":    10,
+	"headings": 5,
+	"tags":     3,
+	"body":     1,
+}
+
+const defaultSnippetLength = 24
+
+type snippetConfig struct {
+	Length int      `yaml:"length"`
+	Fields []string `yaml:"fields"`
+}
+
+type searchConfig struct {
+	Enabled  bool               `yaml:"enabled"`
+	Output   string             `yaml:"output"`
+	Weights  map[string]float64 `yaml:"weights"`
+	Snippets snippetConfig      `yaml:"snippets"`
+}
+
+type searchDocument struct {
+	URL      string   `json:"url"`
+	Title    string   `json:"title"`
+	Section  string   `json:"section"`
+	Tags     []string `json:"tags"`
+	Headings []string `json:"headings"`
+	Body     string   `json:"body"`
+	Boost    float64  `json:"boost"`
+
+	Snippets map[string][]string `json:"snippets"`
+}
+
+// searchIndex is the JSON document a client-side search script loads: the
+// pages with their searchable fields, the weight of each field, the
+// sections to filter by, and for every term, the pages it appears in with
+// a score weighting each occurrence by its field and the page's boost.
+// Snippets locates every term in the snippets of the pages' snippet
+// fields, as [page, field, snippet] triples, for showing results in
+// context.
+type searchIndex struct {
+	Weights       map[string]float64      `json:"weights"`
+	Sections      []string                `json:"sections"`
+	SnippetFields []string                `json:"snippetFields"`
+	Pages         []searchDocument        `json:"pages"`
+	Terms         map[string][][2]float64 `json:"terms"`
+	Snippets      map[string][][3]int     `json:"snippets"`
+}
+
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// pageText returns the text of rendered HTML and the text of its headings.
+func pageText(body string) (string, []string) {
+	var text strings.Builder
+	headings := []string{}
+	var heading *strings.Builder
+	skip := 0
+
+	tokenizer := html.NewTokenizer(strings.NewReader(body))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return strings.Join(strings.Fields(text.String()), " "), headings
+		case html.StartTagToken:
+			name, _ := tokenizer.TagName()
+			switch atom.Lookup(name) {
+			case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+				heading = &strings.Builder{}
+			case atom.Script, atom.Style:
+				skip++
+			}
+			text.WriteByte(' ')
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch atom.Lookup(name) {
+			case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+				if heading != nil {
+					headings = append(headings, strings.TrimSpace(heading.String()))
+					heading = nil
+				}
+			case atom.Script, atom.Style:
+				skip--
+			}
+			text.WriteByte(' ')
+		case html.TextToken:
+			if skip > 0 {
+				continue
+			}
+			data := string(tokenizer.Text())
+			text.WriteString(data)
+			if heading != nil {
+				heading.WriteString(data)
+			}
+		}
+	}
+}
+
+// splitSnippets splits text into snippets of at most length words.
+func splitSnippets(text string, length int) []string {
+	words := strings.Fields(text)
+	snippets := []string{}
+	for start := 0; start < len(words); start += length {
+		end := min(start+length, len(words))
+		snippets = append(snippets, strings.Join(words[start:end], " "))
+	}
+	return snippets
+}
+
+// buildSearchIndex indexes every page that is not excluded with `Noindex`
+// or `Search: false`. A page's `SearchBoost` front matter multiplies its
+// scores.
+func buildSearchIndex(pages []*Page, weights map[string]float64, snippets snippetConfig) searchIndex {
+	index := searchIndex{
+		Weights:       make(map[string]float64),
+		SnippetFields: snippets.Fields,
+		Terms:         make(map[string][][2]float64),
+		Snippets:      make(map[string][][3]int),
+	}
+	if index.SnippetFields == nil {
+		index.SnippetFields = []string{"body"}
+	}
+	if snippets.Length <= 0 {
+		snippets.Length = defaultSnippetLength
+	}
+	for field, weight := range defaultSearchWeights {
+		index.Weights[field] = weight
+	}
+	for field, weight := range weights {
+		index.Weights[field] = weight
+	}
+
+	sections := make(map[string]bool)
+	for _, page := range pages {
+		if page.Noindex || frontMatterValue(page.metaData, "search") == false {
+			continue
+		}
+		body, headings := pageText(string(page.Body))
+		boost := 1.0
+		if value := frontMatterValue(page.metaData, "searchBoost"); value != nil {
+			boost = cast.ToFloat64(value)
+		}
+
+		document := searchDocument{
+			URL:      page.RelPermalink,
+			Title:    page.Title,
+			Section:  page.Section,
+			Tags:     append([]string{}, page.Tags...),
+			Headings: headings,
+			Body:     body,
+			Boost:    boost,
+		}
+		position := len(index.Pages)
+		if page.Section != "" {
+			sections[page.Section] = true
+		}
+
+		scores := make(map[string]float64)
+		fields := map[string]string{
+			"title":    document.Title,
+			"headings": strings.Join(headings, " "),
+			"tags":     strings.Join(document.Tags, " "),
+			"body":     body,
+		}
+
+		document.Snippets = make(map[string][]string)
+		for fieldIndex, field := range index.SnippetFields {
+			document.Snippets[field] = splitSnippets(fields[field], snippets.Length)
+			for snippetIndex, snippet := range document.Snippets[field] {
+				seen := make(map[string]bool)
+				for _, term := range searchTerms(snippet) {
+					if !seen[term] {
+						seen[term] = true
+						index.Snippets[term] = append(index.Snippets[term], [3]int{position, fieldIndex, snippetIndex})
+					}
+				}
+			}
+		}
+		index.Pages = append(index.Pages, document)
+
+		for field, text := range fields {
+			for _, term := range searchTerms(text) {
+				scores[term] += index.Weights[field] * boost
+			}
+		}
+		for term, score := range scores {
+			index.Terms[term] = append(index.Terms[term], [2]float64{float64(position), score})
+		}
+	}
+
+	for section := range sections {
+		index.Sections = append(index.Sections, section)
+	}
+	sort.Strings(index.Sections)
+	for _, postings := range index.Terms {
+		sort.SliceStable(postings, func(i, j int) bool {
+			return postings[i][1] > postings[j][1]
+		})
+	}
+	return index
+}
+
+func (b *builder) writeSearchIndex(site *Site) {
+	config := b.settings.Search
+	if !config.Enabled {
+		return
+	}
+	output := config.Output
+	if output == "" {
+		output = "search-index.json"
+	}
+
+	index := buildSearchIndex(append(append([]*Page{}, site.Pages...), site.ListPages...), config.Weights, config.Snippets)
+	data, err := json.Marshal(index)
+	check(err)
+	b.writeOutput(outputDirectory+"/"+strings.TrimPrefix(output, "/"), data)
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+type serverOptions struct {
+	directory      string
+	basePath       string
+	port           int
+	production     bool
+	tlsCertificate string
+	tlsKey         string
+	basicAuth      string
+	token          string
+	share          *shareConfig
+	logRequests    bool
+	reloads        *reloadHub
+	lazy           *lazyPages
+}
+
+const tokenCookieName = "grafe_token"
+
+var fingerprintedFilePattern = regexp.MustCompile(`\.[0-9a-f]{8,}\.[0-9a-z]+$`)
+
+var compressibleTypes = []string{
+	"text/",
+	"application/javascript",
+	"application/json",
+	"application/manifest+json",
+	"application/rss+xml",
+	"application/atom+xml",
+	"application/xml",
+	"application/wasm",
+	"image/svg+xml",
+}
+
+// indexFileServer serves directory like http.FileServer, but answers
+// `/post` and `/post/index.html` with `/post/index.html` instead of
+// redirecting, so that every canonical URL form works locally.
+func indexFileServer(directory string) http.Handler {
+	fileServer := http.FileServer(http.Dir(directory))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filePath := filepath.Join(directory, filepath.FromSlash(path.Clean("/"+r.URL.Path)))
+		if info, err := os.Stat(filePath); err == nil && info.IsDir() && !strings.HasSuffix(r.URL.Path, "/") {
+			filePath = filepath.Join(filePath, "index.html")
+		}
+		if filepath.Base(filePath) == "index.html" {
+			if file, err := os.Open(filePath); err == nil {
+				defer file.Close()
+				if info, err := file.Stat(); err == nil {
+					http.ServeContent(w, r, filePath, info.ModTime(), file)
+					return
+				}
+			}
+		}
+		fileServer.ServeHTTP(w, r)
+	})
+}
+
+// cacheControl marks fingerprinted files as immutable, asks browsers to
+// revalidate pages and the service worker on every use, and lets them keep
+// other files for an hour.
+func cacheControl(urlPath string) string {
+	if fingerprintedFilePattern.MatchString(urlPath) {
+		return "public, max-age=31536000, immutable"
+	}
+	if ext := path.Ext(urlPath); ext == "" || ext == ".html" || path.Base(urlPath) == serviceWorkerFile {
+		return "no-cache"
+	}
+	return "public, max-age=3600, must-revalidate"
+}
+
+func cacheHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", cacheControl(r.URL.Path))
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isCompressible(contentType string) bool {
+	for _, prefix := range compressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type compressedResponseWriter struct {
+	http.ResponseWriter
+	encoding    string
+	encoder     io.WriteCloser
+	wroteHeader bool
+}
+
+func (w *compressedResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	header := w.Header()
+	header.Add("Vary", "Accept-Encoding")
+	if status == http.StatusOK && header.Get("Content-Encoding") == "" && isCompressible(header.Get("Content-Type")) {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", w.encoding)
+		if w.encoding == "br" {
+			w.encoder = brotli.NewWriterLevel(w.ResponseWriter, brotli.DefaultCompression)
+		} else {
+			w.encoder, _ = gzip.NewWriterLevel(w.ResponseWriter, gzip.DefaultCompression)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *compressedResponseWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(data))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *compressedResponseWriter) Close() error {
+	if w.encoder != nil {
+		return w.encoder.Close()
+	}
+	return nil
+}
+
+func negotiateEncoding(acceptEncoding string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		if len(fields) > 1 && strings.ReplaceAll(strings.TrimSpace(fields[1]), " ", "") == "q=0" {
+			continue
+		}
+		accepted[strings.TrimSpace(fields[0])] = true
+	}
+	if accepted["br"] {
+		return "br"
+	}
+	if accepted["gzip"] {
+		return "gzip"
+	}
+	return ""
+}
+
+// compressResponses compresses text responses with brotli or gzip,
+// whichever the client prefers.
+func compressResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if contentType := mime.TypeByExtension(path.Ext(r.URL.Path)); contentType != "" && !isCompressible(contentType) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r.Header.Del("Range")
+		compressed := &compressedResponseWriter{ResponseWriter: w, encoding: encoding}
+		defer compressed.Close()
+		next.ServeHTTP(compressed, r)
+	})
+}
+
+func equalSecrets(given string, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
+
+// requireAccess only lets requests through that carry the basic auth
+// credentials ("user:password") or the access token. The token may be given
+// once as a `token` query parameter, after which it is kept in a cookie so
+// that shared preview links work in a browser.
+func requireAccess(basicAuth string, token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			if queryToken := r.URL.Query().Get("token"); queryToken != "" && equalSecrets(queryToken, token) {
+				http.SetCookie(w, &http.Cookie{
+					Name:     tokenCookieName,
+					Value:    token,
+					Path:     "/",
+					HttpOnly: true,
+					Secure:   r.TLS != nil,
+					SameSite: http.SameSiteLaxMode,
+				})
+				query := r.URL.Query()
+				query.Del("token")
+				redirectURL := *r.URL
+				redirectURL.RawQuery = query.Encode()
+				http.Redirect(w, r, redirectURL.String(), http.StatusFound)
+				return
+			}
+			if cookie, err := r.Cookie(tokenCookieName); err == nil && equalSecrets(cookie.Value, token) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		if basicAuth != "" {
+			if user, password, ok := r.BasicAuth(); ok && equalSecrets(user+":"+password, basicAuth) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="grafe preview", charset="UTF-8"`)
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// serverHandler puts together the handler chain the server runs. The
+// reload socket is routed past the handlers that rewrite response bodies,
+// since those cannot hand the connection over to the websocket.
+func serverHandler(options serverOptions, notFound *notFoundReport) http.Handler {
+	mux := http.NewServeMux()
+	files := indexFileServer(options.directory)
+	if options.lazy != nil {
+		files = renderOnRequest(options.lazy, files)
+	}
+	mux.Handle(options.basePath+"/", http.StripPrefix(options.basePath, files))
+	if options.basePath != "" {
+		mux.Handle("/", http.RedirectHandler(options.basePath+"/", http.StatusFound))
+	}
+
+	var handler http.Handler = mux
+	if options.reloads != nil {
+		handler = injectReloadScript(handler)
+	}
+	if options.production {
+		handler = compressResponses(cacheHeaders(handler))
+	}
+	if options.reloads != nil {
+		routes := http.NewServeMux()
+		routes.Handle(reloadPath, options.reloads)
+		routes.Handle("/", handler)
+		handler = routes
+	}
+	if options.basicAuth != "" || options.token != "" {
+		handler = requireAccess(options.basicAuth, options.token, handler)
+	}
+	return recordRequests(options.logRequests, notFound, handler)
+}
+
+func startHTTPServer(options serverOptions) {
+	notFound := newNotFoundReport()
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", options.port),
+		Handler:           serverHandler(options, notFound),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	if options.share != nil {
+		tunnel, err := startShareTunnel(*options.share, options.port, func(url string) {
+			url += options.basePath + "/"
+			if options.token != "" {
+				url += "?token=" + options.token
+			}
+			fmt.Printf("Sharing preview at %s\n", url)
+		})
+		if err != nil {
+			log.Fatalf("Could not start share tunnel: %v\n", err)
+		}
+		defer tunnel.Process.Kill()
+	}
+
+	var err error
+	if options.tlsCertificate != "" || options.tlsKey != "" {
+		fmt.Printf("Started server at https://localhost:%d%s/\n", options.port, options.basePath)
+		err = server.ListenAndServeTLS(options.tlsCertificate, options.tlsKey)
+	} else {
+		fmt.Printf("Started server at http://localhost:%d%s/\n", options.port, options.basePath)
+		err = server.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	notFound.write(os.Stdout)
+	fmt.Print("\nClosed server\n\n")
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestReloadSocketThroughHandlerChain(t *testing.T) {
+	tests := []struct {
+		name    string
+		options serverOptions
+	}{
+		{"development", serverOptions{}},
+		{"logged requests", serverOptions{logRequests: true}},
+		{"production", serverOptions{production: true}},
+		{"base path", serverOptions{basePath: "/blog"}},
+		{"basic auth", serverOptions{production: true, basicAuth: "user:secret"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := test.options
+			options.directory = t.TempDir()
+			options.reloads = newReloadHub()
+			server := httptest.NewServer(serverHandler(options, newNotFoundReport()))
+			defer server.Close()
+
+			config, err := websocket.NewConfig("ws"+strings.TrimPrefix(server.URL, "http")+reloadPath, server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			config.Header.Set("Accept-Encoding", "gzip, br")
+			if options.basicAuth != "" {
+				config.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(options.basicAuth)))
+			}
+			socket, err := websocket.DialConfig(config)
+			if err != nil {
+				t.Fatalf("dialing the reload socket: %v", err)
+			}
+			defer socket.Close()
+
+			// The hub only sees the client once the handler has registered
+			// it, so keep asking for a reload until one arrives.
+			received := make(chan string, 1)
+			go func() {
+				var message string
+				if websocket.Message.Receive(socket, &message) == nil {
+					received <- message
+				}
+			}()
+			deadline := time.After(5 * time.Second)
+			for {
+				options.reloads.reload()
+				select {
+				case message := <-received:
+					if message != "reload" {
+						t.Fatalf("got message %q, want %q", message, "reload")
+					}
+					return
+				case <-deadline:
+					t.Fatal("no reload message arrived")
+				case <-time.After(20 * time.Millisecond):
+				}
+			}
+		})
+	}
+}
+
+func TestReloadSocketRequiresAccess(t *testing.T) {
+	options := serverOptions{directory: t.TempDir(), reloads: newReloadHub(), basicAuth: "user:secret"}
+	server := httptest.NewServer(serverHandler(options, newNotFoundReport()))
+	defer server.Close()
+
+	_, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+reloadPath, "", server.URL)
+	if err == nil {
+		t.Fatal("dialed the reload socket without credentials")
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const serviceWorkerFile = "sw.js"
+
+// serviceWorkerConfig turns on the service worker, which precaches the
+// site's fingerprinted files and the Offline page, the URL of a page shown
+// when the visitor is offline and the page they asked for was never
+// visited. Precache lists more URLs to cache up front.
+type serviceWorkerConfig struct {
+	Offline  string   `yaml:"offline"`
+	Precache []string `yaml:"precache"`
+}
+
+// serviceWorkerRegistration is what the built-in include registers the
+// service worker with.
+type serviceWorkerRegistration struct {
+	URL   string
+	Scope string
+}
+
+// ServiceWorker returns where the site's service worker is, or nil if it
+// has none.
+func (site *Site) ServiceWorker() *serviceWorkerRegistration {
+	if site.settings.ServiceWorker == nil {
+		return nil
+	}
+	return &serviceWorkerRegistration{
+		URL:   site.settings.sitePath("/" + serviceWorkerFile),
+		Scope: site.settings.sitePath("/"),
+	}
+}
+
+// writeServiceWorker writes the service worker for the built site. Its
+// version is a hash of the files it precaches, so that every change to
+// them changes the worker and browsers install the new one, which drops
+// the caches of the old.
+func writeServiceWorker(settings siteConfig) {
+	config := settings.ServiceWorker
+	if config == nil {
+		return
+	}
+
+	version := sha256.New()
+	var precache []string
+	walk(outputDirectory, func(fileName string) {
+		name := strings.TrimPrefix(fileName, outputDirectory+"/")
+		if !fingerprintedFilePattern.MatchString(name) {
+			return
+		}
+		data, err := os.ReadFile(fileName)
+		check(err)
+		fmt.Fprintf(version, "%s %x\n", name, sha256.Sum256(data))
+		precache = append(precache, settings.sitePath("/"+name))
+	})
+
+	resolver := exportResolver{directory: outputDirectory, basePath: settings.BasePath}
+	offline := ""
+	if config.Offline != "" {
+		offline = settings.sitePath(config.Offline)
+		file := resolver.file(offline, outputDirectory+"/index.html")
+		if file == "" && !strings.HasSuffix(offline, "/") {
+			file = resolver.file(offline+".html", outputDirectory+"/index.html")
+		}
+		if file == "" {
+			warnf("serviceWorker.offline: %s is not a page of the site", config.Offline)
+		} else {
+			data, err := os.ReadFile(file)
+			check(err)
+			fmt.Fprintf(version, "%s %x\n", offline, sha256.Sum256(data))
+			precache = append(precache, offline)
+		}
+	}
+	for _, url := range config.Precache {
+		if !strings.Contains(url, "://") {
+			url = settings.sitePath(url)
+		}
+		fmt.Fprintf(version, "%s\n", url)
+		precache = append(precache, url)
+	}
+	sort.Strings(precache)
+
+	data, err := json.Marshal(map[string]interface{}{
+		"version":  fmt.Sprintf("%x", version.Sum(nil))[:12],
+		"precache": precache,
+		"offline":  offline,
+	})
+	check(err)
+	script := "const grafe = " + string(data) + ";\n" + serviceWorkerScript
+	check(os.WriteFile(outputDirectory+"/"+serviceWorkerFile, []byte(script), 0666))
+	recordOutput(outputDirectory + "/" + serviceWorkerFile)
+}
+
+// serviceWorkerScript serves fingerprinted files, which never change, from
+// the cache; fetches pages from the network, keeping a copy for when the
+// visitor is offline, and falls back to the copy or the offline page; and
+// fetches other files from the network, falling back to the cache.
+const serviceWorkerScript = `const cacheName = "grafe-" + grafe.version;
+const fingerprinted = /\.[0-9a-f]{8,}\.[0-9a-z]+$/;
+
+self.addEventListener("install", (event) => {
+	event.waitUntil(caches.open(cacheName).then((cache) => cache.addAll(grafe.precache)).then(() => self.skipWaiting()));
+});
+
+self.addEventListener("activate", (event) => {
+	event.waitUntil(caches.keys().then((names) => Promise.all(names.filter((name) => name.startsWith("grafe-") && name !== cacheName).map((name) => caches.delete(name)))).then(() => self.clients.claim()));
+});
+
+function keep(request, response) {
+	if (response.ok) {
+		const copy = response.clone();
+		caches.open(cacheName).then((cache) => cache.put(request, copy));
+	}
+	return response;
+}
+
+self.addEventListener("fetch", (event) => {
+	const request = event.request;
+	if (request.method !== "GET" || new URL(request.url).origin !== self.location.origin) {
+		return;
+	}
+	if (fingerprinted.test(new URL(request.url).pathname)) {
+		event.respondWith(caches.match(request).then((cached) => cached || fetch(request).then((response) => keep(request, response))));
+	} else if (request.mode === "navigate") {
+		event.respondWith(fetch(request).then((response) => keep(request, response)).catch(() => caches.match(request).then((cached) => cached || caches.match(grafe.offline || request)).then((cached) => cached || Response.error())));
+	} else {
+		event.respondWith(fetch(request).catch(() => caches.match(request).then((cached) => cached || Response.error())));
+	}
+});
+`
+
+const serviceWorkerTemplate = "service-worker.html"
+
+// serviceWorkerInclude is the built-in include registering the service
+// worker.
+const serviceWorkerInclude = `{{ with .Site.ServiceWorker }}<script>
+if ("serviceWorker" in navigator) {
+	navigator.serviceWorker.register("{{ .URL }}", { scope: "{{ .Scope }}" });
+}
+</script>{{ end }}`
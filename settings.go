@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// settingFields returns the settings of a struct decoded from config.md by
+// the names they are written as, including those of inlined structs.
+func settingFields(settingsType reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < settingsType.NumField(); i++ {
+		field := settingsType.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if options == "inline" {
+			for name, fieldType := range settingFields(field.Type) {
+				fields[name] = fieldType
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// closestSetting returns the setting among names that name is most likely
+// a misspelling of, or "" if none is close.
+func closestSetting[T any](name string, names map[string]T) string {
+	maxDistance := 2
+	if len(name) <= 4 {
+		maxDistance = 1
+	}
+	closest, closestDistance := "", maxDistance+1
+	for candidate := range names {
+		distance := editDistance(strings.ToLower(name), strings.ToLower(candidate))
+		if distance < closestDistance || distance == closestDistance && candidate < closest {
+			closest, closestDistance = candidate, distance
+		}
+	}
+	return closest
+}
+
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func describeSettingType(settingType reflect.Type) string {
+	switch settingType.Kind() {
+	case reflect.Ptr:
+		return describeSettingType(settingType.Elem())
+	case reflect.Struct, reflect.Map:
+		return "map"
+	case reflect.Slice:
+		return "list"
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int64:
+		return "whole number"
+	case reflect.Float64:
+		return "number"
+	}
+	return settingType.String()
+}
+
+// checkSetting checks value against the type of the setting at key, adding
+// a problem for every value that is of the wrong type and every key of a
+// map of settings that is not one.
+func checkSetting(key string, value interface{}, settingType reflect.Type, problems *[]string) {
+	if value == nil {
+		return
+	}
+	mismatch := func() {
+		*problems = append(*problems, fmt.Sprintf("%s should be a %s, not %#v", key, describeSettingType(settingType), value))
+	}
+	switch settingType.Kind() {
+	case reflect.Ptr:
+		checkSetting(key, value, settingType.Elem(), problems)
+	case reflect.Struct:
+		settings, ok := value.(map[string]interface{})
+		if !ok {
+			mismatch()
+			return
+		}
+		fields := settingFields(settingType)
+		for _, name := range sortedKeys(settings) {
+			fieldType, ok := fields[name]
+			if !ok {
+				problem := fmt.Sprintf("%s.%s is not a setting", key, name)
+				if closest := closestSetting(name, fields); closest != "" {
+					problem += fmt.Sprintf("; did you mean %s.%s?", key, closest)
+				}
+				*problems = append(*problems, problem)
+				continue
+			}
+			checkSetting(key+"."+name, settings[name], fieldType, problems)
+		}
+	case reflect.Map:
+		entries, ok := value.(map[string]interface{})
+		if !ok {
+			mismatch()
+			return
+		}
+		for _, name := range sortedKeys(entries) {
+			checkSetting(key+"."+name, entries[name], settingType.Elem(), problems)
+		}
+	case reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			mismatch()
+			return
+		}
+		for i, item := range items {
+			checkSetting(fmt.Sprintf("%s[%d]", key, i), item, settingType.Elem(), problems)
+		}
+	case reflect.String:
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			mismatch()
+		}
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			mismatch()
+		}
+	case reflect.Int, reflect.Int64:
+		if _, ok := value.(int); !ok {
+			mismatch()
+		}
+	case reflect.Float64:
+		switch value.(type) {
+		case int, float64:
+		default:
+			mismatch()
+		}
+	}
+}
+
+func sortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// checkSettings checks grafe's settings in config, which would otherwise be
+// ignored when misspelled and fail to decode when mistyped, and reports
+// every problem at once. Other top-level keys are the site's params, so
+// they are only warned about when they look like a misspelled setting and
+// the theme does not read them.
+func checkSettings(config map[string]interface{}, schema map[string]themeParam) error {
+	fields := settingFields(reflect.TypeOf(siteConfig{}))
+	var problems []string
+	for _, key := range sortedKeys(config) {
+		if fieldType, ok := fields[key]; ok {
+			checkSetting(key, config[key], fieldType, &problems)
+			continue
+		}
+		if _, ok := schema[key]; ok {
+			continue
+		}
+		if closest := closestSetting(key, fields); closest != "" {
+			warnAt("config.md", sourceLine("config.md", key+":"), "%s is not a setting but a param; did you mean %s?", key, closest)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("the settings in config.md are not valid:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// shareConfig describes a tunnel command that exposes the local server. Any
+// `{port}` in Command is replaced with the server port, and the first line
+// of its output matching URLPattern is the public preview URL.
+type shareConfig struct {
+	Command    []string `yaml:"command"`
+	URLPattern string   `yaml:"urlPattern"`
+}
+
+var shareProviders = map[string]shareConfig{
+	"localhost.run": {
+		Command:    []string{"ssh", "-o", "StrictHostKeyChecking=accept-new", "-o", "ServerAliveInterval=30", "-R", "80:localhost:{port}", "nokey@localhost.run"},
+		URLPattern: `https://[0-9a-z.-]+\.(?:lhr\.life|localhost\.run)`,
+	},
+	"serveo": {
+		Command:    []string{"ssh", "-o", "StrictHostKeyChecking=accept-new", "-o", "ServerAliveInterval=30", "-R", "80:localhost:{port}", "serveo.net"},
+		URLPattern: `https://[0-9a-z.-]+\.serveo(?:usercontent)?\.(?:net|com)`,
+	},
+	"cloudflared": {
+		Command:    []string{"cloudflared", "tunnel", "--no-autoupdate", "--url", "http://localhost:{port}"},
+		URLPattern: `https://[0-9a-z-]+\.trycloudflare\.com`,
+	},
+}
+
+// shareProvider returns the tunnel to use: the `share` settings from the
+// site config if they name a command, otherwise the built-in provider.
+func shareProvider(name string, config shareConfig) (shareConfig, error) {
+	if len(config.Command) > 0 {
+		if config.URLPattern == "" {
+			config.URLPattern = `https://\S+`
+		}
+		return config, nil
+	}
+	provider, ok := shareProviders[name]
+	if !ok {
+		return shareConfig{}, fmt.Errorf("unknown share provider %q", name)
+	}
+	return provider, nil
+}
+
+// startShareTunnel runs the tunnel command and calls onURL with the public
+// URL once the tunnel reports it. The returned command is stopped by the
+// caller when the server closes.
+func startShareTunnel(config shareConfig, port int, onURL func(string)) (*exec.Cmd, error) {
+	urlPattern, err := regexp.Compile(config.URLPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, len(config.Command))
+	for i, arg := range config.Command {
+		args[i] = strings.ReplaceAll(arg, "{port}", strconv.Itoa(port))
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	// The command is waited for once both pipes are read to the end, since
+	// Wait closes them.
+	var once sync.Once
+	var scanners sync.WaitGroup
+	scan := func(output io.Reader) {
+		defer scanners.Done()
+		scanner := bufio.NewScanner(output)
+		for scanner.Scan() {
+			if url := urlPattern.FindString(scanner.Text()); url != "" {
+				once.Do(func() { onURL(url) })
+			}
+		}
+	}
+	scanners.Add(2)
+	go scan(stdout)
+	go scan(stderr)
+	go func() {
+		scanners.Wait()
+		if err := cmd.Wait(); err != nil {
+			log.Printf("Share tunnel exited: %v\n", err)
+		}
+	}()
+
+	return cmd, nil
+}
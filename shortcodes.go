@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// shortcodeCall describes a single `{{< name args >}}` or `{{% name args %}}`
+// invocation in a content file. Paired shortcodes also carry the text between
+// the opening and `{{< /name >}}` closing tags as Inner.
+type shortcodeCall struct {
+	Name       string
+	Args       map[string]string
+	Positional []string
+	Inner      string
+	SourcePath string
+
+	assets   *pageAssets
+	settings *siteConfig
+}
+
+type shortcodeFunc func(call shortcodeCall) (string, error)
+
+var builtinShortcodes = map[string]shortcodeFunc{
+	"code":         codeShortcode,
+	"form":         formShortcode,
+	"include":      includeShortcode,
+	"picture":      pictureShortcode,
+	"themed-image": themedImageShortcode,
+}
+
+var shortcodeOpenPattern = regexp.MustCompile(`\{\{([<%])\s*([\w-]+)((?:\s+[^}]*?)?)\s*[>%]\}\}`)
+
+// escapedShortcodePattern matches a shortcode commented out as
+// `{{</* name */>}}`, which is written as `{{< name >}}` instead of run.
+var escapedShortcodePattern = regexp.MustCompile(`(?s)\{\{([<%])/\*(.*?)\*/([>%])\}\}`)
+
+var shortcodeArgPattern = regexp.MustCompile(`(?:([\w-]+)=)?(?:"((?:[^"\\]|\\.)*)"|'([^']*)'|(\S+))`)
+
+// shortcodeTagPatterns caches the shortcodeTags of each shortcode name.
+var shortcodeTagPatterns sync.Map
+
+// shortcodeTags matches the tags of one shortcode that follow its opening
+// tag: close its closing tag and next its next call.
+type shortcodeTags struct {
+	close *regexp.Regexp
+	next  *regexp.Regexp
+}
+
+func shortcodeTagsFor(name string) shortcodeTags {
+	if tags, ok := shortcodeTagPatterns.Load(name); ok {
+		return tags.(shortcodeTags)
+	}
+	tags := shortcodeTags{
+		close: regexp.MustCompile(`\{\{[<%]\s*/` + regexp.QuoteMeta(name) + `\s*[>%]\}\}`),
+		next:  regexp.MustCompile(`\{\{[<%]\s*` + regexp.QuoteMeta(name) + `[\s>%]`),
+	}
+	shortcodeTagPatterns.Store(name, tags)
+	return tags
+}
+
+func (call shortcodeCall) Arg(name string) string {
+	return call.Args[name]
+}
+
+func (call shortcodeCall) ArgOr(name string, fallback string) string {
+	if value, ok := call.Args[name]; ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+func parseShortcodeArgs(text string) (map[string]string, []string) {
+	args := make(map[string]string)
+	var positional []string
+	for _, match := range shortcodeArgPattern.FindAllStringSubmatchIndex(text, -1) {
+		var value string
+		switch {
+		case match[4] >= 0:
+			value = text[match[4]:match[5]]
+			if unquoted, err := strconv.Unquote(`"` + value + `"`); err == nil {
+				value = unquoted
+			}
+		case match[6] >= 0:
+			value = text[match[6]:match[7]]
+		default:
+			value = text[match[8]:match[9]]
+		}
+		if match[2] < 0 {
+			positional = append(positional, value)
+		} else {
+			args[text[match[2]:match[3]]] = value
+		}
+	}
+	return args, positional
+}
+
+func generateShortcodeTemplates(store *artifactStore, directory string) map[string]*template.Template {
+	shortcodeTemplates := make(map[string]*template.Template)
+
+	files, err := store.Glob(directory + "/shortcodes/*")
+	check(err)
+
+	for _, file := range files {
+		text, err := store.ReadFile(file)
+		check(err)
+		name := removeExtension(filepath.Base(file))
+		guardFile(func() {
+			shortcodeTemplate, err := template.New(name).Funcs(templateFuncMap()).Parse(string(text))
+			checkTemplateParse(templateSource(filepath.Base(file)), err)
+			shortcodeTemplates[name] = shortcodeTemplate
+		})
+	}
+
+	return shortcodeTemplates
+}
+
+// codeRanges returns the start and end of every fenced code block and code
+// span in source, in which shortcodes are left as they are.
+func codeRanges(source string) [][2]int {
+	var ranges [][2]int
+	codeFence := ""
+	fenceStart, text, offset := 0, 0, 0
+	for _, line := range strings.SplitAfter(source, "\n") {
+		if match := codeFencePattern.FindStringSubmatch(line); match != nil {
+			if codeFence == "" {
+				codeFence = match[1]
+				ranges = append(ranges, codeSpans(source[text:offset], text)...)
+				fenceStart = offset
+			} else if match[1] == codeFence {
+				codeFence = ""
+				ranges = append(ranges, [2]int{fenceStart, offset + len(line)})
+				text = offset + len(line)
+			}
+		}
+		offset += len(line)
+	}
+	if codeFence != "" {
+		return append(ranges, [2]int{fenceStart, len(source)})
+	}
+	return append(ranges, codeSpans(source[text:], text)...)
+}
+
+// codeSpans returns where the code spans of text, which starts at offset in
+// its file, are: each from a run of backticks to the next run of as many.
+func codeSpans(text string, offset int) [][2]int {
+	var spans [][2]int
+	for start := 0; start < len(text); {
+		open := strings.IndexByte(text[start:], '`')
+		if open < 0 {
+			break
+		}
+		open += start
+		length := len(text[open:]) - len(strings.TrimLeft(text[open:], "`"))
+		closing := -1
+		for search := open + length; search < len(text); {
+			next := strings.IndexByte(text[search:], '`')
+			if next < 0 {
+				break
+			}
+			next += search
+			run := len(text[next:]) - len(strings.TrimLeft(text[next:], "`"))
+			if run == length {
+				closing = next + run
+				break
+			}
+			search = next + run
+		}
+		if closing < 0 {
+			start = open + length
+			continue
+		}
+		spans = append(spans, [2]int{offset + open, offset + closing})
+		start = closing
+	}
+	return spans
+}
+
+// findOutsideCode is pattern.FindStringSubmatchIndex of source from start,
+// skipping matches that start in code, with indexes into all of source.
+func findOutsideCode(pattern *regexp.Regexp, source string, start int, code [][2]int) []int {
+	for start <= len(source) {
+		location := pattern.FindStringSubmatchIndex(source[start:])
+		if location == nil {
+			return nil
+		}
+		for i := range location {
+			if location[i] >= 0 {
+				location[i] += start
+			}
+		}
+		inCode := false
+		for _, r := range code {
+			if location[0] >= r[0] && location[0] < r[1] {
+				inCode = true
+				start = r[1]
+				break
+			}
+		}
+		if !inCode {
+			return location
+		}
+	}
+	return nil
+}
+
+// unescapeShortcodes writes the shortcodes commented out in text as they
+// are written when run.
+func unescapeShortcodes(text string) string {
+	return escapedShortcodePattern.ReplaceAllString(text, "{{$1$2$3}}")
+}
+
+func shortcodePlaceholder(index int) string {
+	return fmt.Sprintf("grafe-shortcode-%d-placeholder", index)
+}
+
+// expandShortcodes replaces every shortcode in source. Markdown shortcodes
+// (`{{% %}}`) are spliced into the source before conversion; HTML shortcodes
+// (`{{< >}}`) are replaced by placeholders whose rendered output is restored
+// by restoreShortcodes once the markdown has been converted, so that it is
+// neither reparsed nor sanitized. The scripts and styles shortcodes require
+// are added to assets, and built-in shortcodes read settings.
+//
+// Shortcodes in fenced code blocks and code spans are left as they are, and
+// shortcodes commented out as `{{</* name */>}}` are written as
+// `{{< name >}}` anywhere, so that pages can show shortcodes.
+func expandShortcodes(source string, sourcePath string, shortcodeTemplates map[string]*template.Template, assets *pageAssets, settings *siteConfig) (string, []string, error) {
+	var out strings.Builder
+	var rendered []string
+	code := codeRanges(source)
+
+	position := 0
+	for {
+		location := findOutsideCode(shortcodeOpenPattern, source, position, code)
+		if location == nil {
+			out.WriteString(unescapeShortcodes(source[position:]))
+			break
+		}
+
+		delimiter := source[location[2]:location[3]]
+		name := source[location[4]:location[5]]
+		args, positional := parseShortcodeArgs(source[location[6]:location[7]])
+
+		out.WriteString(unescapeShortcodes(source[position:location[0]]))
+		position = location[1]
+
+		inner := ""
+		tags := shortcodeTagsFor(name)
+		closing := findOutsideCode(tags.close, source, position, code)
+		// A closing tag after the next call of the same shortcode belongs to
+		// that call.
+		if next := findOutsideCode(tags.next, source, position, code); next != nil && closing != nil && next[0] < closing[0] {
+			closing = nil
+		}
+		if closing != nil {
+			inner = unescapeShortcodes(source[position:closing[0]])
+			position = closing[1]
+		}
+
+		call := shortcodeCall{
+			Name:       name,
+			Args:       args,
+			Positional: positional,
+			Inner:      inner,
+			SourcePath: sourcePath,
+			assets:     assets,
+			settings:   settings,
+		}
+		output, err := renderShortcode(call, shortcodeTemplates)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: shortcode %q: %w", sourcePath, name, err)
+		}
+
+		if delimiter == "%" {
+			out.WriteString(output)
+		} else {
+			out.WriteString(shortcodePlaceholder(len(rendered)))
+			rendered = append(rendered, output)
+		}
+	}
+
+	return out.String(), rendered, nil
+}
+
+func renderShortcode(call shortcodeCall, shortcodeTemplates map[string]*template.Template) (string, error) {
+	if shortcodeTemplate, ok := shortcodeTemplates[call.Name]; ok {
+		shortcodeTemplate, err := shortcodeTemplate.Clone()
+		if err != nil {
+			return "", err
+		}
+		settings := call.settings
+		if settings == nil {
+			settings = &siteConfig{}
+		}
+		shortcodeTemplate.Funcs(siteFuncMap(settings, call.SourcePath))
+
+		var buf bytes.Buffer
+		err = shortcodeTemplate.Execute(&buf, call)
+		return buf.String(), err
+	}
+	if shortcode, ok := builtinShortcodes[call.Name]; ok {
+		return shortcode(call)
+	}
+	return "", fmt.Errorf("no shortcode template or built-in shortcode with this name exists")
+}
+
+func restoreShortcodes(html string, rendered []string) string {
+	for i := len(rendered) - 1; i >= 0; i-- {
+		placeholder := shortcodePlaceholder(i)
+		html = strings.ReplaceAll(html, "<p>"+placeholder+"</p>", rendered[i])
+		html = strings.ReplaceAll(html, placeholder, rendered[i])
+	}
+	return html
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+)
+
+func TestExpandShortcodes(t *testing.T) {
+	templates := map[string]*template.Template{
+		"note": template.Must(template.New("note").Parse(`<aside>{{ .Inner }}</aside>`)),
+		"bold": template.Must(template.New("bold").Parse(`**{{ .Arg "text" }}**`)),
+	}
+	tests := []struct {
+		name     string
+		source   string
+		want     string
+		rendered []string
+	}{
+		{
+			name:   "markdown shortcode",
+			source: `Say {{% bold text="hi" %}}.`,
+			want:   "Say **hi**.",
+		},
+		{
+			name:     "paired HTML shortcode",
+			source:   "{{< note >}}Careful{{< /note >}}",
+			want:     shortcodePlaceholder(0),
+			rendered: []string{"<aside>Careful</aside>"},
+		},
+		{
+			name:   "code span",
+			source: "Write `{{< note >}}` to add a note.",
+			want:   "Write `{{< note >}}` to add a note.",
+		},
+		{
+			name:   "double backtick code span",
+			source: "Use ``{{% bold text=\"`x`\" %}}`` here.",
+			want:   "Use ``{{% bold text=\"`x`\" %}}`` here.",
+		},
+		{
+			name:   "fenced code block",
+			source: "```markdown\n{{< note >}}Careful{{< /note >}}\n```\nAfter {{% bold text=\"b\" %}}\n",
+			want:   "```markdown\n{{< note >}}Careful{{< /note >}}\n```\nAfter **b**\n",
+		},
+		{
+			name:   "tilde fence left open",
+			source: "~~~\n{{% bold text=\"b\" %}}\n",
+			want:   "~~~\n{{% bold text=\"b\" %}}\n",
+		},
+		{
+			name:   "closing tag in code",
+			source: "{{< note >}}Close with `{{< /note >}}`.{{< /note >}}",
+			want:   shortcodePlaceholder(0),
+			rendered: []string{
+				"<aside>Close with `{{&lt; /note &gt;}}`.</aside>",
+			},
+		},
+		{
+			name:   "escaped shortcode",
+			source: `{{</* note */>}} and {{%/* bold text="x" */%}}`,
+			want:   `{{< note >}} and {{% bold text="x" %}}`,
+		},
+		{
+			name:   "escaped shortcode in a code span",
+			source: "`{{</* note */>}}`",
+			want:   "`{{< note >}}`",
+		},
+		{
+			name:   "unmatched backtick",
+			source: "A ` then {{% bold text=\"b\" %}}",
+			want:   "A ` then **b**",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, rendered, err := expandShortcodes(test.source, "content/page.md", templates, nil, &siteConfig{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			if len(rendered) != len(test.rendered) {
+				t.Fatalf("rendered %q, want %q", rendered, test.rendered)
+			}
+			for i := range rendered {
+				if rendered[i] != test.rendered[i] {
+					t.Errorf("rendered %q, want %q", rendered[i], test.rendered[i])
+				}
+			}
+		})
+	}
+}
+
+func TestShortcodeURLsUnderSubpath(t *testing.T) {
+	settings := decodeSiteConfig(map[string]interface{}{"baseURL": "https://user.github.io/myrepo/"})
+	templates := map[string]*template.Template{
+		"link": template.Must(template.New("link").Funcs(templateFuncMap()).Parse(
+			`<a href="{{ relURL (.Arg "to") }}">{{ absURL (.Arg "to") }}</a>`)),
+		"asset": template.Must(template.New("asset").Funcs(templateFuncMap()).Parse(
+			`{{ fingerprint "css/site.css" }}`)),
+	}
+
+	_, rendered, err := expandShortcodes(`{{< link to="/tags/" >}}`, "content/page.md", templates, nil, &settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<a href="/myrepo/tags/">https://user.github.io/myrepo/tags/</a>`; len(rendered) != 1 || rendered[0] != want {
+		t.Errorf("rendered %q, want %q", rendered, want)
+	}
+
+	// Rendering once must not keep the template from being bound again.
+	if _, rendered, err = expandShortcodes(`{{< link to="/" >}}`, "content/other.md", templates, nil, &settings); err != nil || rendered[0] != `<a href="/myrepo/">https://user.github.io/myrepo/</a>` {
+		t.Errorf("rendering again gave %q, %v", rendered, err)
+	}
+
+	if _, _, err := expandShortcodes(`{{< asset >}}`, "content/page.md", templates, nil, &settings); err == nil || !strings.Contains(err.Error(), "cannot be used in a shortcode") {
+		t.Errorf("fingerprint in a shortcode gave %v, want an error", err)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// robotsConfig generates robots.txt in place of the site's own: a group of
+// rules for each entry, followed by the location of the sitemap. Without
+// rules it allows every crawler everywhere.
+type robotsConfig struct {
+	Rules []robotsRule `yaml:"rules"`
+}
+
+type robotsRule struct {
+	UserAgents []string `yaml:"userAgents"`
+	Allow      []string `yaml:"allow"`
+	Disallow   []string `yaml:"disallow"`
+}
+
+// pageLastmod returns when a page last changed: its `lastmod` front matter,
+// or else its date, or else when its source file was modified.
+func pageLastmod(metaData map[string]interface{}, sourcePath string, date time.Time, location *time.Location) time.Time {
+	lastmod, err := parseFrontMatterDate(frontMatterValue(metaData, "lastmod"), location)
+	if err != nil {
+		log.Fatalf("%s: lastmod: %v\n", sourcePath, err)
+	}
+	if lastmod.IsZero() {
+		lastmod = date
+	}
+	if lastmod.IsZero() {
+		info, err := os.Stat(sourcePath)
+		check(err)
+		lastmod = info.ModTime().In(location)
+	}
+	return lastmod
+}
+
+// robotsRules returns the start of robots.txt: the rules in the
+// configuration when it has `robots`, and otherwise the site's own
+// robots.txt, if it has one.
+func (b *builder) robotsRules() string {
+	config := b.settings.Robots
+	if config == nil {
+		existing, err := os.ReadFile(outputDirectory + "/robots.txt")
+		if err != nil && !os.IsNotExist(err) {
+			check(err)
+		}
+		return string(existing)
+	}
+	if _, err := os.Stat(staticDirectory + "/robots.txt"); err == nil {
+		warnAt(staticDirectory+"/robots.txt", 0, "robots in the configuration replaces this file")
+	}
+
+	rules := config.Rules
+	if len(rules) == 0 {
+		rules = []robotsRule{{Disallow: []string{""}}}
+	}
+	var robots strings.Builder
+	for i, rule := range rules {
+		if i > 0 {
+			robots.WriteString("\n")
+		}
+		agents := rule.UserAgents
+		if len(agents) == 0 {
+			agents = []string{"*"}
+		}
+		for _, agent := range agents {
+			fmt.Fprintf(&robots, "User-agent: %s\n", agent)
+		}
+		for _, path := range rule.Allow {
+			fmt.Fprintf(&robots, "Allow: %s\n", path)
+		}
+		for _, path := range rule.Disallow {
+			fmt.Fprintf(&robots, "Disallow: %s\n", path)
+		}
+	}
+	return robots.String()
+}
+
+// sitemapURL returns the absolute URL of the sitemap, or "" if none is
+// written or it cannot be absolute.
+func (settings siteConfig) sitemapURL() string {
+	sitemap, ok := settings.outputs()["sitemap"]
+	if !ok || settings.BaseURL == "" {
+		return ""
+	}
+	return settings.siteURL(sitemap)
+}
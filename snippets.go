@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+// splitFrontMatter separates the YAML, TOML, or JSON front matter of text
+// from the rest.
+func splitFrontMatter(text string) (map[string]interface{}, string, error) {
+	format, source, rest := frontMatterBlock(text)
+	if format == "" {
+		return make(map[string]interface{}), text, nil
+	}
+	metaData, err := unmarshalFrontMatter(format, source)
+	if err != nil {
+		return nil, "", err
+	}
+	return metaData, rest, nil
+}
+
+// findSnippet returns the text of the named snippet and its default
+// parameters. Snippets are looked up in the `snippets` front matter of the
+// page at sourcePath, then in `snippets/name.md` and the theme's
+// `snippets/name.md`, whose own front matter holds the defaults.
+func findSnippet(name string, sourcePath string) (string, map[string]interface{}, error) {
+	if data, err := os.ReadFile(sourcePath); err == nil {
+		metaData, _, err := splitFrontMatter(string(data))
+		if err != nil {
+			return "", nil, err
+		}
+		if snippets, ok := frontMatterValue(metaData, "snippets").(map[string]interface{}); ok {
+			if text, ok := snippets[name].(string); ok {
+				return text, nil, nil
+			}
+		}
+	}
+
+	for _, directory := range []string{"snippets", themeDirectory + "/snippets"} {
+		data, err := os.ReadFile(filepath.Join(directory, filepath.FromSlash(name)+".md"))
+		if err != nil {
+			continue
+		}
+		defaults, text, err := splitFrontMatter(string(data))
+		return text, defaults, err
+	}
+	return "", nil, fmt.Errorf("no snippet %q exists", name)
+}
+
+// includeShortcode renders
+//
+//	{{% include "prerequisites" tool="Docker" %}}
+//
+// as the named snippet, a template that sees its arguments over its
+// defaults as fields and any wrapped text as .Inner.
+func includeShortcode(call shortcodeCall) (string, error) {
+	name := call.Arg("name")
+	if name == "" && len(call.Positional) > 0 {
+		name = call.Positional[0]
+	}
+	if name == "" {
+		return "", fmt.Errorf("missing snippet name")
+	}
+
+	text, defaults, err := findSnippet(name, call.SourcePath)
+	if err != nil {
+		return "", err
+	}
+
+	data := make(map[string]interface{})
+	for key, value := range defaults {
+		data[key] = value
+	}
+	for key, value := range call.Args {
+		data[key] = value
+	}
+	data["Inner"] = call.Inner
+
+	// Tokens are expanded with the rest of the page, so keep them intact.
+	text = tokenPattern.ReplaceAllString(text, `{{"{{$1}}"}}`)
+	snippetTemplate, err := texttemplate.New(name).Funcs(texttemplate.FuncMap(templateFuncMap())).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := snippetTemplate.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
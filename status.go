@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+)
+
+var pageStatuses = []string{"draft", "review", "published", "archived"}
+
+// pageStatus returns the workflow status of a page: its `status` front
+// matter, or draft for pages marked `draft: true` and published otherwise.
+func pageStatus(metaData map[string]interface{}, sourcePath string) string {
+	status := strings.ToLower(frontMatterString(metaData, "status"))
+	switch {
+	case status == "" && frontMatterValue(metaData, "draft") == true:
+		return "draft"
+	case status == "":
+		return "published"
+	}
+	for _, known := range pageStatuses {
+		if status == known {
+			return status
+		}
+	}
+	warnAt(sourcePath, sourceLine(sourcePath, "status:"), "unknown status %q; expected one of %s", status, strings.Join(pageStatuses, ", "))
+	return status
+}
+
+// buildsStatus reports whether pages with status are built in environment.
+// The statuses setting lists the statuses each environment builds; any
+// other environment only builds published pages.
+func (settings siteConfig) buildsStatus(environment string, status string) bool {
+	statuses, ok := settings.Statuses[environment]
+	if !ok {
+		statuses = []string{"published"}
+	}
+	for _, built := range statuses {
+		if strings.EqualFold(built, status) {
+			return true
+		}
+	}
+	return false
+}
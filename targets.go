@@ -0,0 +1,169 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// outputTarget receives the files of a finished build, named by their
+// slash-separated paths relative to the output directory.
+type outputTarget interface {
+	WriteFile(name string, data []byte) error
+	Close() error
+}
+
+type directoryTarget struct {
+	directory string
+}
+
+func (target *directoryTarget) WriteFile(name string, data []byte) error {
+	file := filepath.Join(target.directory, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(file), 0770); err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0666)
+}
+
+func (target *directoryTarget) Close() error {
+	return nil
+}
+
+type zipTarget struct {
+	file   *os.File
+	writer *zip.Writer
+}
+
+func (target *zipTarget) WriteFile(name string, data []byte) error {
+	writer, err := target.writer.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(data)
+	return err
+}
+
+func (target *zipTarget) Close() error {
+	if err := target.writer.Close(); err != nil {
+		return err
+	}
+	return target.file.Close()
+}
+
+type tarTarget struct {
+	file       *os.File
+	compressor *gzip.Writer
+	writer     *tar.Writer
+}
+
+func (target *tarTarget) WriteFile(name string, data []byte) error {
+	err := target.writer.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now(), Typeflag: tar.TypeReg})
+	if err != nil {
+		return err
+	}
+	_, err = target.writer.Write(data)
+	return err
+}
+
+func (target *tarTarget) Close() error {
+	if err := target.writer.Close(); err != nil {
+		return err
+	}
+	if target.compressor != nil {
+		if err := target.compressor.Close(); err != nil {
+			return err
+		}
+	}
+	return target.file.Close()
+}
+
+type s3Target struct {
+	s3 *s3Client
+}
+
+func (target *s3Target) WriteFile(name string, data []byte) error {
+	header := make(http.Header)
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return target.s3.PutObject(name, data, header)
+}
+
+func (target *s3Target) Close() error {
+	return nil
+}
+
+// newArchiveTarget writes a zip, tar, or gzipped tar archive to archivePath,
+// chosen by its extension.
+func newArchiveTarget(archivePath string) (outputTarget, error) {
+	lowered := strings.ToLower(archivePath)
+	if !strings.HasSuffix(lowered, ".zip") && !strings.HasSuffix(lowered, ".tar") && !strings.HasSuffix(lowered, ".tar.gz") && !strings.HasSuffix(lowered, ".tgz") {
+		return nil, fmt.Errorf("%s: archives must be .zip, .tar, .tar.gz, or .tgz files", archivePath)
+	}
+
+	file, err := os.Create(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(lowered, ".zip") {
+		return &zipTarget{file: file, writer: zip.NewWriter(file)}, nil
+	}
+
+	target := &tarTarget{file: file}
+	var writer io.Writer = file
+	if !strings.HasSuffix(lowered, ".tar") {
+		target.compressor = gzip.NewWriter(file)
+		writer = target.compressor
+	}
+	target.writer = tar.NewWriter(writer)
+	return target, nil
+}
+
+// newBundleTarget writes to an archive when location names one, and to a
+// directory otherwise.
+func newBundleTarget(location string) (outputTarget, error) {
+	lowered := strings.ToLower(location)
+	for _, extension := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(lowered, extension) {
+			return newArchiveTarget(location)
+		}
+	}
+	return &directoryTarget{directory: location}, nil
+}
+
+func newS3Target(location string) (outputTarget, error) {
+	s3, err := newS3Client(location)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Target{s3: s3}, nil
+}
+
+// publishOutput writes every file in directory to target.
+func publishOutput(directory string, target outputTarget) error {
+	var err error
+	walk(directory, func(fileName string) {
+		if err != nil {
+			return
+		}
+		var data []byte
+		data, err = os.ReadFile(fileName)
+		if err == nil {
+			err = target.WriteFile(strings.TrimPrefix(fileName, directory+"/"), data)
+		}
+	})
+	if err != nil {
+		target.Close()
+		return err
+	}
+	return target.Close()
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"io/fs"
+	"log"
+	"sort"
+	"strings"
+)
+
+// taxonomyConfig sets how the pages of a taxonomy's terms are generated:
+// where, with which layouts, and, in Data, which entry of .Site.Data holds
+// the params of its terms, the taxonomy's own by default.
+type taxonomyConfig struct {
+	Path         string `yaml:"path"`
+	Template     string `yaml:"template"`
+	ListTemplate string `yaml:"listTemplate"`
+	Data         string `yaml:"data"`
+}
+
+// taxonomies returns the names of the site's taxonomies: tags and
+// categories, then the others config.md defines, in alphabetical order.
+func (settings siteConfig) taxonomies() []string {
+	names := append([]string{}, taxonomyNames...)
+	var custom []string
+	for taxonomy := range settings.Taxonomies {
+		if taxonomy != "tags" && taxonomy != "categories" {
+			custom = append(custom, taxonomy)
+		}
+	}
+	sort.Strings(custom)
+	return append(names, custom...)
+}
+
+// pageTerms returns the terms of each taxonomy that the front matter gives
+// a page, by taxonomy.
+func (settings siteConfig) pageTerms(metaData map[string]interface{}) map[string][]string {
+	terms := make(map[string][]string)
+	for _, taxonomy := range settings.taxonomies() {
+		if values := frontMatterStrings(metaData, taxonomy); len(values) > 0 {
+			terms[taxonomy] = values
+		}
+	}
+	return terms
+}
+
+// taxonomyPath returns the directory of the output a taxonomy's pages are
+// written to: its path setting, or else its name.
+func (settings siteConfig) taxonomyPath(taxonomy string) string {
+	if path := strings.Trim(settings.Taxonomies[taxonomy].Path, "/"); path != "" {
+		return path
+	}
+	return taxonomy
+}
+
+// taxonomyTemplate returns the layout of a taxonomy's pages: the one its
+// config sets, or else the first of `<taxonomy>-<kind>.html` and
+// `<kind>.html` that exists, or "" if neither does.
+func (b *builder) taxonomyTemplate(taxonomy string, configured string, kind string) string {
+	if configured != "" {
+		return configured
+	}
+	for _, name := range []string{taxonomy + "-" + kind, kind} {
+		if _, ok := b.templates[name+".html"]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// termParams returns the params data gives the term of a taxonomy: the map
+// at the term's slug, or the term itself, in the data of the taxonomy, such
+// as data/speakers/ada-lovelace.yaml or the ada-lovelace entry of
+// data/speakers.yaml.
+func termParams(data map[string]interface{}, dataPath string, term string) map[string]interface{} {
+	var entries interface{} = data
+	for _, name := range strings.Split(strings.Trim(dataPath, "/"), "/") {
+		directory, ok := entries.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		entries = directory[name]
+	}
+	byTerm, ok := entries.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	for _, key := range []string{slugify(term), term} {
+		if params, ok := byTerm[key].(map[string]interface{}); ok {
+			return params
+		}
+	}
+	return nil
+}
+
+// termGroup is a term of a taxonomy, as the first page giving it spells
+// it, and the pages giving it in any spelling that shares its page.
+type termGroup struct {
+	term    string
+	members []*Page
+}
+
+// groupTerms groups the terms pages give a taxonomy by the slug naming
+// their page at path, and returns the groups with the slug of every
+// spelling. Spellings that differ only in case, such as Go and go, share a
+// page; the pages giving other terms that would share one, such as C and
+// C++, or terms that slug to nothing, fail.
+func groupTerms(pages []*Page, taxonomy string, path string) (map[string]*termGroup, map[string]string) {
+	groups := make(map[string]*termGroup)
+	spellings := make(map[string]string)
+	listed := make(map[string]map[*Page]bool)
+	for _, page := range pages {
+		if page.IsList {
+			continue
+		}
+		for _, term := range page.Terms[taxonomy] {
+			guardFile(func() {
+				slug := slugify(term)
+				if slug == "" {
+					failAt(page.SourcePath, 0, "the %s term %q has no letters or digits to name its page by", taxonomy, term)
+				}
+				group := groups[slug]
+				if group == nil {
+					group = &termGroup{term: term}
+					groups[slug] = group
+					listed[slug] = make(map[*Page]bool)
+				} else if !strings.EqualFold(group.term, term) {
+					failAt(page.SourcePath, 0, "the %s terms %q and %q would both have their page at %s/%s/", taxonomy, group.term, term, path, slug)
+				}
+				spellings[term] = slug
+				if !listed[slug][page] {
+					listed[slug][page] = true
+					group.members = append(group.members, page)
+				}
+			})
+		}
+	}
+	return groups, spellings
+}
+
+// generateTaxonomyPages builds a page for every term of each taxonomy in
+// the taxonomies setting, at `<path>/<term>/index.html`, listing the pages
+// with that term in any spelling that shares its page, and with a list template, an index of the terms at
+// `<path>/index.html`. Term pages take their params, and their title if it
+// has one, from the data of their term.
+func (b *builder) generateTaxonomyPages(pages []*Page, data map[string]interface{}) []*Page {
+	b.termPages = make(map[string]map[string]*Page)
+
+	for taxonomy, config := range b.settings.Taxonomies {
+		if taxonomy != "tags" && taxonomy != "categories" {
+			for _, key := range knownFrontMatterKeys {
+				if strings.EqualFold(taxonomy, key) {
+					log.Fatalf("%q cannot name a taxonomy; %s is a front matter key of its own.\n", taxonomy, key)
+				}
+			}
+		}
+		if b.taxonomyTemplate(taxonomy, config.Template, "term") == "" {
+			log.Fatalf("taxonomies.%s needs a template for the pages of its terms, or a %s-term.html or term.html layout.\n", taxonomy, taxonomy)
+		}
+		path := b.settings.taxonomyPath(taxonomy)
+		if !fs.ValidPath(path) || path == "." {
+			log.Fatalf("taxonomies.%s.path must be a directory within the output, not %q.\n", taxonomy, config.Path)
+		}
+		for other := range b.settings.Taxonomies {
+			otherPath := b.settings.taxonomyPath(other)
+			if other != taxonomy && (path == otherPath || strings.HasPrefix(path, otherPath+"/")) {
+				log.Fatalf("The pages of taxonomies.%s would be written among those of taxonomies.%s, at %s/.\n", taxonomy, other, otherPath)
+			}
+		}
+	}
+
+	var generated []*Page
+	for _, taxonomy := range b.settings.taxonomies() {
+		config, ok := b.settings.Taxonomies[taxonomy]
+		if !ok {
+			continue
+		}
+		path := b.settings.taxonomyPath(taxonomy)
+		directory := outputDirectory + "/" + path
+		dataPath := config.Data
+		if dataPath == "" {
+			dataPath = taxonomy
+		}
+
+		groups, spellings := groupTerms(pages, taxonomy, path)
+
+		template := b.taxonomyTemplate(taxonomy, config.Template, "term")
+		terms := make([]*Page, 0, len(groups))
+		bySlug := make(map[string]*Page, len(groups))
+		for slug, group := range groups {
+			sortPages(group.members)
+			params := make(map[string]interface{})
+			for key, value := range termParams(data, dataPath, group.term) {
+				params[key] = value
+			}
+			params["taxonomy"], params["term"], params["pages"] = taxonomy, group.term, group.members
+			title, _ := frontMatterValue(params, "title").(string)
+			if title == "" {
+				title = group.term
+			}
+			page := b.newGeneratedPage("config.md", directory+"/"+slug+"/index.html", template, title, params, "")
+			page.IsList = true
+			page.termMembers = group.members
+			terms = append(terms, page)
+			bySlug[slug] = page
+		}
+		b.termPages[taxonomy] = make(map[string]*Page, len(spellings))
+		for term, slug := range spellings {
+			b.termPages[taxonomy][term] = bySlug[slug]
+		}
+		sort.SliceStable(terms, func(i, j int) bool {
+			return strings.ToLower(terms[i].Title) < strings.ToLower(terms[j].Title)
+		})
+		generated = append(generated, terms...)
+
+		if listTemplate := b.taxonomyTemplate(taxonomy, config.ListTemplate, "terms"); listTemplate != "" {
+			params := map[string]interface{}{"taxonomy": taxonomy, "terms": terms}
+			title := strings.ToUpper(taxonomy[:1]) + taxonomy[1:]
+			list := b.newGeneratedPage("config.md", directory+"/index.html", listTemplate, title, params, "")
+			list.IsList = true
+			generated = append(generated, list)
+		}
+	}
+	return generated
+}
+
+// TermPage returns the generated page of a taxonomy term, in any of its
+// spellings, for linking to it:
+// `{{ with .Site.TermPage "tags" . }}{{ .RelPermalink }}{{ end }}`.
+func (site *Site) TermPage(taxonomy string, term string) *Page {
+	return site.termPages[taxonomy][term]
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"html/template"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestGenerateTaxonomyPagesGroupsTermsBySlug(t *testing.T) {
+	resetWarnings()
+	defer resetWarnings()
+
+	page := func(sourcePath string, tags ...string) *Page {
+		return &Page{SourcePath: sourcePath, Terms: map[string][]string{"tags": tags}}
+	}
+	a := page("content/a.md", "go", "C")
+	b := page("content/b.md", "Go", "go")
+	c := page("content/c.md", "C++")
+	d := page("content/d.md", "!!")
+
+	builder := &builder{
+		templates:       map[string]*template.Template{"term.html": nil},
+		markdownWriters: newMarkdownWriters(markdownConfig{}, nil),
+		settings:        siteConfig{Taxonomies: map[string]taxonomyConfig{"tags": {}}},
+	}
+	generated := builder.generateTaxonomyPages([]*Page{a, b, c, d}, nil)
+
+	var written []string
+	members := make(map[string][]string)
+	for _, termPage := range generated {
+		name := strings.TrimPrefix(termPage.OutputPath, outputDirectory+"/")
+		written = append(written, name)
+		for _, member := range termPage.Params["pages"].([]*Page) {
+			members[name] = append(members[name], member.SourcePath)
+		}
+		sort.Strings(members[name])
+	}
+	sort.Strings(written)
+	if got, want := strings.Join(written, " "), "tags/c/index.html tags/go/index.html"; got != want {
+		t.Errorf("term pages are %s, want %s", got, want)
+	}
+	if got, want := strings.Join(members["tags/go/index.html"], " "), "content/a.md content/b.md"; got != want {
+		t.Errorf("tags/go lists %s, want %s", got, want)
+	}
+	if got, want := strings.Join(members["tags/c/index.html"], " "), "content/a.md"; got != want {
+		t.Errorf("tags/c lists %s, want %s", got, want)
+	}
+	if goPage := builder.termPages["tags"]["Go"]; goPage == nil || goPage != builder.termPages["tags"]["go"] || goPage.Params["term"] != "go" {
+		t.Errorf("Go and go do not share the term page spelled go")
+	}
+
+	var failed []string
+	for _, warning := range loggedWarnings() {
+		if warning.failed {
+			failed = append(failed, warning.file+": "+warning.message)
+		}
+	}
+	want := []string{
+		`content/c.md: the tags terms "C" and "C++" would both have their page at tags/c/`,
+		`content/d.md: the tags term "!!" has no letters or digits to name its page by`,
+	}
+	if strings.Join(failed, "\n") != strings.Join(want, "\n") {
+		t.Errorf("failed files are\n%s\nwant\n%s", strings.Join(failed, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestTermPagesPaginateTheirPages(t *testing.T) {
+	chdir(t, t.TempDir())
+	writeFiles(t, map[string]string{
+		"config.md":                   "---\ntitle: Site\npaginate: 2\ntaxonomies:\n  tags: {}\n---\n",
+		"templates/layouts/page.html": "{{ .Title }}",
+		"templates/layouts/term.html": "{{ with .Paginator }}{{ range .Pages }}{{ .Title }} {{ end }}{{ .PageNumber }}/{{ .TotalPages }}{{ end }}",
+		"content/a.md":                "---\ntitle: A\ntemplate: page\ndate: 2024-01-03\ntags: [go]\n---\n",
+		"content/b.md":                "---\ntitle: B\ntemplate: page\ndate: 2024-01-02\ntags: [go]\n---\n",
+		"content/c.md":                "---\ntitle: C\ntemplate: page\ndate: 2024-01-01\ntags: [go]\n---\n",
+		"content/d.md":                "---\ntitle: D\ntemplate: page\ndate: 2024-01-04\n---\n",
+	})
+	buildCommand(loadProjectConfig(), []string{"-transpile-ts=false", "-nojekyll=false"}, false)
+
+	for name, want := range map[string]string{
+		"tags/go/index.html":        "A B 1/2",
+		"tags/go/page/2/index.html": "C 2/2",
+	} {
+		got, err := os.ReadFile(outputDirectory + "/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s is %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"html/template"
+	"path/filepath"
+	"text/template/parse"
+)
+
+// templateCache keeps the parse trees of the layouts and includes from one
+// build to the next, so that a rebuild with `-watch` parses only the files
+// that changed and a build parses every include once rather than once per
+// layout.
+type templateCache struct {
+	files map[string]parsedTemplateFile
+}
+
+// parsedTemplateFile is a template file as it was last parsed: its text,
+// and the trees of the templates it defines, by name.
+type parsedTemplateFile struct {
+	text  string
+	trees map[string]*parse.Tree
+}
+
+func newTemplateCache() *templateCache {
+	return &templateCache{files: make(map[string]parsedTemplateFile)}
+}
+
+// parse returns the parsed template files, given by path with their text,
+// parsing those whose text is not what it was when last parsed, and forgets
+// the files no longer given. Files that cannot be parsed are recorded for
+// checkErrors and left out. The trees are shared by every build, so they
+// are copied before html/template escapes them.
+func (cache *templateCache) parse(files map[string]string) map[string]parsedTemplateFile {
+	parsed := make(map[string]parsedTemplateFile, len(files))
+	for file, text := range files {
+		if previous, ok := cache.files[file]; ok && previous.text == text {
+			parsed[file] = previous
+			continue
+		}
+		guardFile(func() {
+			fileTemplate, err := template.New(filepath.Base(file)).Funcs(templateFuncMap()).Parse(text)
+			checkTemplateParse(templateSource(filepath.Base(file)), err)
+			trees := make(map[string]*parse.Tree)
+			for _, defined := range fileTemplate.Templates() {
+				if defined.Tree != nil {
+					trees[defined.Name()] = defined.Tree
+				}
+			}
+			parsed[file] = parsedTemplateFile{text: text, trees: trees}
+		})
+	}
+	cache.files = parsed
+	return parsed
+}
+
+// addTo adds copies of the templates file defines to set.
+func (file parsedTemplateFile) addTo(set *template.Template) error {
+	for name, tree := range file.trees {
+		if _, err := set.AddParseTree(name, tree.Copy()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
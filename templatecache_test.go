@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestTemplateParseErrorsFailTheirFile(t *testing.T) {
+	chdir(t, t.TempDir())
+	writeFiles(t, map[string]string{
+		"templates/layouts/page.html":     "<html>{{ template \"head.html\" . }}{{ .Body }}</html>",
+		"templates/layouts/broken.html":   "<html>\n{{ .Title </html>",
+		"templates/includes/head.html":    "<title>{{ .Title }}</title>",
+		"templates/shortcodes/note.html":  "<aside>{{ .Inner }</aside>",
+		"templates/outputs/rss.xml":       "<rss>\n\n{{ range }}</rss>",
+		"templates/shortcodes/quote.html": "<q>{{ .Inner }}</q>",
+	})
+	resetWarnings()
+	defer resetWarnings()
+
+	store := newArtifactStore("public-generator")
+	store.CopyDirectory("templates", "templates")
+	templates := generateTemplates(store, "templates", newTemplateCache())
+	shortcodes := generateShortcodeTemplates(store, "templates")
+	generateOutputTemplates(store, "templates")
+
+	if _, ok := templates["page.html"]; !ok {
+		t.Error("page.html was left out with broken.html")
+	}
+	if _, ok := templates["broken.html"]; ok {
+		t.Error("broken.html was kept")
+	}
+	if _, ok := shortcodes["quote"]; !ok {
+		t.Error("the quote shortcode was left out with note")
+	}
+
+	var failed []string
+	for _, warning := range loggedWarnings() {
+		if warning.failed {
+			failed = append(failed, fileError{file: warning.file, line: warning.line}.Error())
+		}
+	}
+	want := "templates/layouts/broken.html:2: templates/outputs/rss.xml:3: templates/shortcodes/note.html:1: "
+	sort.Strings(failed)
+	if got := strings.Join(failed, ""); got != want {
+		t.Errorf("failed files are %q, want %q", got, want)
+	}
+}
+
+func TestFailWarnings(t *testing.T) {
+	resetWarnings()
+	defer resetWarnings()
+	warnAt("content/a.md", 3, "an image has no alt text")
+	warnf("the site has no description")
+
+	failWarnings()
+	for _, warning := range loggedWarnings() {
+		if !warning.failed {
+			t.Errorf("the warning %q did not fail the build", warning.message)
+		}
+	}
+	if got, want := (fileError{message: "the site has no description"}).Error(), "the site has no description"; got != want {
+		t.Errorf("a failure of no file reads %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// themeParam describes one site parameter a theme reads.
+type themeParam struct {
+	Type        string      `yaml:"type"`
+	Required    bool        `yaml:"required"`
+	Default     interface{} `yaml:"default"`
+	Description string      `yaml:"description"`
+	Deprecated  string      `yaml:"deprecated"`
+}
+
+func paramTypeMatches(value interface{}, paramType string) bool {
+	switch paramType {
+	case "", "any":
+		return true
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "int":
+		_, ok := value.(int)
+		return ok
+	case "number":
+		switch value.(type) {
+		case int, float64:
+			return true
+		}
+		return false
+	case "bool":
+		_, ok := value.(bool)
+		return ok
+	case "list":
+		_, ok := value.([]interface{})
+		return ok
+	case "map":
+		_, ok := value.(map[string]interface{})
+		return ok
+	}
+	return false
+}
+
+// readThemeSchema reads the parameters the theme declares in
+// theme/params.yaml, or returns nil if it declares none.
+func readThemeSchema(schemaFile string) (map[string]themeParam, error) {
+	data, err := os.ReadFile(schemaFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var schema map[string]themeParam
+	if err := yaml.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("%s: %w", schemaFile, err)
+	}
+	return schema, nil
+}
+
+// applyThemeSchema checks config against the theme's parameters, filling in
+// the defaults of missing optional ones and warning about deprecated ones
+// that are set, and reports every missing or mistyped parameter at once.
+func applyThemeSchema(schema map[string]themeParam, config map[string]interface{}) error {
+	names := make([]string, 0, len(schema))
+	for name := range schema {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, name := range names {
+		param := schema[name]
+		switch param.Type {
+		case "", "any", "string", "int", "number", "bool", "list", "map":
+		default:
+			problems = append(problems, fmt.Sprintf("%s: unknown type %q", name, param.Type))
+			continue
+		}
+
+		value := frontMatterValue(config, name)
+		if value == nil {
+			switch {
+			case param.Required:
+				problem := fmt.Sprintf("%s is required", name)
+				if param.Description != "" {
+					problem += " (" + param.Description + ")"
+				}
+				problems = append(problems, problem)
+			case param.Default != nil:
+				config[name] = normalizeFrontMatter(param.Default)
+			}
+			continue
+		}
+		if !paramTypeMatches(value, param.Type) {
+			problems = append(problems, fmt.Sprintf("%s should be a %s, not %#v", name, param.Type, value))
+		}
+		if param.Deprecated != "" {
+			warnAt("config.md", sourceLine("config.md", name+":"), "%s is deprecated by the theme; %s", name, param.Deprecated)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("the theme's parameters in config.md are not valid:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"gopkg.in/yaml.v2"
+)
+
+// tocConfig controls the table of contents generated for a page: the
+// heading levels it covers, whether its entries and the headings themselves
+// are numbered, and the heading classes it is limited to or leaves out.
+type tocConfig struct {
+	StartLevel int      `yaml:"startLevel"`
+	Depth      int      `yaml:"depth"`
+	Numbered   bool     `yaml:"numbered"`
+	Include    []string `yaml:"include"`
+	Exclude    []string `yaml:"exclude"`
+}
+
+var defaultTOC = tocConfig{
+	StartLevel: 2,
+	Depth:      3,
+	Exclude:    []string{"no-toc"},
+}
+
+type tocEntry struct {
+	level  int
+	id     string
+	number string
+	text   string
+}
+
+// Heading is an entry of a page's table of contents: the heading's anchor,
+// its section number, its text, and the entries nested below it.
+type Heading struct {
+	ID       string     `json:"id"`
+	Number   string     `json:"number"`
+	Title    string     `json:"title"`
+	Level    int        `json:"level"`
+	Headings []*Heading `json:"headings,omitempty"`
+}
+
+// pageTOC returns the table of contents settings of a page: the site's
+// `toc` setting with the page's own `toc` front matter applied over it.
+func (b *builder) pageTOC(metaData map[string]interface{}, sourcePath string) tocConfig {
+	config := b.settings.TOC
+	if value := frontMatterValue(metaData, "toc"); value != nil {
+		data, err := yaml.Marshal(value)
+		check(err)
+		if err := yaml.UnmarshalStrict(data, &config); err != nil {
+			warnAt(sourcePath, sourceLine(sourcePath, "toc:"), "toc: %v; ignoring it", err)
+		}
+	}
+	return config
+}
+
+func (config tocConfig) includes(heading *ast.Heading) bool {
+	if heading.Level < config.StartLevel || heading.Level > config.Depth {
+		return false
+	}
+	var classes []string
+	if class, ok := heading.AttributeString("class"); ok {
+		if class, ok := class.([]byte); ok {
+			classes = strings.Fields(string(class))
+		}
+	}
+	for _, class := range classes {
+		for _, excluded := range config.Exclude {
+			if class == excluded {
+				return false
+			}
+		}
+	}
+	if len(config.Include) == 0 {
+		return true
+	}
+	for _, class := range classes {
+		for _, included := range config.Include {
+			if class == included {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// numberHeadings collects the headings of document that belong in the
+// table of contents, numbering them by their position among the headings
+// above them and, for numbered tables, prefixing the numbers to the
+// headings themselves.
+func numberHeadings(document ast.Node, source []byte, config tocConfig) []tocEntry {
+	var entries []tocEntry
+	var counters [7]int
+	ast.Walk(document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := node.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		if !config.includes(heading) {
+			return ast.WalkSkipChildren, nil
+		}
+
+		counters[heading.Level]++
+		for level := heading.Level + 1; level < len(counters); level++ {
+			counters[level] = 0
+		}
+		numbers := make([]string, 0, heading.Level)
+		for level := config.StartLevel; level <= heading.Level; level++ {
+			numbers = append(numbers, fmt.Sprint(counters[level]))
+		}
+
+		entry := tocEntry{
+			level:  heading.Level,
+			number: strings.Join(numbers, "."),
+			text:   string(heading.Text(source)),
+		}
+		if id, ok := heading.AttributeString("id"); ok {
+			if id, ok := id.([]byte); ok {
+				entry.id = string(id)
+			}
+		}
+		entries = append(entries, entry)
+
+		if config.Numbered {
+			number := ast.NewString([]byte(`<span class="section-number">` + entry.number + `</span> `))
+			number.SetCode(true)
+			heading.InsertBefore(heading, heading.FirstChild(), number)
+		}
+		return ast.WalkSkipChildren, nil
+	})
+	return entries
+}
+
+// headingTree nests entries below the closest preceding entry of a higher
+// level, as renderTOC does.
+func headingTree(entries []tocEntry) []*Heading {
+	var headings []*Heading
+	var open []*Heading
+	for _, entry := range entries {
+		heading := &Heading{ID: entry.id, Number: entry.number, Title: entry.text, Level: entry.level}
+		for len(open) > 0 && open[len(open)-1].Level >= entry.level {
+			open = open[:len(open)-1]
+		}
+		if len(open) == 0 {
+			headings = append(headings, heading)
+		} else {
+			parent := open[len(open)-1]
+			parent.Headings = append(parent.Headings, heading)
+		}
+		open = append(open, heading)
+	}
+	return headings
+}
+
+// renderTOC renders entries as nested ordered lists.
+func renderTOC(entries []tocEntry, config tocConfig) template.HTML {
+	if len(entries) == 0 {
+		return ""
+	}
+
+	var out strings.Builder
+	out.WriteString(`<nav class="toc">`)
+	var open []int
+	for _, entry := range entries {
+		for len(open) > 0 && open[len(open)-1] > entry.level {
+			out.WriteString("</li></ol>")
+			open = open[:len(open)-1]
+		}
+		if len(open) > 0 && open[len(open)-1] == entry.level {
+			out.WriteString("</li>")
+		} else {
+			out.WriteString("<ol>")
+			open = append(open, entry.level)
+		}
+
+		out.WriteString(`<li><a href="#` + html.EscapeString(entry.id) + `">`)
+		if config.Numbered {
+			out.WriteString(`<span class="section-number">` + entry.number + `</span> `)
+		}
+		out.WriteString(html.EscapeString(entry.text) + "</a>")
+	}
+	for range open {
+		out.WriteString("</li></ol>")
+	}
+	out.WriteString("</nav>")
+	return template.HTML(out.String())
+}
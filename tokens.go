@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var tokenPattern = regexp.MustCompile(`\{\{([A-Z][A-Z0-9_]*)\}\}`)
+
+var tokenExtensions = map[string]bool{
+	".css": true, ".csv": true, ".htm": true, ".html": true, ".js": true, ".json": true,
+	".mjs": true, ".svg": true, ".txt": true, ".webmanifest": true, ".xml": true,
+}
+
+// expandTokens replaces every `{{NAME}}` token in text with its value from
+// the `tokens` setting, in which `$VARIABLE` and `${VARIABLE}` expand to
+// environment variables. Unknown tokens are left as they are.
+func (settings siteConfig) expandTokens(text []byte) []byte {
+	if len(settings.Tokens) == 0 {
+		return text
+	}
+	return tokenPattern.ReplaceAllFunc(text, func(match []byte) []byte {
+		value, ok := settings.Tokens[string(match[2:len(match)-2])]
+		if !ok {
+			return match
+		}
+		return []byte(os.ExpandEnv(value))
+	})
+}
+
+// expandsTokens reports whether files copied to outputPath have their
+// tokens expanded: text files do, images and other binary files do not.
+func (settings siteConfig) expandsTokens(outputPath string) bool {
+	return len(settings.Tokens) > 0 && tokenExtensions[strings.ToLower(filepath.Ext(outputPath))]
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// transformConfig names the command that turns files of one extension
+// into files of another: it reads the file on stdin and writes the result
+// to stdout, such as `dot -Tsvg` for Graphviz diagrams.
+type transformConfig struct {
+	Command   string `yaml:"command"`
+	Extension string `yaml:"extension"`
+}
+
+// transformFor returns the transform configured for the extension of
+// filePath, if any.
+func (b *builder) transformFor(filePath string) (transformConfig, bool) {
+	extension := strings.ToLower(filepath.Ext(filePath))
+	for name, transform := range b.settings.Transforms {
+		if "."+strings.TrimPrefix(strings.ToLower(name), ".") == extension {
+			transform.Extension = "." + strings.TrimPrefix(transform.Extension, ".")
+			return transform, true
+		}
+	}
+	return transformConfig{}, false
+}
+
+// transformedPath is the path filePath is written to once transformed.
+func (transform transformConfig) transformedPath(filePath string) string {
+	return strings.TrimSuffix(filePath, filepath.Ext(filePath)) + transform.Extension
+}
+
+// run pipes the file at sourcePath through the transform's command, run
+// from the file's directory. Results are cached in the user cache
+// directory by command and file content, so unchanged files are not
+// transformed again on the next build.
+func (transform transformConfig) run(sourcePath string) ([]byte, error) {
+	input, err := os.ReadFile(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(append([]byte(transform.Command+"\x00"), input...))
+	cachePath := ""
+	if cacheDirectory, err := os.UserCacheDir(); err == nil {
+		cachePath = filepath.Join(cacheDirectory, "grafe", "transforms", hex.EncodeToString(sum[:])+transform.Extension)
+		if output, err := os.ReadFile(cachePath); err == nil {
+			return output, nil
+		}
+	}
+
+	var output, errors bytes.Buffer
+	command := exec.Command("sh", "-c", transform.Command)
+	command.Dir = filepath.Dir(sourcePath)
+	command.Stdin = bytes.NewReader(input)
+	command.Stdout = &output
+	command.Stderr = &errors
+	if err := command.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %s: %v\n%s", sourcePath, transform.Command, err, errors.String())
+	}
+
+	if cachePath != "" {
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0770); err == nil {
+			os.WriteFile(cachePath, output.Bytes(), 0660)
+		}
+	}
+	return output.Bytes(), nil
+}
+
+// readContentFile reads a content file, transforming it first when its
+// extension has a transform to Markdown, with its front matter as YAML.
+func (b *builder) readContentFile(sourcePath string) ([]byte, error) {
+	var data []byte
+	var err error
+	if transform, ok := b.transformFor(sourcePath); ok && transform.Extension == ".md" {
+		data, err = transform.run(sourcePath)
+	} else {
+		data, err = os.ReadFile(sourcePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err = yamlFrontMatter(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", sourcePath, err)
+	}
+	return data, nil
+}
+
+// isContentFile reports whether the file at filePath is a page: a Markdown
+// file, or one that is transformed to Markdown.
+func (b *builder) isContentFile(filePath string) bool {
+	if getExtension(filePath) == ".md" {
+		return true
+	}
+	transform, ok := b.transformFor(filePath)
+	return ok && transform.Extension == ".md"
+}
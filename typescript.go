@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/clarkmcc/go-typescript"
+	"github.com/dop251/goja"
+)
+
+const tsconfigFile = "tsconfig.json"
+
+// typescriptCompilerScript reads the compiler options of a tsconfig.json,
+// comments and all, and returns them, as JSON, with a function transpiling
+// a file with them. Source maps get the TypeScript they map to inlined,
+// since no .ts file is published.
+const typescriptCompilerScript = `(function (configText) {
+	var message = function (diagnostic) {
+		return ts.flattenDiagnosticMessageText(diagnostic.messageText, "\n");
+	};
+	var compilerOptions = {};
+	var configured = {};
+	if (configText !== null) {
+		var parsed = ts.parseConfigFileTextToJson("tsconfig.json", configText);
+		if (parsed.error) {
+			throw new Error(message(parsed.error));
+		}
+		configured = (parsed.config || {}).compilerOptions || {};
+		var converted = ts.convertCompilerOptionsFromJson(configured, ".");
+		if (converted.errors.length > 0) {
+			throw new Error(converted.errors.map(message).join("\n"));
+		}
+		compilerOptions = converted.options;
+	}
+	if ((compilerOptions.sourceMap || compilerOptions.inlineSourceMap) && compilerOptions.inlineSources === undefined) {
+		compilerOptions.inlineSources = true;
+	}
+	return {
+		options: JSON.stringify(configured),
+		transpile: function (source, fileName) {
+			var result = ts.transpileModule(source, {compilerOptions: compilerOptions, fileName: fileName, reportDiagnostics: true});
+			return JSON.stringify({
+				output: result.outputText,
+				sourceMap: result.sourceMapText || "",
+				diagnostics: (result.diagnostics || []).map(function (diagnostic) {
+					var line = 0;
+					if (diagnostic.file && diagnostic.start !== undefined) {
+						line = diagnostic.file.getLineAndCharacterOfPosition(diagnostic.start).line + 1;
+					}
+					return {line: line, message: message(diagnostic)};
+				})
+			});
+		}
+	};
+})`
+
+// tsconfigOptions are the compiler options of tsconfig.json that grafē
+// follows itself rather than leaving to the compiler: the import paths
+// `paths` maps, relative to baseUrl.
+type tsconfigOptions struct {
+	BaseURL string              `json:"baseUrl"`
+	Paths   map[string][]string `json:"paths"`
+}
+
+type transpiledTypescript struct {
+	Output      string                 `json:"output"`
+	SourceMap   string                 `json:"sourceMap"`
+	Diagnostics []typescriptDiagnostic `json:"diagnostics"`
+}
+
+type typescriptDiagnostic struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// typescriptCompiler transpiles TypeScript with the compiler options of the
+// site's tsconfig.json, loading the compiler once for every file.
+type typescriptCompiler struct {
+	runtime   *goja.Runtime
+	transpile goja.Callable
+	options   tsconfigOptions
+}
+
+func newTypescriptCompiler() *typescriptCompiler {
+	var configText interface{}
+	if data, err := os.ReadFile(tsconfigFile); err == nil {
+		configText = string(data)
+	} else if !os.IsNotExist(err) {
+		check(err)
+	}
+
+	config := typescript.NewDefaultConfig()
+	runtime := config.Runtime
+	_, err := runtime.RunProgram(config.TypescriptSource)
+	check(err)
+	setup, err := runtime.RunString(typescriptCompilerScript)
+	check(err)
+	setupFunction, _ := goja.AssertFunction(setup)
+	compiler, err := setupFunction(goja.Undefined(), runtime.ToValue(configText))
+	if exception, ok := err.(*goja.Exception); ok {
+		log.Fatalf("%s: %s\n", tsconfigFile, exception.Value().ToObject(runtime).Get("message"))
+	}
+	check(err)
+
+	object := compiler.ToObject(runtime)
+	transpile, _ := goja.AssertFunction(object.Get("transpile"))
+	var options tsconfigOptions
+	check(json.Unmarshal([]byte(object.Get("options").String()), &options))
+	return &typescriptCompiler{runtime: runtime, transpile: transpile, options: options}
+}
+
+// transpileTypescript transpiles the TypeScript copied to directory into
+// JavaScript beside it, with source maps if tsconfig.json asks for them,
+// then removes every .ts file.
+func transpileTypescript(directory string) {
+	var files []string
+	walk(directory, func(fileName string) {
+		if getExtension(fileName) == ".ts" && !strings.HasSuffix(fileName, ".d.ts") {
+			files = append(files, fileName)
+		}
+	})
+	if len(files) == 0 {
+		return
+	}
+
+	compiler := newTypescriptCompiler()
+	for _, fileName := range files {
+		guardFile(func() {
+			compiler.transpileTypescriptFile(fileName, changeExtension(fileName, ".js"))
+		})
+	}
+	walk(directory, func(fileName string) {
+		if getExtension(fileName) == ".ts" {
+			check(os.Remove(fileName))
+		}
+	})
+}
+
+// transpileTypescriptFile transpiles the TypeScript at tsFilePath to
+// jsOutputPath. Syntax errors fail the file, at the line of the first.
+func (compiler *typescriptCompiler) transpileTypescriptFile(tsFilePath string, jsOutputPath string) {
+	tsCode, err := os.ReadFile(tsFilePath)
+	check(err)
+
+	value, err := compiler.transpile(goja.Undefined(), compiler.runtime.ToValue(string(tsCode)), compiler.runtime.ToValue(filepath.Base(tsFilePath)))
+	check(err)
+	var transpiled transpiledTypescript
+	check(json.Unmarshal([]byte(value.String()), &transpiled))
+	if len(transpiled.Diagnostics) > 0 {
+		first := transpiled.Diagnostics[0]
+		messages := []string{first.Message}
+		for _, diagnostic := range transpiled.Diagnostics[1:] {
+			if diagnostic != first {
+				messages = append(messages, fmt.Sprintf("line %d: %s", diagnostic.Line, diagnostic.Message))
+			}
+		}
+		failAt(staticSource(tsFilePath), first.Line, "%s", strings.Join(messages, "\n    "))
+	}
+
+	output := compiler.options.rewriteImportPaths(strings.TrimSuffix(transpiled.Output, "\r\n"), jsOutputPath)
+	check(os.WriteFile(jsOutputPath, []byte(output), 0666))
+	recordOutput(jsOutputPath)
+	if transpiled.SourceMap != "" {
+		check(os.WriteFile(jsOutputPath+".map", []byte(transpiled.SourceMap), 0666))
+		recordOutput(jsOutputPath + ".map")
+	}
+}
+
+// importSpecifierPattern matches the module specifiers of import and export
+// declarations and of dynamic imports.
+var importSpecifierPattern = regexp.MustCompile(`(\b(?:from|import)\s*\(?\s*)(["'])([^"'\n]+)(["'])`)
+
+// rewriteImportPaths replaces the import specifiers of the script at
+// jsOutputPath that `paths` maps with relative URLs of the files they map
+// to, which browsers, unlike the TypeScript compiler, cannot resolve
+// themselves. Specifiers that map to no file of static/ or theme/static/
+// are left as they are.
+func (options tsconfigOptions) rewriteImportPaths(script string, jsOutputPath string) string {
+	if len(options.Paths) == 0 {
+		return script
+	}
+	return importSpecifierPattern.ReplaceAllStringFunc(script, func(match string) string {
+		parts := importSpecifierPattern.FindStringSubmatch(match)
+		target, ok := options.resolve(parts[3])
+		if !ok {
+			return match
+		}
+		relative, err := filepath.Rel(filepath.Dir(jsOutputPath), target)
+		if err != nil {
+			return match
+		}
+		relative = filepath.ToSlash(relative)
+		if !strings.HasPrefix(relative, ".") {
+			relative = "./" + relative
+		}
+		return parts[1] + parts[2] + relative + parts[4]
+	})
+}
+
+// resolve returns where the file that specifier maps to is published: the
+// first target of the longest pattern of `paths` matching it that is a
+// file of static/ or theme/static/, with a .ts file published as .js.
+func (options tsconfigOptions) resolve(specifier string) (string, bool) {
+	pattern, wildcard := "", ""
+	matched := false
+	for candidate := range options.Paths {
+		prefix, suffix, hasWildcard := strings.Cut(candidate, "*")
+		switch {
+		case !hasWildcard && candidate == specifier:
+		case hasWildcard && strings.HasPrefix(specifier, prefix) && strings.HasSuffix(specifier, suffix) && len(specifier) >= len(prefix)+len(suffix):
+		default:
+			continue
+		}
+		if !matched || len(candidate) > len(pattern) {
+			pattern, matched = candidate, true
+			wildcard = ""
+			if hasWildcard {
+				wildcard = specifier[len(prefix) : len(specifier)-len(suffix)]
+			}
+		}
+	}
+	if !matched {
+		return "", false
+	}
+
+	for _, target := range options.Paths[pattern] {
+		target = path.Join(options.BaseURL, strings.Replace(target, "*", wildcard, 1))
+		for _, candidate := range []string{target, target + ".ts", target + ".js", target + "/index.ts", target + "/index.js"} {
+			info, err := os.Stat(candidate)
+			if err != nil || info.IsDir() {
+				continue
+			}
+			for _, directory := range []string{staticDirectory, themeDirectory + "/static"} {
+				if strings.HasPrefix(candidate, directory+"/") {
+					published := outputDirectory + strings.TrimPrefix(candidate, directory)
+					if getExtension(published) == ".ts" {
+						published = changeExtension(published, ".js")
+					}
+					return published, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// staticSource is the file of the site or theme that the file at
+// outputPath was copied from, which errors compiling it are reported at.
+func staticSource(outputPath string) string {
+	name := strings.TrimPrefix(outputPath, outputDirectory)
+	if fileExists(staticDirectory + name) {
+		return staticDirectory + name
+	}
+	return themeDirectory + "/static" + name
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// warcWriter writes WARC 1.1 records, each compressed as a gzip member of
+// its own when the archive is a .warc.gz, as archiving tools expect.
+type warcWriter struct {
+	out      io.Writer
+	compress bool
+	date     string
+}
+
+func warcRecordID() string {
+	var id [16]byte
+	_, err := rand.Read(id[:])
+	check(err)
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
+
+func warcDigest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// record writes a record of recordType with the extra headers and block.
+func (w *warcWriter) record(recordType string, headers [][2]string, block []byte) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "WARC/1.1\r\nWARC-Type: %s\r\nWARC-Record-ID: %s\r\nWARC-Date: %s\r\n", recordType, warcRecordID(), w.date)
+	for _, header := range headers {
+		fmt.Fprintf(&buf, "%s: %s\r\n", header[0], header[1])
+	}
+	fmt.Fprintf(&buf, "WARC-Block-Digest: %s\r\nContent-Length: %d\r\n\r\n", warcDigest(block), len(block))
+	buf.Write(block)
+	buf.WriteString("\r\n\r\n")
+
+	if !w.compress {
+		_, err := w.out.Write(buf.Bytes())
+		return err
+	}
+	member := gzip.NewWriter(w.out)
+	if _, err := member.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return member.Close()
+}
+
+// exportWARC writes every file of the built site to a WARC archive as the
+// response it is served with from its URL under the base URL, so the site
+// can be kept as it was published on the day. It returns how many files
+// were archived.
+func exportWARC(archive string, settings siteConfig, now time.Time) (int, error) {
+	file, err := os.Create(archive)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	writer := &warcWriter{
+		out:      file,
+		compress: strings.HasSuffix(archive, ".gz"),
+		date:     now.UTC().Format(time.RFC3339),
+	}
+
+	info := fmt.Sprintf("software: grafe\r\nformat: WARC File Format 1.1\r\nisPartOf: %s\r\n", settings.siteURL("/"))
+	err = writer.record("warcinfo", [][2]string{
+		{"WARC-Filename", path.Base(archive)},
+		{"Content-Type", "application/warc-fields"},
+	}, []byte(info))
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	walk(outputDirectory, func(fileName string) {
+		if err != nil {
+			return
+		}
+		var body []byte
+		body, err = os.ReadFile(fileName)
+		if err != nil {
+			return
+		}
+		contentType := mime.TypeByExtension(path.Ext(fileName))
+		if contentType == "" {
+			contentType = http.DetectContentType(body)
+		}
+
+		var response bytes.Buffer
+		fmt.Fprintf(&response, "HTTP/1.1 200 OK\r\nContent-Type: %s\r\nContent-Length: %d\r\nDate: %s\r\n\r\n", contentType, len(body), now.UTC().Format(http.TimeFormat))
+		response.Write(body)
+		err = writer.record("response", [][2]string{
+			{"WARC-Target-URI", settings.siteURL(settings.pageURL(fileName))},
+			{"WARC-Payload-Digest", warcDigest(body)},
+			{"Content-Type", "application/http;msgtype=response"},
+		}, response.Bytes())
+		count++
+	})
+	return count, err
+}
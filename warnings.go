@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/yuin/goldmark/ast"
+	"go.abhg.dev/goldmark/wikilink"
+)
+
+// warnings holds the warnings logged during the build, so that `-strict`
+// can fail it and CI can be told about them.
+var warnings struct {
+	sync.Mutex
+	logged []buildWarning
+}
+
+var knownFrontMatterKeys = []string{
+	"title", "summary", "date", "template", "draft", "params", "tags", "categories",
+	"noindex", "nofollow", "sitemap", "cover", "event", "search", "searchBoost",
+	"toc", "scripts", "styles", "snippets", "owner", "reviewBy", "status",
+	"noai", "license", "lastmod", "paginate", "discussion", "slug", "url",
+}
+
+// warnf logs a problem that does not stop the build unless it is strict.
+func warnf(format string, args ...interface{}) {
+	warnAt("", 0, format, args...)
+}
+
+// warnAt logs a problem with line of the file at sourcePath, or with the
+// whole file if line is 0.
+func warnAt(sourcePath string, line int, format string, args ...interface{}) {
+	warning := buildWarning{file: sourcePath, line: line, message: fmt.Sprintf(format, args...)}
+	warnings.Lock()
+	warnings.logged = append(warnings.logged, warning)
+	warnings.Unlock()
+
+	switch {
+	case line > 0:
+		log.Printf("%s:%d: %s\n", sourcePath, line, warning.message)
+	case sourcePath != "":
+		log.Printf("%s: %s\n", sourcePath, warning.message)
+	default:
+		log.Printf("%s\n", warning.message)
+	}
+}
+
+func loggedWarnings() []buildWarning {
+	warnings.Lock()
+	defer warnings.Unlock()
+	return append([]buildWarning(nil), warnings.logged...)
+}
+
+// resetWarnings forgets the warnings of a previous build.
+func resetWarnings() {
+	warnings.Lock()
+	warnings.logged = nil
+	warnings.Unlock()
+}
+
+// failWarnings makes every warning the build logged fail the file it is
+// about, for a strict build, so that checkErrors reports them.
+func failWarnings() {
+	warnings.Lock()
+	defer warnings.Unlock()
+	count := 0
+	for i := range warnings.logged {
+		if !warnings.logged[i].failed {
+			warnings.logged[i].failed = true
+			count++
+		}
+	}
+	if count > 0 {
+		log.Printf("The build logged %d warnings and -strict is set.\n", count)
+	}
+}
+
+// fileError is a problem with a file that keeps it out of the build, such
+// as a page whose front matter or template cannot be read. The build goes
+// on with the other files and fails at the end, so one typo does not hide
+// the other problems.
+type fileError struct {
+	file    string
+	line    int
+	message string
+}
+
+func (err fileError) Error() string {
+	if err.file == "" {
+		return err.message
+	}
+	if err.line > 0 {
+		return fmt.Sprintf("%s:%d: %s", err.file, err.line, err.message)
+	}
+	return fmt.Sprintf("%s: %s", err.file, err.message)
+}
+
+// failAt gives up on the file at sourcePath, for the guardFile around the
+// work on it to record.
+func failAt(sourcePath string, line int, format string, args ...interface{}) {
+	panic(fileError{file: sourcePath, line: line, message: fmt.Sprintf(format, args...)})
+}
+
+// checkFile gives up on the file at sourcePath if err is not nil. Errors
+// executing a template are reported on the template's line.
+func checkFile(sourcePath string, err error) {
+	if err == nil {
+		return
+	}
+	if template, line, message, ok := templateErrorLine(err); ok {
+		failAt(template, line, "%s: %s", sourcePath, message)
+	}
+	failAt(sourcePath, 0, "%v", err)
+}
+
+// checkTemplateParse gives up on the template file at sourcePath if err,
+// from parsing it, is not nil, at the line it is about.
+func checkTemplateParse(sourcePath string, err error) {
+	if err == nil {
+		return
+	}
+	if _, line, message, ok := templateErrorLine(err); ok {
+		failAt(sourcePath, line, "%s", message)
+	}
+	failAt(sourcePath, 0, "%v", err)
+}
+
+var templateErrorPattern = regexp.MustCompile(`^template: ([^:]+):(\d+):(?:\d+:)? (.*)$`)
+
+// templateErrorLine finds the template file and line a template error is
+// about.
+func templateErrorLine(err error) (string, int, string, bool) {
+	match := templateErrorPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return "", 0, "", false
+	}
+	line, _ := strconv.Atoi(match[2])
+	return templateSource(match[1]), line, match[3], true
+}
+
+// templateSource returns the file the template name was read from: the
+// site's own, or else the theme's.
+func templateSource(name string) string {
+	for _, directory := range []string{"templates", themeDirectory + "/templates"} {
+		for _, kind := range []string{"layouts", "includes", "shortcodes", "outputs"} {
+			if file := directory + "/" + kind + "/" + name; fileExists(file) {
+				return file
+			}
+		}
+	}
+	return name
+}
+
+// guardFile runs fn, recording the fileError it gives up with, and reports
+// whether it finished.
+func guardFile(fn func()) bool {
+	return guardFileError(fn) == nil
+}
+
+// guardFileError is guardFile returning the fileError fn gave up with.
+func guardFileError(fn func()) (failure error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err, isFileError := recovered.(fileError)
+			if !isFileError {
+				panic(recovered)
+			}
+			warnings.Lock()
+			warnings.logged = append(warnings.logged, buildWarning{file: err.file, line: err.line, message: err.message, failed: true})
+			warnings.Unlock()
+			log.Printf("error: %v\n", err)
+			failure = err
+		}
+	}()
+	fn()
+	return nil
+}
+
+// checkErrors lists every file the build failed on and exits, unless
+// keepGoing, as a server rebuilding on changes does.
+func checkErrors(keepGoing bool) {
+	var failed []buildWarning
+	for _, warning := range loggedWarnings() {
+		if warning.failed {
+			failed = append(failed, warning)
+		}
+	}
+	if len(failed) == 0 {
+		return
+	}
+	log.Printf("The build failed on %d files:\n", len(failed))
+	for _, warning := range failed {
+		fmt.Fprintln(os.Stderr, "  "+fileError{file: warning.file, line: warning.line, message: warning.message}.Error())
+	}
+	if !keepGoing {
+		os.Exit(1)
+	}
+}
+
+// warnUnknownFrontMatter warns about the keys of metaData that are neither
+// front matter grafē reads nor one of taxonomies.
+func warnUnknownFrontMatter(metaData map[string]interface{}, sourcePath string, taxonomies []string) {
+	for key := range metaData {
+		known := false
+		for _, knownKey := range append(knownFrontMatterKeys, taxonomies...) {
+			if strings.EqualFold(key, knownKey) {
+				known = true
+			}
+		}
+		if !known {
+			warnAt(sourcePath, sourceLine(sourcePath, key+":"), "unknown front matter key %q; custom values belong under params", key)
+		}
+	}
+}
+
+// checkPageLinks warns about the images of page without alt text and the
+// wikilinks of page that point at no page or file of the site, or at
+// several pages, returning the wikilink problems.
+func (b *builder) checkPageLinks(page *Page) []wikilinkProblem {
+	var problems []wikilinkProblem
+	ast.Walk(page.document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := node.(type) {
+		case *ast.Image:
+			if strings.TrimSpace(string(node.Text(page.source))) == "" {
+				warnAt(page.SourcePath, sourceLine(page.SourcePath, "("+string(node.Destination)), "image %s has no alt text", node.Destination)
+			}
+		case *wikilink.Node:
+			problems = append(problems, b.checkWikilink(page, node)...)
+		}
+		return ast.WalkContinue, nil
+	})
+	return problems
+}
+
+// checkWikilink reports whether the wikilink node on page resolves, and
+// whether the heading its fragment names exists on the page it links to.
+func (b *builder) checkWikilink(page *Page, node *wikilink.Node) []wikilinkProblem {
+	problem := wikilinkProblem{
+		Source:   page.SourcePath,
+		Target:   string(node.Target),
+		Fragment: string(node.Fragment),
+		Text:     string(node.Text(page.source)),
+	}
+	link := problem.Target
+	if problem.Fragment != "" {
+		link += "#" + problem.Fragment
+	}
+
+	var problems []wikilinkProblem
+	url := page.RelPermalink
+	if problem.Target != "" {
+		var candidates []string
+		var ok bool
+		url, candidates, ok = b.wikilinks.resolve(problem.Target)
+		switch {
+		case !ok || !b.wikilinkFileExists(problem.Target):
+			problem.Problem = "unresolved"
+			warnAt(page.SourcePath, sourceLine(page.SourcePath, "[["+link), "wikilink [[%s]] does not resolve to a page or file", link)
+			return []wikilinkProblem{problem}
+		case len(candidates) > 1:
+			ambiguous := problem
+			ambiguous.Problem = "ambiguous"
+			ambiguous.Candidates = candidates
+			warnAt(page.SourcePath, sourceLine(page.SourcePath, "[["+link), "wikilink [[%s]] matches %s; linking to the first", link, strings.Join(candidates, ", "))
+			problems = append(problems, ambiguous)
+		}
+	}
+
+	if problem.Fragment != "" && path.Ext(problem.Target) == "" {
+		if _, ok := b.wikilinks.headingID(url, problem.Fragment); !ok {
+			problem.Problem = "missing heading"
+			warnAt(page.SourcePath, sourceLine(page.SourcePath, "[["+link), "wikilink [[%s]] links to a heading that %s does not have", link, url)
+			problems = append(problems, problem)
+		}
+	}
+	return problems
+}
+
+// wikilinkFileExists reports whether a wikilink target with an extension
+// is a file in the content or static directories. Other targets are pages.
+func (b *builder) wikilinkFileExists(target string) bool {
+	if path.Ext(target) == "" {
+		return true
+	}
+	for _, directory := range []string{contentDirectory, staticDirectory, themeDirectory + "/static"} {
+		if _, err := os.Stat(filepath.Join(directory, filepath.FromSlash(strings.TrimPrefix(target, "/")))); err == nil {
+			return true
+		}
+	}
+	return false
+}
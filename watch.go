@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/net/websocket"
+)
+
+const reloadPath = "/__grafe/reload"
+
+// reloadScript connects the page to the development server's reload
+// socket and reloads it whenever the site has been rebuilt.
+const reloadScript = `<script>
+(function () {
+	var socket = new WebSocket((location.protocol === "https:" ? "wss://" : "ws://") + location.host + "` + reloadPath + `");
+	socket.onmessage = function () { location.reload(); };
+})();
+</script>
+`
+
+// reloadHub tells every connected browser to reload.
+type reloadHub struct {
+	mutex   sync.Mutex
+	clients map[chan struct{}]bool
+}
+
+func newReloadHub() *reloadHub {
+	return &reloadHub{clients: make(map[chan struct{}]bool)}
+}
+
+func (hub *reloadHub) reload() {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	for client := range hub.clients {
+		select {
+		case client <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (hub *reloadHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	websocket.Handler(func(socket *websocket.Conn) {
+		client := make(chan struct{}, 1)
+		hub.mutex.Lock()
+		hub.clients[client] = true
+		hub.mutex.Unlock()
+		defer func() {
+			hub.mutex.Lock()
+			delete(hub.clients, client)
+			hub.mutex.Unlock()
+		}()
+
+		closed := make(chan struct{})
+		go func() {
+			var message string
+			for websocket.Message.Receive(socket, &message) == nil {
+			}
+			close(closed)
+		}()
+
+		for {
+			select {
+			case <-client:
+				if websocket.Message.Send(socket, "reload") != nil {
+					return
+				}
+			case <-closed:
+				return
+			}
+		}
+	}).ServeHTTP(w, r)
+}
+
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *bufferedResponseWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+// injectReloadScript adds the reload script to the end of every HTML page
+// the server sends.
+func injectReloadScript(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del("Range")
+		r.Header.Del("If-Modified-Since")
+		r.Header.Del("If-None-Match")
+
+		buffered := &bufferedResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(buffered, r)
+
+		body := buffered.body.Bytes()
+		if strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+			if end := bytes.LastIndex(body, []byte("</body>")); end >= 0 {
+				body = append(body[:end:end], append([]byte(reloadScript), body[end:]...)...)
+			} else {
+				body = append(body, reloadScript...)
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		}
+		w.WriteHeader(buffered.status)
+		w.Write(body)
+	})
+}
+
+// watchSite calls rebuild after files in any of directories, or the site
+// configuration, change; changes within a short time of each other cause a
+// single rebuild. It does not return.
+func watchSite(directories []string, rebuild func()) {
+	watcher, err := fsnotify.NewWatcher()
+	check(err)
+	defer watcher.Close()
+
+	watchTree := func(directory string) {
+		err := filepath.WalkDir(directory, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				return watcher.Add(path)
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Could not watch %s: %v\n", directory, err)
+		}
+	}
+	for _, directory := range directories {
+		watchTree(directory)
+	}
+	check(watcher.Add("."))
+
+	var building sync.Mutex
+	var timer *time.Timer
+	for {
+		select {
+		case event := <-watcher.Events:
+			name := filepath.ToSlash(filepath.Clean(event.Name))
+			if !strings.Contains(name, "/") && name != "config.md" && name != tsconfigFile && !isWatchedDirectory(name, directories) {
+				continue
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					watchTree(event.Name)
+				}
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.AfterFunc(100*time.Millisecond, func() {
+				building.Lock()
+				defer building.Unlock()
+				log.Printf("%s changed; rebuilding\n", name)
+				rebuild()
+			})
+		case err := <-watcher.Errors:
+			log.Printf("Error watching files: %v\n", err)
+		}
+	}
+}
+
+func isWatchedDirectory(name string, directories []string) bool {
+	for _, directory := range directories {
+		if filepath.ToSlash(filepath.Clean(directory)) == name {
+			return true
+		}
+	}
+	return false
+}
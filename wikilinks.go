@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"go.abhg.dev/goldmark/wikilink"
+)
+
+// wikilinksConfig controls how wikilink targets are matched to pages: by
+// path from the content root only, as by default, or also by file name or
+// partial path anywhere in the site, optionally ignoring case, with the
+// sections listed in prefer winning when several pages match.
+type wikilinksConfig struct {
+	CaseInsensitive bool     `yaml:"caseInsensitive"`
+	Search          bool     `yaml:"search"`
+	Prefer          []string `yaml:"prefer"`
+	Report          string   `yaml:"report"`
+}
+
+// wikilinkProblem is an entry of the wikilink report.
+type wikilinkProblem struct {
+	Source     string   `json:"source"`
+	Target     string   `json:"target"`
+	Fragment   string   `json:"fragment,omitempty"`
+	Text       string   `json:"text"`
+	Problem    string   `json:"problem"`
+	Candidates []string `json:"candidates,omitempty"`
+}
+
+// wikilinkResolver resolves wikilink targets from the root of the content
+// directory, as Obsidian does, to URLs under the site's base path. Once
+// the site's pages are indexed, targets that name no page by path are
+// matched as the wikilinks setting allows, and `#Heading` fragments
+// resolve to the IDs of the target page's headings. current is the page
+// being rendered, which `[[#Heading]]` links point into.
+type wikilinkResolver struct {
+	settings siteConfig
+	pages    map[string]string
+	headings map[string]map[string]string
+	current  *Page
+}
+
+func wikilinkDestination(settings siteConfig, target string) string {
+	if path.Ext(target) == "" {
+		target = settings.pageURL(settings.parseContentPath(strings.TrimPrefix(target, "/") + ".md").outputPath)
+	}
+	return settings.sitePath(target)
+}
+
+// wikilinkKey is the path a page is linked to by: `blog/first-post` for
+// `/blog/first-post.html` and `post` for `/post/`.
+func wikilinkKey(settings siteConfig, url string) string {
+	key := strings.TrimPrefix(url, settings.BasePath)
+	key = strings.TrimSuffix(strings.TrimSuffix(key, "index.html"), "/")
+	return strings.Trim(strings.TrimSuffix(key, ".html"), "/")
+}
+
+// index records the pages wikilinks can resolve to and their headings,
+// by ID and by text regardless of case.
+func (resolver *wikilinkResolver) index(pages []*Page) {
+	resolver.pages = make(map[string]string, len(pages))
+	resolver.headings = make(map[string]map[string]string, len(pages))
+	for _, page := range pages {
+		resolver.pages[wikilinkKey(resolver.settings, page.RelPermalink)] = page.RelPermalink
+
+		headings := make(map[string]string)
+		ast.Walk(page.document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+			heading, ok := node.(*ast.Heading)
+			if !entering || !ok {
+				return ast.WalkContinue, nil
+			}
+			if id, ok := heading.AttributeString("id"); ok {
+				if id, ok := id.([]byte); ok {
+					headings[string(id)] = string(id)
+					headings[strings.ToLower(strings.TrimSpace(string(heading.Text(page.source))))] = string(id)
+				}
+			}
+			return ast.WalkSkipChildren, nil
+		})
+		resolver.headings[page.RelPermalink] = headings
+	}
+
+	// Pages given a url or slug in their front matter are still found by
+	// their file, unless another page is there.
+	for _, page := range pages {
+		if !strings.HasPrefix(page.SourcePath, contentDirectory+"/") {
+			continue
+		}
+		contentPath := strings.TrimPrefix(page.SourcePath, contentDirectory+"/")
+		url := resolver.settings.sitePath(resolver.settings.pageURL(resolver.settings.parseContentPath(contentPath).outputPath))
+		if key := wikilinkKey(resolver.settings, url); resolver.pages[key] == "" {
+			resolver.pages[key] = page.RelPermalink
+		}
+	}
+}
+
+// headingID returns the ID of the heading of the page at url that fragment
+// names, by ID or by text.
+func (resolver *wikilinkResolver) headingID(url string, fragment string) (string, bool) {
+	headings, ok := resolver.headings[url]
+	if !ok {
+		return fragment, false
+	}
+	if id, ok := headings[fragment]; ok {
+		return id, true
+	}
+	id, ok := headings[strings.ToLower(strings.TrimSpace(fragment))]
+	if !ok {
+		return fragment, false
+	}
+	return id, true
+}
+
+// resolve returns the URL of a page target, every page it could refer to
+// with the preferred first, and whether any page matches at all.
+func (resolver *wikilinkResolver) resolve(target string) (string, []string, bool) {
+	destination := wikilinkDestination(resolver.settings, target)
+	if resolver.pages == nil || path.Ext(target) != "" {
+		return destination, nil, true
+	}
+	key := wikilinkKey(resolver.settings, destination)
+	if url, ok := resolver.pages[key]; ok {
+		return url, nil, true
+	}
+
+	config := resolver.settings.Wikilinks
+	same := func(a string, b string) bool {
+		return a == b || (config.CaseInsensitive && strings.EqualFold(a, b))
+	}
+	var candidates []string
+	for pageKey := range resolver.pages {
+		if same(pageKey, key) || (config.Search && len(pageKey) > len(key) && pageKey[len(pageKey)-len(key)-1] == '/' && same(pageKey[len(pageKey)-len(key):], key)) {
+			candidates = append(candidates, pageKey)
+		}
+	}
+	if len(candidates) == 0 {
+		return destination, nil, false
+	}
+
+	preference := func(key string) int {
+		section, _, _ := strings.Cut(key, "/")
+		for i, preferred := range config.Prefer {
+			if section == preferred {
+				return i
+			}
+		}
+		return len(config.Prefer)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if preference(a) != preference(b) {
+			return preference(a) < preference(b)
+		}
+		if strings.Count(a, "/") != strings.Count(b, "/") {
+			return strings.Count(a, "/") < strings.Count(b, "/")
+		}
+		return a < b
+	})
+	// A moved page is found by its file as well as its URL, but is one
+	// candidate.
+	var urls []string
+	found := make(map[string]bool)
+	for _, candidate := range candidates {
+		if url := resolver.pages[candidate]; !found[url] {
+			found[url] = true
+			urls = append(urls, url)
+		}
+	}
+	return urls[0], urls, true
+}
+
+func (resolver *wikilinkResolver) ResolveWikilink(node *wikilink.Node) ([]byte, error) {
+	destination, url := "", ""
+	if resolver.current != nil {
+		url = resolver.current.RelPermalink
+	}
+	if len(node.Target) > 0 {
+		destination, _, _ = resolver.resolve(string(node.Target))
+		url = destination
+	}
+	if len(node.Fragment) > 0 {
+		id := string(node.Fragment)
+		if path.Ext(string(node.Target)) == "" {
+			id, _ = resolver.headingID(url, id)
+		}
+		destination += "#" + id
+	}
+	return []byte(destination), nil
+}
+
+// writeWikilinkReport writes the unresolved and ambiguous wikilinks to the
+// report file named in the wikilinks setting, if any.
+func writeWikilinkReport(file string, problems []wikilinkProblem) {
+	if file == "" {
+		return
+	}
+	if problems == nil {
+		problems = []wikilinkProblem{}
+	}
+	data, err := json.MarshalIndent(problems, "", "  ")
+	check(err)
+	createDirectoryPath(file)
+	check(os.WriteFile(filepath.FromSlash(file), append(data, '\n'), 0666))
+}